@@ -13,11 +13,13 @@ require (
 	github.com/go-sql-driver/mysql v1.7.0
 	github.com/golang-jwt/jwt/v5 v5.0.0
 	github.com/google/wire v0.5.0
+	github.com/hashicorp/golang-lru/v2 v2.0.7
 	github.com/redis/go-redis/v9 v9.1.0
 	github.com/stretchr/testify v1.8.4
 	github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/sms v1.0.759
 	go.uber.org/mock v0.3.0
 	golang.org/x/crypto v0.12.0
+	golang.org/x/sync v0.3.0
 	gorm.io/driver/mysql v1.5.1
 	gorm.io/gorm v1.25.4
 )
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"geektime/webook/internal/repository/dao"
+	"geektime/webook/ioc"
+	"geektime/webook/pkg/phone"
+)
+
+// 把存量用户的手机号码统一成 E.164，上线新版本之前执行一次
+func main() {
+	res, err := dao.MigratePhone(context.Background(), ioc.InitDB(), phone.Normalize, 500)
+	if err != nil {
+		log.Fatalln("迁移手机号码失败", err)
+	}
+	log.Printf("更新了 %d 个用户", res.Updated)
+	if len(res.Invalid) > 0 {
+		log.Println("手机号码格式错误的用户", res.Invalid)
+	}
+	if len(res.Conflicts) > 0 {
+		log.Println("手机号码重复的用户", res.Conflicts)
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"geektime/webook/internal/repository"
+	"geektime/webook/internal/repository/dao"
+	"geektime/webook/ioc"
+)
+
+// 独立部署的短信网关，其它团队通过 gateway.Client 调用
+func main() {
+	recordRepo := repository.NewSMSRecordRepository(dao.NewSMSRecordDAO(ioc.InitDB()), ioc.InitSMSPhoneHashKey())
+	smsSvc := ioc.InitLocalSMSService(ioc.InitSMSProvider(ioc.InitSMSTemplates()), recordRepo, ioc.InitRedis())
+	hdl := ioc.InitSMSGatewayHandler(smsSvc)
+	server := gin.Default()
+	hdl.RegisterRoutes(server)
+	server.Run(":8081")
+}
@@ -6,6 +6,14 @@
 
 package config
 
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"os"
+	"time"
+)
+
 var Config = config{
 	DB: DBConfig{
 		// 本地连接
@@ -14,4 +22,108 @@ var Config = config{
 	Redis: RedisConfig{
 		Addr: "localhost:6379",
 	},
+	SMS: SMSConfig{
+		// 开发环境不真的发短信，验证码打印在控制台
+		Provider: "memory",
+		Templates: map[string]map[string]SMSTemplateConfig{
+			"login_code": {
+				"tencent": {Id: "1877556", Params: []string{"code"}},
+				"memory":  {Id: "login_code", Params: []string{"code"}},
+			},
+			"reset_password": {
+				"memory": {Id: "reset_password", Params: []string{"code"}},
+			},
+		},
+		Gateway: SMSGatewayConfig{
+			Key: envOrRandom("SMS_GATEWAY_KEY"),
+		},
+		RateLimits: []SMSRateLimitConfig{
+			{Dimension: "phone", Interval: time.Hour * 24, Rate: 10, FailurePolicy: "local"},
+			{Dimension: "ip", Interval: time.Hour, Rate: 20, FailurePolicy: "local"},
+			{Dimension: "biz", Interval: time.Second, Rate: 100, FailurePolicy: "open"},
+			{Dimension: "global", Interval: time.Second, Rate: 1000, FailurePolicy: "local"},
+		},
+		Budget: SMSBudgetConfig{
+			Daily:   100000,
+			Monthly: 2000000,
+			// 内存发件箱不花钱，按腾讯云的价格算，开发环境也能看到预算的效果
+			Prices:     map[string]int64{"tencent": 5, "memory": 5},
+			Thresholds: []float64{0.5, 0.8, 0.95},
+		},
+		Record: SMSRecordConfig{
+			CallbackToken: os.Getenv("SMS_CALLBACK_TOKEN"),
+			PhoneHashKey:  envOrRandom("SMS_PHONE_HASH_KEY"),
+		},
+	},
+	Email: EmailConfig{
+		// 开发环境不真的发邮件，验证码打印在控制台
+		Provider: "memory",
+		Templates: map[string]EmailTemplateConfig{
+			"login_code": {
+				Subject: "webook 登录验证码",
+				Body:    "你的验证码是 {{.code}}，{{.minutes}} 分钟内有效，请勿泄露给他人。",
+				Params:  []string{"code", "minutes"},
+			},
+		},
+	},
+	Captcha: CaptchaConfig{
+		Window:         time.Minute * 10,
+		IPThreshold:    5,
+		PhoneThreshold: 3,
+	},
+	Code: CodeConfig{
+		Biz: map[string]CodeBizConfig{
+			"login": {
+				Template: "login_code",
+				Channels: []string{"sms", "email"},
+				Policy: CodePolicyConfig{
+					Length:         6,
+					Alphabet:       "0123456789",
+					TTL:            time.Minute * 10,
+					ResendInterval: time.Minute,
+					MaxAttempts:    3,
+				},
+			},
+			"reset_password": {
+				Template: "reset_password",
+				Channels: []string{"sms"},
+				ProofTTL: time.Minute * 5,
+			},
+		},
+		LocalCapacity: 100000,
+		Secret:        envOrRandom("CODE_SECRET"),
+		ProofKey:      envOrRandom("CODE_PROOF_KEY"),
+	},
+	UserCache: UserCacheConfig{
+		LocalCapacity: 10000,
+		LocalTTL:      time.Second * 30,
+	},
+	RateLimit: RateLimitConfig{
+		Source:       "redis",
+		HTTPKey:      "ratelimit:rules:http",
+		SMSKey:       "ratelimit:rules:sms",
+		PollInterval: time.Second * 10,
+	},
+	Concurrency: ConcurrencyConfig{
+		HTTP: ConcurrencyLimitConfig{Initial: 200, Min: 20, Max: 2000, Target: time.Millisecond * 500},
+		// 登录要算 bcrypt，本身就要几十毫秒
+		UserService: ConcurrencyLimitConfig{Initial: 50, Min: 5, Max: 500, Target: time.Millisecond * 300},
+	},
+	Admin: AdminConfig{
+		Addr: "localhost:9090",
+	},
+}
+
+// envOrRandom 密钥不提交到代码里面。开发环境没有配置环境变量的时候，
+// 每次启动随机生成一个，重启之后之前签发的东西就都失效了
+func envOrRandom(key string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	log.Printf("没有配置环境变量 %s，使用随机生成的密钥", key)
+	return hex.EncodeToString(buf)
 }
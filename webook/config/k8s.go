@@ -2,6 +2,11 @@
 
 package config
 
+import (
+	"os"
+	"time"
+)
+
 var Config = config{
 	DB: DBConfig{
 		DSN: "root:root@tcp(webook-mysql:11309)/webook",
@@ -9,4 +14,113 @@ var Config = config{
 	Redis: RedisConfig{
 		Addr: "webook-redis:6379",
 	},
+	SMS: SMSConfig{
+		Provider: "tencent",
+		// 部署的时候通过 Secret 注入环境变量
+		Tencent: TencentSMSConfig{
+			AppId:    os.Getenv("TENCENTCLOUD_SMS_APP_ID"),
+			SignName: os.Getenv("TENCENTCLOUD_SMS_SIGN_NAME"),
+			Region:   os.Getenv("TENCENTCLOUD_REGION"),
+		},
+		Templates: map[string]map[string]SMSTemplateConfig{
+			"login_code": {
+				"tencent": {Id: "1877556", Params: []string{"code"}},
+				"memory":  {Id: "login_code", Params: []string{"code"}},
+			},
+			"reset_password": {
+				// 模板在腾讯云控制台审核通过之后才有 ID，和密钥一样通过环境变量注入
+				"tencent": {Id: os.Getenv("TENCENTCLOUD_SMS_RESET_PASSWORD_TEMPLATE_ID"), Params: []string{"code"}},
+				"memory":  {Id: "reset_password", Params: []string{"code"}},
+			},
+		},
+		// 密钥和 token 都通过 Secret 注入环境变量
+		Gateway: SMSGatewayConfig{
+			Addr:  os.Getenv("SMS_GATEWAY_ADDR"),
+			Token: os.Getenv("SMS_GATEWAY_TOKEN"),
+			Key:   os.Getenv("SMS_GATEWAY_KEY"),
+		},
+		RateLimits: []SMSRateLimitConfig{
+			{Dimension: "phone", Interval: time.Hour * 24, Rate: 10, FailurePolicy: "local"},
+			{Dimension: "ip", Interval: time.Hour, Rate: 20, FailurePolicy: "local"},
+			{Dimension: "biz", Interval: time.Second, Rate: 100, FailurePolicy: "open"},
+			{Dimension: "global", Interval: time.Second, Rate: 1000, FailurePolicy: "local"},
+		},
+		Budget: SMSBudgetConfig{
+			Daily:      100000,
+			Monthly:    2000000,
+			Prices:     map[string]int64{"tencent": 5},
+			Thresholds: []float64{0.5, 0.8, 0.95},
+		},
+		Record: SMSRecordConfig{
+			CallbackToken: os.Getenv("SMS_CALLBACK_TOKEN"),
+			PhoneHashKey:  os.Getenv("SMS_PHONE_HASH_KEY"),
+		},
+	},
+	Email: EmailConfig{
+		Provider: "smtp",
+		// 部署的时候通过 Secret 注入环境变量
+		SMTP: SMTPConfig{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+			Timeout:  time.Second * 10,
+		},
+		Templates: map[string]EmailTemplateConfig{
+			"login_code": {
+				Subject: "webook 登录验证码",
+				Body:    "你的验证码是 {{.code}}，{{.minutes}} 分钟内有效，请勿泄露给他人。",
+				Params:  []string{"code", "minutes"},
+			},
+		},
+	},
+	Captcha: CaptchaConfig{
+		Window:         time.Minute * 10,
+		IPThreshold:    5,
+		PhoneThreshold: 3,
+	},
+	Code: CodeConfig{
+		Biz: map[string]CodeBizConfig{
+			"login": {
+				Template: "login_code",
+				Channels: []string{"sms", "email"},
+				Policy: CodePolicyConfig{
+					Length:         6,
+					Alphabet:       "0123456789",
+					TTL:            time.Minute * 10,
+					ResendInterval: time.Minute,
+					MaxAttempts:    3,
+				},
+			},
+			"reset_password": {
+				Template: "reset_password",
+				Channels: []string{"sms"},
+				ProofTTL: time.Minute * 5,
+			},
+		},
+		LocalCapacity: 100000,
+		// 部署的时候通过 Secret 注入环境变量
+		Secret:   os.Getenv("CODE_SECRET"),
+		ProofKey: os.Getenv("CODE_PROOF_KEY"),
+	},
+	UserCache: UserCacheConfig{
+		LocalCapacity: 10000,
+		LocalTTL:      time.Second * 30,
+	},
+	RateLimit: RateLimitConfig{
+		// 挂载的 ConfigMap，kubectl edit 之后几十秒内生效
+		Source:       "file",
+		HTTPFile:     "/etc/webook/ratelimit/http.json",
+		SMSFile:      "/etc/webook/ratelimit/sms.json",
+		PollInterval: time.Second * 10,
+	},
+	Concurrency: ConcurrencyConfig{
+		HTTP: ConcurrencyLimitConfig{Initial: 200, Min: 20, Max: 2000, Target: time.Millisecond * 500},
+		// 登录要算 bcrypt，本身就要几十毫秒
+		UserService: ConcurrencyLimitConfig{Initial: 50, Min: 5, Max: 500, Target: time.Millisecond * 300},
+	},
+	// 只在 Pod 里面监听，Service 不暴露这个端口
+	Admin: AdminConfig{
+		Addr: ":9090",
+	},
 }
@@ -1,8 +1,24 @@
 package config
 
+import (
+	"time"
+)
+
 type config struct {
-	DB    DBConfig
-	Redis RedisConfig
+	DB      DBConfig
+	Redis   RedisConfig
+	SMS     SMSConfig
+	Email   EmailConfig
+	Captcha CaptchaConfig
+	Code    CodeConfig
+	// 用户信息缓存
+	UserCache UserCacheConfig
+	// 限流规则的来源，改了之后不用重启
+	RateLimit RateLimitConfig
+	// 自适应并发限制
+	Concurrency ConcurrencyConfig
+	// 内部管理端口，不对外暴露
+	Admin AdminConfig
 }
 
 type DBConfig struct {
@@ -12,3 +28,180 @@ type DBConfig struct {
 type RedisConfig struct {
 	Addr string
 }
+
+type SMSConfig struct {
+	// 真正发短信的服务商：tencent，或者 memory（内存发件箱，只能在开发环境用）
+	Provider string
+	Tencent  TencentSMSConfig
+	// 逻辑模板 => 服务商 => 模板配置
+	Templates map[string]map[string]SMSTemplateConfig
+	Gateway   SMSGatewayConfig
+	// 限流规则，不管配置的顺序，都按照 global、biz、ip、phone 的顺序检查
+	RateLimits []SMSRateLimitConfig
+	Budget     SMSBudgetConfig
+	Record     SMSRecordConfig
+}
+
+// SMSRecordConfig 发送记录和送达回执
+type SMSRecordConfig struct {
+	// 服务商回调地址上带的 token，例如 /sms/callback/tencent?token=xxx，为空的时候拒绝所有回调
+	CallbackToken string
+	// 号码摘要用的 HMAC 密钥
+	PhoneHashKey string
+	// 可以查发送记录的客服账号
+	SupportUids []int64
+}
+
+type TencentSMSConfig struct {
+	AppId    string
+	SignName string
+	Region   string
+	// SecretId 和 SecretKey 不放在配置里面，从环境变量
+	// TENCENTCLOUD_SECRET_ID 和 TENCENTCLOUD_SECRET_KEY 读
+}
+
+type SMSTemplateConfig struct {
+	// 服务商那边的模板 ID
+	Id       string
+	SignName string
+	// 是否按名字传参，默认按位置传参
+	Named bool
+	// 参数名，按顺序和发送时的 args 一一对应
+	Params []string
+}
+
+type SMSGatewayConfig struct {
+	// 短信网关地址，不为空的时候 webook 通过网关发送短信
+	Addr string
+	// 调用短信网关用的 token
+	Token string
+	// 短信网关校验 token 用的密钥
+	Key string
+}
+
+type SMSRateLimitConfig struct {
+	// phone, ip, biz, global
+	Dimension string
+	// Interval 内最多发送 Rate 条
+	Interval time.Duration
+	Rate     int
+	// Redis 出错的时候怎么办：open 放行，closed 限流，local 降级为本地限流
+	FailurePolicy string
+}
+
+type SMSBudgetConfig struct {
+	// 单位都是分，0 表示不限制
+	Daily   int64
+	Monthly int64
+	// 服务商 => 每条短信的单价
+	Prices map[string]int64
+	// 告警阈值，例如 0.8 表示用了 80% 的时候告警
+	Thresholds []float64
+}
+
+type EmailConfig struct {
+	// smtp，或者 memory（内存发件箱，只能在开发环境用）
+	Provider string
+	SMTP     SMTPConfig
+	// 逻辑模板 => 邮件模板
+	Templates map[string]EmailTemplateConfig
+}
+
+type SMTPConfig struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+	// 连接加发送的总超时，0 用默认值
+	Timeout time.Duration
+}
+
+type EmailTemplateConfig struct {
+	// text/template 的语法，例如 {{.code}}
+	Subject string
+	Body    string
+	// 参数名，按顺序和发送时的 args 一一对应
+	Params []string
+}
+
+type CaptchaConfig struct {
+	// Window 内同一个 IP 或者同一个手机号码发送验证码达到阈值之后要先做人机验证，
+	// 阈值是 0 表示不检查
+	Window         time.Duration
+	IPThreshold    int
+	PhoneThreshold int
+}
+
+type CodeConfig struct {
+	// 业务 => 业务配置，没有注册的业务不能发送验证码
+	Biz map[string]CodeBizConfig
+	// 单实例部署可以不用 Redis，只用本地缓存
+	LocalOnly bool
+	// 本地缓存最多存多少个验证码，Redis 不可用的时候也会降级到本地缓存
+	LocalCapacity int
+	// Redis 里面只存验证码的 HMAC，这是计算 HMAC 的密钥
+	Secret string
+	// 签发验证凭证的密钥
+	ProofKey string
+}
+
+type CodeBizConfig struct {
+	// 逻辑模板
+	Template string
+	// 允许的渠道，sms 或者 email
+	Channels []string
+	// 验证通过之后签发的凭证的有效期，0 就是不签发
+	ProofTTL time.Duration
+	// 没有配置的字段用默认值
+	Policy CodePolicyConfig
+}
+
+type CodePolicyConfig struct {
+	Length         int
+	Alphabet       string
+	TTL            time.Duration
+	ResendInterval time.Duration
+	MaxAttempts    int
+}
+
+type UserCacheConfig struct {
+	// 本地缓存最多存多少个用户，0 就是不用本地缓存，只用 Redis
+	LocalCapacity int
+	// 本地缓存的有效期，别的实例修改了用户信息，通知丢了的话最多读到这么久的旧数据
+	LocalTTL time.Duration
+}
+
+type RateLimitConfig struct {
+	// 规则从哪里读：file 或者 redis。空的就只用默认规则，
+	// 默认规则是代码里面的 HTTP 规则和 SMS.RateLimits
+	Source string
+	// Source 是 file 的时候，HTTP 和短信规则的 JSON 文件，内容是 RuleSpec 数组
+	HTTPFile string
+	SMSFile  string
+	// Source 是 redis 的时候，HTTP 和短信规则所在的 hash，field 是规则名字，value 是 RuleSpec 的 JSON
+	HTTPKey string
+	SMSKey  string
+	// 多久检查一次规则有没有变化
+	PollInterval time.Duration
+}
+
+type ConcurrencyConfig struct {
+	// 整个 HTTP 服务
+	HTTP ConcurrencyLimitConfig
+	// 访问 MySQL 的 UserService
+	UserService ConcurrencyLimitConfig
+}
+
+type ConcurrencyLimitConfig struct {
+	// 初始的并发数上限，之后在 [Min, Max] 之间自动调整
+	Initial int
+	Min     int
+	Max     int
+	// 请求耗时超过 Target 就认为下游变慢了
+	Target time.Duration
+}
+
+type AdminConfig struct {
+	// 监听地址，/debug/vars 上可以看到限流降级次数之类的指标
+	Addr string
+}
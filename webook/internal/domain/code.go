@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"time"
+)
+
+// CodePolicy 验证码策略，每个业务可以不一样
+type CodePolicy struct {
+	// 验证码长度
+	Length int
+	// 验证码用到的字符，例如 0123456789
+	Alphabet string
+	// 有效期
+	TTL time.Duration
+	// 两次发送之间最少间隔多久
+	ResendInterval time.Duration
+	// 最多可以验证几次
+	MaxAttempts int
+}
+
+var DefaultCodePolicy = CodePolicy{
+	Length:         6,
+	Alphabet:       "0123456789",
+	TTL:            time.Minute * 10,
+	ResendInterval: time.Minute,
+	MaxAttempts:    3,
+}
+
+// WithDefaults 没有设置的字段用 DefaultCodePolicy 的值
+func (p CodePolicy) WithDefaults() CodePolicy {
+	if p.Length <= 0 {
+		p.Length = DefaultCodePolicy.Length
+	}
+	if p.Alphabet == "" {
+		p.Alphabet = DefaultCodePolicy.Alphabet
+	}
+	if p.TTL <= 0 {
+		p.TTL = DefaultCodePolicy.TTL
+	}
+	if p.ResendInterval <= 0 {
+		p.ResendInterval = DefaultCodePolicy.ResendInterval
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultCodePolicy.MaxAttempts
+	}
+	return p
+}
+
+type CodeVerifyStatus uint8
+
+const (
+	// CodeVerifyOK 验证通过
+	CodeVerifyOK CodeVerifyStatus = iota
+	// CodeVerifyWrong 输错了，还可以再试 Remaining 次
+	CodeVerifyWrong
+	// CodeVerifyExhausted 输错的次数用完了
+	CodeVerifyExhausted
+	// CodeVerifyUsed 已经验证通过过一次，不能再用
+	CodeVerifyUsed
+	// CodeVerifyExpired 发送过，但是已经过期了
+	CodeVerifyExpired
+	// CodeVerifyNotSent 没有发送过验证码
+	CodeVerifyNotSent
+)
+
+// CodeVerifyResult 验证码校验结果
+type CodeVerifyResult struct {
+	Status CodeVerifyStatus
+	// 还可以验证几次，只有 CodeVerifyWrong 有意义
+	Remaining int
+	// 验证通过之后签发的凭证，业务没有要求的时候是空的
+	Proof string
+}
+
+func (r CodeVerifyResult) OK() bool {
+	return r.Status == CodeVerifyOK
+}
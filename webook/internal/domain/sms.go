@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"time"
+)
+
+// SMSRecord 一条短信的发送记录，一个号码一条
+type SMSRecord struct {
+	Id       int64
+	Provider string
+	TplId    string
+	// 写入的时候是完整号码，查出来的是脱敏之后的号码
+	Phone string
+	// 服务商的流水号，状态回调靠它关联
+	RequestId string
+	Status    SMSStatus
+	// 调用服务商的耗时
+	Latency time.Duration
+	// 失败或者回执的描述
+	Msg   string
+	Ctime time.Time
+	Utime time.Time
+}
+
+type SMSStatus uint8
+
+const (
+	SMSStatusUnknown SMSStatus = iota
+	// SMSStatusAccepted 服务商已经受理，等待回执
+	SMSStatusAccepted
+	// SMSStatusFailed 服务商没有受理
+	SMSStatusFailed
+	// SMSStatusDelivered 用户已经收到
+	SMSStatusDelivered
+	// SMSStatusUndelivered 服务商回执说没有送达
+	SMSStatusUndelivered
+)
+
+// SMSReport 服务商的送达回执
+type SMSReport struct {
+	Provider  string
+	RequestId string
+	Delivered bool
+	Msg       string
+}
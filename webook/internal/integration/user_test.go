@@ -6,19 +6,25 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"testing"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	emailmemory "geektime/webook/internal/service/email/memory"
+	"geektime/webook/internal/service/sms/memory"
 	"geektime/webook/internal/web"
 	"geektime/webook/ioc"
 )
 
 func TestUserHandler_SendLoginSMSCode(t *testing.T) {
-	server := InitWebServer()
+	server, err := InitWebServer(memory.NewService(ioc.InitSMSTemplates()), emailmemory.NewService())
+	require.NoError(t, err)
 	rdb := ioc.InitRedis()
+	t.Cleanup(func() { cleanCaptchaRisk(rdb, "+8615212345678") })
 	testCases := []struct {
 		name string
 
@@ -39,11 +45,11 @@ func TestUserHandler_SendLoginSMSCode(t *testing.T) {
 			after: func(t *testing.T) {
 				// 清理数据
 				ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-				val, err := rdb.GetDel(ctx, "phone_code:login:15212345678").Result()
+				val, err := rdb.GetDel(ctx, "phone_code:login:sms:+8615212345678").Result()
 				cancel()
 				assert.NoError(t, err)
-				// 验证码为 6 位
-				assert.True(t, len(val) == 6)
+				// 存的是验证码的 HMAC，不是 6 位的明文
+				assert.Len(t, val, 64)
 			},
 			reqBody:      `{"phone": "15212345678"}`,
 			expectedCode: http.StatusOK,
@@ -57,13 +63,13 @@ func TestUserHandler_SendLoginSMSCode(t *testing.T) {
 			before: func(t *testing.T) {
 				// 这个手机号已经有一个验证码了
 				ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-				_, err := rdb.Set(ctx, "phone_code:login:15212345678", "123456", time.Minute*9+time.Second*30).Result()
+				_, err := rdb.Set(ctx, "phone_code:login:sms:+8615212345678", "123456", time.Minute*9+time.Second*30).Result()
 				cancel()
 				assert.NoError(t, err)
 			},
 			after: func(t *testing.T) {
 				ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-				val, err := rdb.GetDel(ctx, "phone_code:login:15212345678").Result()
+				val, err := rdb.GetDel(ctx, "phone_code:login:sms:+8615212345678").Result()
 				cancel()
 				assert.NoError(t, err)
 				// 验证码没有被覆盖，还是 123456
@@ -81,13 +87,13 @@ func TestUserHandler_SendLoginSMSCode(t *testing.T) {
 			before: func(t *testing.T) {
 				// 这个手机号已经有一个验证码了，但是没有过期时间
 				ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-				_, err := rdb.Set(ctx, "phone_code:login:15212345678", "123456", 0).Result()
+				_, err := rdb.Set(ctx, "phone_code:login:sms:+8615212345678", "123456", 0).Result()
 				cancel()
 				assert.NoError(t, err)
 			},
 			after: func(t *testing.T) {
 				ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-				val, err := rdb.GetDel(ctx, "phone_code:login:15212345678").Result()
+				val, err := rdb.GetDel(ctx, "phone_code:login:sms:+8615212345678").Result()
 				cancel()
 				assert.NoError(t, err)
 				// 验证码为 6 位
@@ -115,6 +121,21 @@ func TestUserHandler_SendLoginSMSCode(t *testing.T) {
 				Msg:  "输入错误",
 			},
 		},
+		{
+			name: "手机号码格式错误",
+			before: func(t *testing.T) {
+
+			},
+			after: func(t *testing.T) {
+
+			},
+			reqBody:      `{"phone": "1521234567"}`,
+			expectedCode: http.StatusOK,
+			expectedBody: web.Result{
+				Code: 4,
+				Msg:  "手机号码格式错误",
+			},
+		},
 		{
 			name: "手机号码格式错误， bind 失败",
 			before: func(t *testing.T) {
@@ -152,3 +173,124 @@ func TestUserHandler_SendLoginSMSCode(t *testing.T) {
 		})
 	}
 }
+
+func TestUserHandler_LoginSMS(t *testing.T) {
+	outbox := memory.NewService(ioc.InitSMSTemplates())
+	server, err := InitWebServer(outbox, emailmemory.NewService())
+	require.NoError(t, err)
+	rdb := ioc.InitRedis()
+	const (
+		phone = "152 1234 5679"
+		// 存储和发送都用 E.164
+		e164 = "+8615212345679"
+	)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+		rdb.Del(ctx, "phone_code:login:sms:"+e164, "phone_code:login:sms:"+e164+":cnt")
+		cleanCaptchaRisk(rdb, e164)
+	})
+
+	// 发送验证码
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/users/login_sms/code/send",
+		bytes.NewBuffer([]byte(`{"phone": "`+phone+`"}`)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	server.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	// 从发件箱里面拿到验证码
+	msg, ok := outbox.Last(e164)
+	require.True(t, ok)
+	require.Len(t, msg.Args, 1)
+
+	// 输错一次
+	resp = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodPost, "/users/login_sms",
+		bytes.NewBuffer([]byte(`{"phone": "`+phone+`", "code": "wrong"}`)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	server.ServeHTTP(resp, req)
+	var result web.Result
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+	assert.Equal(t, web.CodeVerifyWrong, result.Code)
+	assert.Equal(t, "验证码错误，还可以输入 2 次", result.Msg)
+
+	// 用正确的验证码登录
+	resp = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodPost, "/users/login_sms",
+		bytes.NewBuffer([]byte(`{"phone": "`+phone+`", "code": "`+msg.Args[0]+`"}`)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	server.ServeHTTP(resp, req)
+	result = web.Result{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+	assert.Equal(t, web.Result{Msg: "验证码校验通过"}, result)
+	assert.NotEmpty(t, resp.Header().Get("x-jwt-token"))
+
+	// 验证码只能用一次
+	resp = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodPost, "/users/login_sms",
+		bytes.NewBuffer([]byte(`{"phone": "`+phone+`", "code": "`+msg.Args[0]+`"}`)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	server.ServeHTTP(resp, req)
+	result = web.Result{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+	assert.Equal(t, web.CodeVerifyUsed, result.Code)
+}
+
+func TestUserHandler_LoginEmail(t *testing.T) {
+	emailOutbox := emailmemory.NewService()
+	server, err := InitWebServer(memory.NewService(ioc.InitSMSTemplates()), emailOutbox)
+	require.NoError(t, err)
+	rdb := ioc.InitRedis()
+	const email = "login_email@qq.com"
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+		rdb.Del(ctx, "phone_code:login:email:"+email, "phone_code:login:email:"+email+":cnt")
+		cleanCaptchaRisk(rdb, email)
+	})
+
+	// 发送验证码，大小写和空格不同也是同一个邮箱
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/users/login_email/code/send",
+		bytes.NewBuffer([]byte(`{"email": " Login_Email@QQ.com "}`)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	server.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	// 从发件箱里面拿到验证码，Redis 里面只有它的 HMAC
+	msg, ok := emailOutbox.Last(email)
+	require.True(t, ok)
+	code := regexp.MustCompile(`\d{6}`).FindString(msg.Body)
+	require.NotEmpty(t, code)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	stored, err := rdb.Get(ctx, "phone_code:login:email:"+email).Result()
+	cancel()
+	require.NoError(t, err)
+	assert.NotContains(t, stored, code)
+
+	// 用正确的验证码登录
+	resp = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodPost, "/users/login_email",
+		bytes.NewBuffer([]byte(`{"email": "`+email+`", "code": "`+code+`"}`)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	server.ServeHTTP(resp, req)
+	var result web.Result
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+	assert.Equal(t, web.Result{Msg: "验证码校验通过"}, result)
+	assert.NotEmpty(t, resp.Header().Get("x-jwt-token"))
+}
+
+// cleanCaptchaRisk 清掉发送次数，反复跑测试不会触发人机验证。
+// http.NewRequest 没有 RemoteAddr，所以 IP 是空的；receiver 是手机号码或者邮箱
+func cleanCaptchaRisk(rdb redis.Cmdable, receiver string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	rdb.Del(ctx, "captcha:risk:ip:", "captcha:risk:phone:"+receiver)
+}
@@ -7,18 +7,25 @@ import (
 	"github.com/google/wire"
 
 	"geektime/webook/internal/repository"
-	"geektime/webook/internal/repository/cache"
 	"geektime/webook/internal/repository/dao"
 	"geektime/webook/internal/service"
+	"geektime/webook/internal/service/captcha"
+	emailmemory "geektime/webook/internal/service/email/memory"
+	"geektime/webook/internal/service/sms/memory"
 	"geektime/webook/internal/web"
 	"geektime/webook/ioc"
 )
 
-func InitWebServer() *gin.Engine {
+// InitWebServer 传入内存发件箱，测试可以从里面拿到发出去的验证码
+func InitWebServer(outbox *memory.Service, emailOutbox *emailmemory.Service) (*gin.Engine, error) {
 	wire.Build(ioc.InitDB, ioc.InitRedis,
-		dao.NewUserDAO, cache.NewUserCache, cache.NewCodeCache,
-		repository.NewUserRepository, repository.NewCodeRepository,
-		service.NewUserService, service.NewCodeService, ioc.InitSMSService,
-		web.NewUserHandler, ioc.InitWebServer, ioc.InitMiddlewares)
-	return new(gin.Engine)
+		dao.NewUserDAO, dao.NewSMSRecordDAO, ioc.InitUserCache, ioc.InitCodeCache,
+		repository.NewUserRepository, repository.NewCodeRepository, repository.NewSMSRecordRepository,
+		ioc.InitUserService, service.NewCodeService, service.NewSMSRecordService, ioc.InitCodeBizRegistry, ioc.InitCodeProofKey,
+		ioc.InitSMSPhoneHashKey, ioc.InitSMSRecordAuth,
+		ioc.InitSMSService, ioc.InitMemorySMSProvider,
+		ioc.InitMemoryEmailService, ioc.InitNotifyService,
+		captcha.NewService, ioc.InitCaptchaVerifier, ioc.InitCaptchaRiskChecker,
+		web.NewUserHandler, web.NewSMSRecordHandler, web.NewCaptchaHandler, ioc.InitWebServer, ioc.InitMiddlewares)
+	return new(gin.Engine), nil
 }
@@ -8,9 +8,11 @@ package integration
 
 import (
 	"geektime/webook/internal/repository"
-	"geektime/webook/internal/repository/cache"
 	"geektime/webook/internal/repository/dao"
 	"geektime/webook/internal/service"
+	"geektime/webook/internal/service/captcha"
+	emailmemory "geektime/webook/internal/service/email/memory"
+	"geektime/webook/internal/service/sms/memory"
 	"geektime/webook/internal/web"
 	"geektime/webook/ioc"
 	"github.com/gin-gonic/gin"
@@ -18,19 +20,44 @@ import (
 
 // Injectors from wire.go:
 
-func InitWebServer() *gin.Engine {
+// InitWebServer 传入内存发件箱，测试可以从里面拿到发出去的验证码
+func InitWebServer(outbox *memory.Service, emailOutbox *emailmemory.Service) (*gin.Engine, error) {
 	cmdable := ioc.InitRedis()
 	v := ioc.InitMiddlewares(cmdable)
 	db := ioc.InitDB()
 	userDAO := dao.NewUserDAO(db)
-	userCache := cache.NewUserCache(cmdable)
+	userCache := ioc.InitUserCache(cmdable)
 	userRepository := repository.NewUserRepository(userDAO, userCache)
-	userService := service.NewUserService(userRepository)
-	codeCache := cache.NewCodeCache(cmdable)
+	userService := ioc.InitUserService(userRepository)
+	codeCache, err := ioc.InitCodeCache(cmdable)
+	if err != nil {
+		return nil, err
+	}
 	codeRepository := repository.NewCodeRepository(codeCache)
-	smsService := ioc.InitSMSService()
-	codeService := service.NewCodeService(codeRepository, smsService)
-	userHandler := web.NewUserHandler(userService, codeService)
-	engine := ioc.InitWebServer(v, userHandler)
-	return engine
+	smsRecordDAO := dao.NewSMSRecordDAO(db)
+	smsPhoneHashKey := ioc.InitSMSPhoneHashKey()
+	smsRecordRepository := repository.NewSMSRecordRepository(smsRecordDAO, smsPhoneHashKey)
+	smsProvider := ioc.InitMemorySMSProvider(outbox)
+	smsService := ioc.InitSMSService(smsProvider, smsRecordRepository, cmdable)
+	emailService := ioc.InitMemoryEmailService(emailOutbox)
+	notifyService := ioc.InitNotifyService(smsService, emailService)
+	codeBizRegistry, err := ioc.InitCodeBizRegistry()
+	if err != nil {
+		return nil, err
+	}
+	codeProofKey, err := ioc.InitCodeProofKey()
+	if err != nil {
+		return nil, err
+	}
+	codeService := service.NewCodeService(codeRepository, notifyService, codeBizRegistry, codeProofKey)
+	captchaService := captcha.NewService(cmdable)
+	verifier := ioc.InitCaptchaVerifier(captchaService)
+	riskChecker := ioc.InitCaptchaRiskChecker(cmdable)
+	userHandler := web.NewUserHandler(userService, codeService, verifier, riskChecker)
+	smsRecordService := service.NewSMSRecordService(smsRecordRepository)
+	smsRecordAuth := ioc.InitSMSRecordAuth()
+	smsRecordHandler := web.NewSMSRecordHandler(smsRecordService, smsRecordAuth)
+	captchaHandler := web.NewCaptchaHandler(captchaService)
+	engine := ioc.InitWebServer(v, userHandler, smsRecordHandler, captchaHandler)
+	return engine, nil
 }
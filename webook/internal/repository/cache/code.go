@@ -2,17 +2,25 @@ package cache
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	_ "embed"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"geektime/webook/internal/domain"
+	"geektime/webook/pkg/redisx"
 )
 
 var (
-	ErrCodeSendTooMany        = errors.New("发送太频繁")
-	ErrCodeVerifyTooManyTimes = errors.New("验证次数太多")
-	ErrUnknownForCode         = errors.New("我也不知道发生了什么，反正肯定跟 code 有关")
+	ErrCodeSendTooMany = errors.New("发送太频繁")
+	ErrUnknownForCode  = errors.New("我也不知道发生了什么，反正肯定跟 code 有关")
+	// 验证码的 key 没有过期时间，说明有人手动改过 Redis
+	errCodeNoExpiration = errors.New("系统错误")
 )
 
 // 编译器会在编译的时候，把 set_code.lua 的代码放进来 luaSetCode 这个变量
@@ -23,32 +31,50 @@ var luaSetCode string
 //go:embed lua/verify_code.lua
 var luaVerifyCode string
 
+// 用 EVALSHA 执行，不用每次都把整个脚本发过去
+var (
+	setCodeScript    = redisx.Register(luaSetCode)
+	verifyCodeScript = redisx.Register(luaVerifyCode)
+)
+
+// 发送记录保留的时间，验证码过期之后还能区分是过期了还是没有发送过
+const codeRetention = time.Hour * 24
+
 type CodeCache interface {
-	Set(ctx context.Context, biz, phone, code string) error
-	Verify(ctx context.Context, biz, phone, inputCode string) (bool, error)
+	// Set 有效期、重发间隔和可验证次数由 policy 决定
+	Set(ctx context.Context, biz, phone, code string, policy domain.CodePolicy) error
+	Verify(ctx context.Context, biz, phone, inputCode string) (domain.CodeVerifyResult, error)
 }
 
+// RedisCodeCache Redis 里面只存验证码的 HMAC，拿到 Redis 的数据也没办法用来登录
 type RedisCodeCache struct {
 	client redis.Cmdable
+	// 计算 HMAC 用的密钥，只有服务端知道
+	secret []byte
 }
 
 // NewCodeCacheGoBestPractice go 的最佳实践是返回具体类型
-func NewCodeCacheGoBestPractice(client redis.Cmdable) *RedisCodeCache {
+func NewCodeCacheGoBestPractice(client redis.Cmdable, secret []byte) *RedisCodeCache {
 	return &RedisCodeCache{
 		client: client,
+		secret: secret,
 	}
 }
 
 // NewCodeCache 在使用 wire 的时候，注意你的初始化方法 NewXXX 最好返回接口
-func NewCodeCache(client redis.Cmdable) CodeCache {
+func NewCodeCache(client redis.Cmdable, secret []byte) CodeCache {
 	return &RedisCodeCache{
 		client: client,
+		secret: secret,
 	}
 }
 
-func (c *RedisCodeCache) Set(ctx context.Context, biz, phone, code string) error {
+func (c *RedisCodeCache) Set(ctx context.Context, biz, phone, code string, policy domain.CodePolicy) error {
 	// 把 lua 脚本放到 redis 里面执行
-	res, err := c.client.Eval(ctx, luaSetCode, []string{c.key(biz, phone)}, code).Int()
+	key := c.key(biz, phone)
+	res, err := setCodeScript.Run(ctx, c.client, []string{key}, c.hash(key, code),
+		int64(policy.TTL/time.Second), int64(policy.ResendInterval/time.Second), policy.MaxAttempts,
+		int64(codeRetention/time.Second)).Int()
 	if err != nil {
 		return err
 	}
@@ -58,27 +84,46 @@ func (c *RedisCodeCache) Set(ctx context.Context, biz, phone, code string) error
 	case -1:
 		return ErrCodeSendTooMany
 	default:
-		return errors.New("系统错误")
+		return errCodeNoExpiration
 	}
 }
 
-func (c *RedisCodeCache) Verify(ctx context.Context, biz, phone, inputCode string) (bool, error) {
-	res, err := c.client.Eval(ctx, luaVerifyCode, []string{c.key(biz, phone)}, inputCode).Int()
+func (c *RedisCodeCache) Verify(ctx context.Context, biz, phone, inputCode string) (domain.CodeVerifyResult, error) {
+	key := c.key(biz, phone)
+	res, err := verifyCodeScript.Run(ctx, c.client, []string{key}, c.hash(key, inputCode)).Int64Slice()
 	if err != nil {
-		return false, err
+		return domain.CodeVerifyResult{}, err
 	}
-	switch res {
+	if len(res) != 2 {
+		return domain.CodeVerifyResult{}, ErrUnknownForCode
+	}
+	switch res[0] {
 	case 0:
-		return true, nil
+		return domain.CodeVerifyResult{Status: domain.CodeVerifyOK}, nil
 	case -1:
-		return false, ErrCodeVerifyTooManyTimes
+		return domain.CodeVerifyResult{Status: domain.CodeVerifyExhausted}, nil
 	case -2:
-		return false, nil
+		return domain.CodeVerifyResult{Status: domain.CodeVerifyWrong, Remaining: int(res[1])}, nil
+	case -3:
+		return domain.CodeVerifyResult{Status: domain.CodeVerifyNotSent}, nil
+	case -4:
+		return domain.CodeVerifyResult{Status: domain.CodeVerifyUsed}, nil
+	case -5:
+		return domain.CodeVerifyResult{Status: domain.CodeVerifyExpired}, nil
 	default:
-		return false, ErrUnknownForCode
+		return domain.CodeVerifyResult{}, ErrUnknownForCode
 	}
 }
 
+// hash 带上 key 一起算，同一个验证码在不同手机号码、不同业务下的 HMAC 不一样
+func (c *RedisCodeCache) hash(key, code string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(key))
+	mac.Write([]byte{0})
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 func (c *RedisCodeCache) key(biz, phone string) string {
 	return fmt.Sprintf("phone_code:%s:%s", biz, phone)
 }
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"geektime/webook/internal/domain"
+)
+
+// countingConn 统计发给 Redis 的字节数
+type countingConn struct {
+	net.Conn
+	written *atomic.Int64
+}
+
+func (c countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(int64(n))
+	return n, err
+}
+
+// newBenchRedis 需要本地启动 Redis，没有的话跳过
+func newBenchRedis(tb testing.TB) (*redis.Client, *atomic.Int64) {
+	var written atomic.Int64
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return countingConn{Conn: conn, written: &written}, nil
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		tb.Skip("Redis 不可用", err)
+	}
+	return client, &written
+}
+
+// BenchmarkCodeScript 登录的时候要执行 set_code.lua 和 verify_code.lua，
+// 比较 EVAL 和 EVALSHA 每次发多少字节、花多长时间：
+//
+//	go test -run=^$ -bench=BenchmarkCodeScript ./internal/repository/cache/
+func BenchmarkCodeScript(b *testing.B) {
+	client, written := newBenchRedis(b)
+	c := NewCodeCacheGoBestPractice(client, codeSecret)
+	const key = "phone_code:bench:152"
+	ctx := context.Background()
+	policy := domain.DefaultCodePolicy
+	setArgs := []any{c.hash(key, "123456"), int64(policy.TTL / time.Second),
+		int64(policy.ResendInterval / time.Second), policy.MaxAttempts, int64(codeRetention / time.Second)}
+	verifyArgs := []any{c.hash(key, "123456")}
+	scripts := []struct {
+		name string
+		src  string
+		run  func(keys []string, args ...any) *redis.Cmd
+		args []any
+	}{
+		{name: "set_code", src: luaSetCode, args: setArgs, run: func(keys []string, args ...any) *redis.Cmd {
+			return setCodeScript.Run(ctx, client, keys, args...)
+		}},
+		{name: "verify_code", src: luaVerifyCode, args: verifyArgs, run: func(keys []string, args ...any) *redis.Cmd {
+			return verifyCodeScript.Run(ctx, client, keys, args...)
+		}},
+	}
+	b.Cleanup(func() {
+		client.Del(ctx, key, key+":cnt")
+	})
+	for _, s := range scripts {
+		s := s
+		b.Run(s.name+"/EVAL", func(b *testing.B) {
+			written.Store(0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := client.Eval(ctx, s.src, []string{key}, s.args...).Err(); err != nil && err != redis.Nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(written.Load())/float64(b.N), "sent-B/op")
+		})
+		b.Run(s.name+"/EVALSHA", func(b *testing.B) {
+			written.Store(0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := s.run([]string{key}, s.args...).Err(); err != nil && err != redis.Nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(written.Load())/float64(b.N), "sent-B/op")
+		})
+	}
+}
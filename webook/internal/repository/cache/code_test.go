@@ -4,23 +4,31 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 
+	"geektime/webook/internal/domain"
 	"geektime/webook/internal/repository/cache/redismocks"
 )
 
+var codeSecret = []byte("test secret")
+
+// phone_code:login:152 下面 123456 的 HMAC
+var codeHash = NewCodeCacheGoBestPractice(nil, codeSecret).hash("phone_code:login:152", "123456")
+
 func TestRedisCodeCache_Set(t *testing.T) {
 	testCases := []struct {
 		name string
 		mock func(ctrl *gomock.Controller) redis.Cmdable
 
-		ctx   context.Context
-		biz   string
-		phone string
-		code  string
+		ctx    context.Context
+		biz    string
+		phone  string
+		code   string
+		policy domain.CodePolicy
 
 		expectedErr error
 	}{
@@ -31,7 +39,7 @@ func TestRedisCodeCache_Set(t *testing.T) {
 				res := redis.NewCmd(context.Background())
 				res.SetErr(nil)
 				res.SetVal(int64(0))
-				cmd.EXPECT().Eval(gomock.Any(), luaSetCode, []string{"phone_code:login:152"}, []any{"123456"}).
+				cmd.EXPECT().EvalSha(gomock.Any(), setCodeScript.Hash(), []string{"phone_code:login:152"}, []any{codeHash, int64(600), int64(60), 3, int64(86400)}).
 					Return(res)
 				return cmd
 			},
@@ -39,6 +47,7 @@ func TestRedisCodeCache_Set(t *testing.T) {
 			biz:         "login",
 			phone:       "152",
 			code:        "123456",
+			policy:      domain.DefaultCodePolicy,
 			expectedErr: nil,
 		},
 		{
@@ -48,7 +57,7 @@ func TestRedisCodeCache_Set(t *testing.T) {
 				res := redis.NewCmd(context.Background())
 				res.SetErr(nil)
 				res.SetVal(int64(-1))
-				cmd.EXPECT().Eval(gomock.Any(), luaSetCode, []string{"phone_code:login:152"}, []any{"123456"}).
+				cmd.EXPECT().EvalSha(gomock.Any(), setCodeScript.Hash(), []string{"phone_code:login:152"}, []any{codeHash, int64(600), int64(60), 3, int64(86400)}).
 					Return(res)
 				return cmd
 			},
@@ -56,6 +65,7 @@ func TestRedisCodeCache_Set(t *testing.T) {
 			biz:         "login",
 			phone:       "152",
 			code:        "123456",
+			policy:      domain.DefaultCodePolicy,
 			expectedErr: ErrCodeSendTooMany,
 		},
 		{
@@ -65,7 +75,7 @@ func TestRedisCodeCache_Set(t *testing.T) {
 				res := redis.NewCmd(context.Background())
 				res.SetErr(nil)
 				res.SetVal(int64(-2))
-				cmd.EXPECT().Eval(gomock.Any(), luaSetCode, []string{"phone_code:login:152"}, []any{"123456"}).
+				cmd.EXPECT().EvalSha(gomock.Any(), setCodeScript.Hash(), []string{"phone_code:login:152"}, []any{codeHash, int64(600), int64(60), 3, int64(86400)}).
 					Return(res)
 				return cmd
 			},
@@ -73,6 +83,7 @@ func TestRedisCodeCache_Set(t *testing.T) {
 			biz:         "login",
 			phone:       "152",
 			code:        "123456",
+			policy:      domain.DefaultCodePolicy,
 			expectedErr: errors.New("系统错误"),
 		},
 		{
@@ -82,7 +93,7 @@ func TestRedisCodeCache_Set(t *testing.T) {
 				res := redis.NewCmd(context.Background())
 				res.SetErr(errors.New("mock error"))
 				res.SetVal(int64(0))
-				cmd.EXPECT().Eval(gomock.Any(), luaSetCode, []string{"phone_code:login:152"}, []any{"123456"}).
+				cmd.EXPECT().EvalSha(gomock.Any(), setCodeScript.Hash(), []string{"phone_code:login:152"}, []any{codeHash, int64(600), int64(60), 3, int64(86400)}).
 					Return(res)
 				return cmd
 			},
@@ -90,6 +101,7 @@ func TestRedisCodeCache_Set(t *testing.T) {
 			biz:         "login",
 			phone:       "152",
 			code:        "123456",
+			policy:      domain.DefaultCodePolicy,
 			expectedErr: errors.New("mock error"),
 		},
 	}
@@ -98,9 +110,127 @@ func TestRedisCodeCache_Set(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
-			c := NewCodeCache(tc.mock(ctrl))
-			err := c.Set(tc.ctx, tc.biz, tc.phone, tc.code)
+			c := NewCodeCache(tc.mock(ctrl), codeSecret)
+			err := c.Set(tc.ctx, tc.biz, tc.phone, tc.code, tc.policy)
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func TestRedisCodeCache_SetPolicy(t *testing.T) {
+	// 策略里面的有效期、重发间隔和可验证次数都要原样传给 lua 脚本
+	testCases := []struct {
+		name   string
+		policy domain.CodePolicy
+
+		expectedArgs []any
+	}{
+		{
+			name:         "默认策略",
+			policy:       domain.DefaultCodePolicy,
+			expectedArgs: []any{codeHash, int64(600), int64(60), 3, int64(86400)},
+		},
+		{
+			name: "有效期更短",
+			policy: domain.CodePolicy{
+				TTL: time.Minute * 5, ResendInterval: time.Minute, MaxAttempts: 3,
+			},
+			expectedArgs: []any{codeHash, int64(300), int64(60), 3, int64(86400)},
+		},
+		{
+			name: "重发间隔更长",
+			policy: domain.CodePolicy{
+				TTL: time.Minute * 10, ResendInterval: time.Minute * 2, MaxAttempts: 3,
+			},
+			expectedArgs: []any{codeHash, int64(600), int64(120), 3, int64(86400)},
+		},
+		{
+			name: "可以多验证几次",
+			policy: domain.CodePolicy{
+				TTL: time.Minute * 10, ResendInterval: time.Minute, MaxAttempts: 5,
+			},
+			expectedArgs: []any{codeHash, int64(600), int64(60), 5, int64(86400)},
+		},
+		{
+			name: "有效期内不允许重发",
+			policy: domain.CodePolicy{
+				TTL: time.Minute * 5, ResendInterval: time.Minute * 5, MaxAttempts: 1,
+			},
+			expectedArgs: []any{codeHash, int64(300), int64(300), 1, int64(86400)},
+		},
+		{
+			name: "全部自定义",
+			policy: domain.CodePolicy{
+				Length: 8, Alphabet: "ABCDEFGH", TTL: time.Minute * 30, ResendInterval: time.Second * 30, MaxAttempts: 10,
+			},
+			expectedArgs: []any{codeHash, int64(1800), int64(30), 10, int64(86400)},
+		},
+		{
+			name:         "没有设置的字段用默认值",
+			policy:       domain.CodePolicy{MaxAttempts: 5}.WithDefaults(),
+			expectedArgs: []any{codeHash, int64(600), int64(60), 5, int64(86400)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			res := redis.NewCmd(context.Background())
+			res.SetVal(int64(0))
+			cmd.EXPECT().EvalSha(gomock.Any(), setCodeScript.Hash(), []string{"phone_code:login:152"}, tc.expectedArgs).
+				Return(res)
+			err := NewCodeCache(cmd, codeSecret).Set(context.Background(), "login", "152", "123456", tc.policy)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRedisCodeCache_Verify(t *testing.T) {
+	testCases := []struct {
+		name string
+		// lua 脚本的返回值
+		val any
+		err error
+
+		expected    domain.CodeVerifyResult
+		expectedErr error
+	}{
+		{name: "验证通过", val: []any{int64(0), int64(0)}, expected: domain.CodeVerifyResult{Status: domain.CodeVerifyOK}},
+		{name: "输错次数用完", val: []any{int64(-1), int64(0)}, expected: domain.CodeVerifyResult{Status: domain.CodeVerifyExhausted}},
+		{name: "输错了", val: []any{int64(-2), int64(2)}, expected: domain.CodeVerifyResult{Status: domain.CodeVerifyWrong, Remaining: 2}},
+		{name: "没有发送过", val: []any{int64(-3), int64(0)}, expected: domain.CodeVerifyResult{Status: domain.CodeVerifyNotSent}},
+		{name: "已经用过了", val: []any{int64(-4), int64(0)}, expected: domain.CodeVerifyResult{Status: domain.CodeVerifyUsed}},
+		{name: "过期了", val: []any{int64(-5), int64(0)}, expected: domain.CodeVerifyResult{Status: domain.CodeVerifyExpired}},
+		{name: "未知返回值", val: []any{int64(-6), int64(0)}, expectedErr: ErrUnknownForCode},
+		{name: "Redis 错误", err: errors.New("mock error"), expectedErr: errors.New("mock error")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			res := redis.NewCmd(context.Background())
+			res.SetVal(tc.val)
+			res.SetErr(tc.err)
+			cmd.EXPECT().EvalSha(gomock.Any(), verifyCodeScript.Hash(), []string{"phone_code:login:152"}, []any{codeHash}).
+				Return(res)
+			r, err := NewCodeCache(cmd, codeSecret).Verify(context.Background(), "login", "152", "123456")
 			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expected, r)
 		})
 	}
 }
+
+func TestRedisCodeCache_hash(t *testing.T) {
+	c := NewCodeCacheGoBestPractice(nil, codeSecret)
+	// 不会存明文
+	assert.NotContains(t, codeHash, "123456")
+	assert.Len(t, codeHash, 64)
+	// 不同手机号码、不同密钥算出来的都不一样
+	assert.NotEqual(t, codeHash, c.hash("phone_code:login:153", "123456"))
+	assert.NotEqual(t, codeHash, NewCodeCacheGoBestPractice(nil, []byte("another secret")).hash("phone_code:login:152", "123456"))
+	assert.Equal(t, codeHash, c.hash("phone_code:login:152", "123456"))
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"geektime/webook/internal/domain"
+)
+
+// FallbackCodeCache 优先用 primary（一般是 Redis），primary 不可用的时候降级到 fallback（一般是本地缓存），
+// 短信登录降级而不是直接失败。
+// 降级期间发出去的验证码只存在当前实例上，请求落到别的实例或者 Redis 恢复之后会校验不通过，用户重新发送就可以
+type FallbackCodeCache struct {
+	primary  CodeCache
+	fallback CodeCache
+}
+
+func NewFallbackCodeCache(primary, fallback CodeCache) CodeCache {
+	return &FallbackCodeCache{
+		primary:  primary,
+		fallback: fallback,
+	}
+}
+
+func (c *FallbackCodeCache) Set(ctx context.Context, biz, phone, code string, policy domain.CodePolicy) error {
+	err := c.primary.Set(ctx, biz, phone, code, policy)
+	if c.unavailable(err) {
+		log.Println("验证码缓存不可用，降级到本地缓存", err)
+		return c.fallback.Set(ctx, biz, phone, code, policy)
+	}
+	return err
+}
+
+func (c *FallbackCodeCache) Verify(ctx context.Context, biz, phone, inputCode string) (domain.CodeVerifyResult, error) {
+	res, err := c.primary.Verify(ctx, biz, phone, inputCode)
+	if c.unavailable(err) {
+		log.Println("验证码缓存不可用，降级到本地缓存", err)
+		return c.fallback.Verify(ctx, biz, phone, inputCode)
+	}
+	return res, err
+}
+
+// unavailable 业务上的错误不降级；请求被取消或者超时了也不降级，
+// 不然调用方已经放弃了，验证码还是写进了本地缓存，Redis 那边永远看不到。
+// 剩下的都当成 primary 不可用
+func (c *FallbackCodeCache) unavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	return !errors.Is(err, ErrCodeSendTooMany) &&
+		!errors.Is(err, ErrUnknownForCode) &&
+		!errors.Is(err, errCodeNoExpiration) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
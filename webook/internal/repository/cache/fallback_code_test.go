@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"geektime/webook/internal/domain"
+	cachemocks "geektime/webook/internal/repository/cache/mocks"
+)
+
+func TestFallbackCodeCache_Set(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (CodeCache, CodeCache)
+
+		expectedErr error
+	}{
+		{
+			name: "Redis 正常",
+			mock: func(ctrl *gomock.Controller) (CodeCache, CodeCache) {
+				primary := cachemocks.NewMockCodeCache(ctrl)
+				primary.EXPECT().Set(gomock.Any(), "login", "152", "123456", gomock.Any()).Return(nil)
+				return primary, cachemocks.NewMockCodeCache(ctrl)
+			},
+		},
+		{
+			name: "发送太频繁不降级",
+			mock: func(ctrl *gomock.Controller) (CodeCache, CodeCache) {
+				primary := cachemocks.NewMockCodeCache(ctrl)
+				primary.EXPECT().Set(gomock.Any(), "login", "152", "123456", gomock.Any()).Return(ErrCodeSendTooMany)
+				return primary, cachemocks.NewMockCodeCache(ctrl)
+			},
+			expectedErr: ErrCodeSendTooMany,
+		},
+		{
+			name: "请求被取消不降级",
+			mock: func(ctrl *gomock.Controller) (CodeCache, CodeCache) {
+				primary := cachemocks.NewMockCodeCache(ctrl)
+				primary.EXPECT().Set(gomock.Any(), "login", "152", "123456", gomock.Any()).Return(context.Canceled)
+				return primary, cachemocks.NewMockCodeCache(ctrl)
+			},
+			expectedErr: context.Canceled,
+		},
+		{
+			name: "Redis 不可用，降级",
+			mock: func(ctrl *gomock.Controller) (CodeCache, CodeCache) {
+				primary := cachemocks.NewMockCodeCache(ctrl)
+				primary.EXPECT().Set(gomock.Any(), "login", "152", "123456", gomock.Any()).
+					Return(errors.New("dial tcp: connection refused"))
+				fallback := cachemocks.NewMockCodeCache(ctrl)
+				fallback.EXPECT().Set(gomock.Any(), "login", "152", "123456", gomock.Any()).Return(nil)
+				return primary, fallback
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			c := NewFallbackCodeCache(tc.mock(ctrl))
+			err := c.Set(context.Background(), "login", "152", "123456", domain.DefaultCodePolicy)
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func TestFallbackCodeCache_Verify(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (CodeCache, CodeCache)
+
+		expected    domain.CodeVerifyResult
+		expectedErr error
+	}{
+		{
+			name: "Redis 正常",
+			mock: func(ctrl *gomock.Controller) (CodeCache, CodeCache) {
+				primary := cachemocks.NewMockCodeCache(ctrl)
+				primary.EXPECT().Verify(gomock.Any(), "login", "152", "123456").
+					Return(domain.CodeVerifyResult{Status: domain.CodeVerifyOK}, nil)
+				return primary, cachemocks.NewMockCodeCache(ctrl)
+			},
+			expected: domain.CodeVerifyResult{Status: domain.CodeVerifyOK},
+		},
+		{
+			name: "未知错误不降级",
+			mock: func(ctrl *gomock.Controller) (CodeCache, CodeCache) {
+				primary := cachemocks.NewMockCodeCache(ctrl)
+				primary.EXPECT().Verify(gomock.Any(), "login", "152", "123456").
+					Return(domain.CodeVerifyResult{}, ErrUnknownForCode)
+				return primary, cachemocks.NewMockCodeCache(ctrl)
+			},
+			expected:    domain.CodeVerifyResult{},
+			expectedErr: ErrUnknownForCode,
+		},
+		{
+			name: "请求超时不降级",
+			mock: func(ctrl *gomock.Controller) (CodeCache, CodeCache) {
+				primary := cachemocks.NewMockCodeCache(ctrl)
+				primary.EXPECT().Verify(gomock.Any(), "login", "152", "123456").
+					Return(domain.CodeVerifyResult{}, context.DeadlineExceeded)
+				return primary, cachemocks.NewMockCodeCache(ctrl)
+			},
+			expected:    domain.CodeVerifyResult{},
+			expectedErr: context.DeadlineExceeded,
+		},
+		{
+			name: "Redis 不可用，降级",
+			mock: func(ctrl *gomock.Controller) (CodeCache, CodeCache) {
+				primary := cachemocks.NewMockCodeCache(ctrl)
+				primary.EXPECT().Verify(gomock.Any(), "login", "152", "123456").
+					Return(domain.CodeVerifyResult{}, errors.New("i/o timeout"))
+				fallback := cachemocks.NewMockCodeCache(ctrl)
+				fallback.EXPECT().Verify(gomock.Any(), "login", "152", "123456").
+					Return(domain.CodeVerifyResult{Status: domain.CodeVerifyWrong, Remaining: 2}, nil)
+				return primary, fallback
+			},
+			expected: domain.CodeVerifyResult{Status: domain.CodeVerifyWrong, Remaining: 2},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			c := NewFallbackCodeCache(tc.mock(ctrl))
+			res, err := c.Verify(context.Background(), "login", "152", "123456")
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expected, res)
+		})
+	}
+}
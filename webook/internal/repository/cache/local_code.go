@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"context"
+	"crypto/subtle"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+
+	"geektime/webook/internal/domain"
+)
+
+// LocalCodeCache 本地内存实现，语义和 RedisCodeCache 一样：
+// 重发间隔内不能重发，验证次数用完或者验证通过之后就不能再用了。
+// 只适合单实例部署和测试，多个实例之间不共享验证码
+type LocalCodeCache struct {
+	// 满了之后淘汰最久没用的，发送记录过了保留时间自动删掉，和 Redis 里面的 cntKey 一样。
+	// 验证码的有效期每个业务不一样，放在 localCode 里面
+	cache *expirable.LRU[string, *localCode]
+	// 检查再修改要在一个锁里面完成，相当于 lua 脚本的原子性
+	lock sync.Mutex
+	now  func() time.Time
+}
+
+type localCode struct {
+	code string
+	// 还可以验证几次，-1 表示已经用过了
+	cnt      int
+	sendTime time.Time
+	expireAt time.Time
+}
+
+// NewLocalCodeCache 发送记录保留 codeRetention，验证码的有效期不能比它长
+func NewLocalCodeCache(capacity int) CodeCache {
+	return newLocalCodeCache(capacity, codeRetention)
+}
+
+func newLocalCodeCache(capacity int, retention time.Duration) *LocalCodeCache {
+	return &LocalCodeCache{
+		cache: expirable.NewLRU[string, *localCode](capacity, nil, retention),
+		now:   time.Now,
+	}
+}
+
+func (c *LocalCodeCache) Set(ctx context.Context, biz, phone, code string, policy domain.CodePolicy) error {
+	key := c.key(biz, phone)
+	now := c.now()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	item, ok := c.cache.Get(key)
+	if ok && now.Before(item.expireAt) && now.Sub(item.sendTime) < policy.ResendInterval {
+		return ErrCodeSendTooMany
+	}
+	c.cache.Add(key, &localCode{
+		code:     code,
+		cnt:      policy.MaxAttempts,
+		sendTime: now,
+		expireAt: now.Add(policy.TTL),
+	})
+	return nil
+}
+
+func (c *LocalCodeCache) Verify(ctx context.Context, biz, phone, inputCode string) (domain.CodeVerifyResult, error) {
+	key := c.key(biz, phone)
+	now := c.now()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	item, ok := c.cache.Get(key)
+	switch {
+	case !ok:
+		return domain.CodeVerifyResult{Status: domain.CodeVerifyNotSent}, nil
+	case item.cnt == -1:
+		return domain.CodeVerifyResult{Status: domain.CodeVerifyUsed}, nil
+	case !now.Before(item.expireAt):
+		return domain.CodeVerifyResult{Status: domain.CodeVerifyExpired}, nil
+	case item.cnt <= 0:
+		return domain.CodeVerifyResult{Status: domain.CodeVerifyExhausted}, nil
+	case subtle.ConstantTimeCompare([]byte(item.code), []byte(inputCode)) == 1:
+		// 用完，不能再用了
+		item.cnt = -1
+		return domain.CodeVerifyResult{Status: domain.CodeVerifyOK}, nil
+	default:
+		item.cnt--
+		return domain.CodeVerifyResult{Status: domain.CodeVerifyWrong, Remaining: item.cnt}, nil
+	}
+}
+
+func (c *LocalCodeCache) key(biz, phone string) string {
+	return biz + ":" + phone
+}
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"geektime/webook/internal/domain"
+)
+
+func TestLocalCodeCache(t *testing.T) {
+	policy := domain.CodePolicy{TTL: time.Minute * 10, ResendInterval: time.Minute, MaxAttempts: 3}
+	verify := func(t *testing.T, c *LocalCodeCache, biz, phone, code string) domain.CodeVerifyResult {
+		res, err := c.Verify(context.Background(), biz, phone, code)
+		require.NoError(t, err)
+		return res
+	}
+	testCases := []struct {
+		name string
+		// 按顺序执行，now 是相对第一次发送的时间
+		steps func(t *testing.T, c *LocalCodeCache, now *time.Time)
+	}{
+		{
+			name: "发送之后验证通过，只能用一次",
+			steps: func(t *testing.T, c *LocalCodeCache, now *time.Time) {
+				require.NoError(t, c.Set(context.Background(), "login", "152", "123456", policy))
+				assert.Equal(t, domain.CodeVerifyResult{Status: domain.CodeVerifyOK}, verify(t, c, "login", "152", "123456"))
+				assert.Equal(t, domain.CodeVerifyResult{Status: domain.CodeVerifyUsed}, verify(t, c, "login", "152", "123456"))
+			},
+		},
+		{
+			name: "重发间隔内不能重发",
+			steps: func(t *testing.T, c *LocalCodeCache, now *time.Time) {
+				require.NoError(t, c.Set(context.Background(), "login", "152", "123456", policy))
+				*now = now.Add(time.Second * 30)
+				assert.Equal(t, ErrCodeSendTooMany, c.Set(context.Background(), "login", "152", "654321", policy))
+				// 过了间隔可以重发，旧的验证码失效
+				*now = now.Add(time.Second * 31)
+				require.NoError(t, c.Set(context.Background(), "login", "152", "654321", policy))
+				assert.Equal(t, domain.CodeVerifyWrong, verify(t, c, "login", "152", "123456").Status)
+				assert.Equal(t, domain.CodeVerifyOK, verify(t, c, "login", "152", "654321").Status)
+			},
+		},
+		{
+			name: "不同业务互不影响",
+			steps: func(t *testing.T, c *LocalCodeCache, now *time.Time) {
+				require.NoError(t, c.Set(context.Background(), "login", "152", "123456", policy))
+				require.NoError(t, c.Set(context.Background(), "reset", "152", "654321", policy))
+				assert.Equal(t, domain.CodeVerifyOK, verify(t, c, "reset", "152", "654321").Status)
+			},
+		},
+		{
+			name: "输错次数用完",
+			steps: func(t *testing.T, c *LocalCodeCache, now *time.Time) {
+				require.NoError(t, c.Set(context.Background(), "login", "152", "123456", policy))
+				for i := policy.MaxAttempts - 1; i >= 0; i-- {
+					assert.Equal(t, domain.CodeVerifyResult{Status: domain.CodeVerifyWrong, Remaining: i},
+						verify(t, c, "login", "152", "000000"))
+				}
+				assert.Equal(t, domain.CodeVerifyResult{Status: domain.CodeVerifyExhausted}, verify(t, c, "login", "152", "123456"))
+			},
+		},
+		{
+			name: "过期之后验证不通过，可以重新发送",
+			steps: func(t *testing.T, c *LocalCodeCache, now *time.Time) {
+				require.NoError(t, c.Set(context.Background(), "login", "152", "123456", policy))
+				*now = now.Add(policy.TTL)
+				assert.Equal(t, domain.CodeVerifyResult{Status: domain.CodeVerifyExpired}, verify(t, c, "login", "152", "123456"))
+				require.NoError(t, c.Set(context.Background(), "login", "152", "654321", policy))
+			},
+		},
+		{
+			name: "没有发送过",
+			steps: func(t *testing.T, c *LocalCodeCache, now *time.Time) {
+				assert.Equal(t, domain.CodeVerifyResult{Status: domain.CodeVerifyNotSent}, verify(t, c, "login", "152", "123456"))
+			},
+		},
+		{
+			name: "超出容量淘汰最久没用的",
+			steps: func(t *testing.T, c *LocalCodeCache, now *time.Time) {
+				for _, phone := range []string{"151", "152", "153"} {
+					require.NoError(t, c.Set(context.Background(), "login", phone, "123456", policy))
+				}
+				assert.Equal(t, domain.CodeVerifyNotSent, verify(t, c, "login", "151", "123456").Status)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewLocalCodeCache(2).(*LocalCodeCache)
+			now := time.Now()
+			c.now = func() time.Time { return now }
+			tc.steps(t, c, &now)
+		})
+	}
+}
+
+func TestLocalCodeCache_Retention(t *testing.T) {
+	policy := domain.CodePolicy{TTL: time.Millisecond * 20, ResendInterval: time.Millisecond * 10, MaxAttempts: 3}
+	c := newLocalCodeCache(2, time.Millisecond*100)
+	require.NoError(t, c.Set(context.Background(), "login", "152", "123456", policy))
+	time.Sleep(policy.TTL)
+	res, err := c.Verify(context.Background(), "login", "152", "123456")
+	require.NoError(t, err)
+	assert.Equal(t, domain.CodeVerifyExpired, res.Status)
+
+	// 发送记录也过期了，不用等到容量满了就会被删掉
+	assert.Eventually(t, func() bool {
+		return c.cache.Len() == 0
+	}, time.Second, time.Millisecond*10)
+	res, err = c.Verify(context.Background(), "login", "152", "123456")
+	require.NoError(t, err)
+	assert.Equal(t, domain.CodeVerifyNotSent, res.Status)
+}
@@ -2,19 +2,27 @@
 local key = KEYS[1]
 -- 使用次数，还可以验证几数，例如 code:login:13800138000:cnt
 local cntKey = key .. ":cnt"
--- 验证码，例如 123456
+-- 验证码的 HMAC，不存明文
 local val = ARGV[1]
--- 验证码有效期，例如 60
+-- 有效期，单位是秒，例如 600
+local expiration = tonumber(ARGV[2])
+-- 两次发送的最小间隔，单位是秒，例如 60
+local interval = tonumber(ARGV[3])
+-- 最多可以验证几次，例如 3
+local maxAttempts = tonumber(ARGV[4])
+-- 发送记录保留多久，单位是秒，过了有效期还能知道是过期了而不是没有发送过
+local retention = tonumber(ARGV[5])
 local ttl = tonumber(redis.call("ttl", key))
 if ttl == -1 then
     -- 如果 ttl 为 -1，说明 key 存在，但没有过期时间
     return -2
     -- 如果 ttl 为 -2，说明 key 不存在
-elseif ttl == -2 or ttl < 540 then
+    -- 已经过了 interval，例如有效期 600 秒、间隔 60 秒，ttl 小于 540 就可以重发
+elseif ttl == -2 or ttl < expiration - interval then
     redis.call("set", key, val)
-    redis.call("expire", key, 600)
-    redis.call("set", cntKey, 3)
-    redis.call("expire", cntKey, 600)
+    redis.call("expire", key, expiration)
+    redis.call("set", cntKey, maxAttempts)
+    redis.call("expire", cntKey, math.max(expiration, retention))
     -- 返回 0，表示发送成功
     return 0
 else
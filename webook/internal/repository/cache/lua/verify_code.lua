@@ -1,20 +1,41 @@
 local key = KEYS[1]
--- 用户输入的 code
+-- 用户输入的 code 的 HMAC
 local expectedCode = ARGV[1]
+-- 比较的时间和不相等的位置无关，避免按耗时猜出 HMAC
+local function constantTimeEquals(a, b)
+    if #a ~= #b then
+        return false
+    end
+    local diff = 0
+    for i = 1, #a do
+        diff = bit.bor(diff, bit.bxor(string.byte(a, i), string.byte(b, i)))
+    end
+    return diff == 0
+end
 local code = redis.call("get", key)
 local cntKey = key .. ":cnt"
+-- cntKey 比 key 活得久，用来区分过期和没有发送过
 local cnt = tonumber(redis.call("get", cntKey))
-if cnt == nil or cnt <= 0 then
+-- 返回 {状态, 剩余次数}
+if cnt == nil then
+    -- 没有发送过
+    return {-3, 0}
+elseif cnt == -1 then
+    -- 已经用过了
+    return {-4, 0}
+elseif not code then
+    -- 过期了
+    return {-5, 0}
+elseif cnt <= 0 then
     -- 说明用户一直输错
-    return -1
-elseif code == expectedCode then
+    return {-1, 0}
+elseif constantTimeEquals(code, expectedCode) then
     -- 输入正确
-    -- 用完，不能再用了
-    redis.call("set", cntKey, -1)
-    return 0
+    -- 用完，不能再用了，保留过期时间
+    redis.call("set", cntKey, -1, "KEEPTTL")
+    return {0, 0}
 else
     -- 用户手一抖输错了
     -- 可验证次数减一
-    redis.call("decr", cntKey)
-    return -2
+    return {-2, redis.call("decr", cntKey)}
 end
\ No newline at end of file
@@ -0,0 +1,69 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: webook/internal/repository/cache/code.go
+//
+// Generated by this command:
+//
+//	mockgen -source=webook/internal/repository/cache/code.go -destination=webook/internal/repository/cache/mocks/code.mock.go -package=cachemocks
+//
+// Package cachemocks is a generated GoMock package.
+package cachemocks
+
+import (
+	context "context"
+	domain "geektime/webook/internal/domain"
+	reflect "reflect"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockCodeCache is a mock of CodeCache interface.
+type MockCodeCache struct {
+	ctrl     *gomock.Controller
+	recorder *MockCodeCacheMockRecorder
+}
+
+// MockCodeCacheMockRecorder is the mock recorder for MockCodeCache.
+type MockCodeCacheMockRecorder struct {
+	mock *MockCodeCache
+}
+
+// NewMockCodeCache creates a new mock instance.
+func NewMockCodeCache(ctrl *gomock.Controller) *MockCodeCache {
+	mock := &MockCodeCache{ctrl: ctrl}
+	mock.recorder = &MockCodeCacheMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCodeCache) EXPECT() *MockCodeCacheMockRecorder {
+	return m.recorder
+}
+
+// Set mocks base method.
+func (m *MockCodeCache) Set(ctx context.Context, biz, phone, code string, policy domain.CodePolicy) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Set", ctx, biz, phone, code, policy)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Set indicates an expected call of Set.
+func (mr *MockCodeCacheMockRecorder) Set(ctx, biz, phone, code, policy any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockCodeCache)(nil).Set), ctx, biz, phone, code, policy)
+}
+
+// Verify mocks base method.
+func (m *MockCodeCache) Verify(ctx context.Context, biz, phone, inputCode string) (domain.CodeVerifyResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", ctx, biz, phone, inputCode)
+	ret0, _ := ret[0].(domain.CodeVerifyResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Verify indicates an expected call of Verify.
+func (mr *MockCodeCacheMockRecorder) Verify(ctx, biz, phone, inputCode any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockCodeCache)(nil).Verify), ctx, biz, phone, inputCode)
+}
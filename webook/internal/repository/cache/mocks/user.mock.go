@@ -81,3 +81,17 @@ func (mr *MockUserCacheMockRecorder) Set(ctx, u any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockUserCache)(nil).Set), ctx, u)
 }
+
+// SetNotExist mocks base method.
+func (m *MockUserCache) SetNotExist(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetNotExist", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetNotExist indicates an expected call of SetNotExist.
+func (mr *MockUserCacheMockRecorder) SetNotExist(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNotExist", reflect.TypeOf((*MockUserCache)(nil).SetNotExist), ctx, id)
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/redis/go-redis/v9"
+
+	"geektime/webook/internal/domain"
+)
+
+// userInvalidateChannel 删除缓存的时候往这个 channel 发用户 id，所有实例都删掉本地缓存
+const userInvalidateChannel = "user:info:invalidate"
+
+// Subscriber *redis.Client 和 *redis.ClusterClient 都实现了，redis.Cmdable 里面没有 Subscribe
+type Subscriber interface {
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+}
+
+// TwoLevelUserCache 本地 LRU 在前，Redis 在后。本地缓存只存很短的时间，
+// 修改用户信息的时候通过 Redis 的 pub/sub 通知所有实例删掉本地缓存，
+// 通知丢了（例如断线重连）最多也就是 ttl 时间内读到旧数据
+type TwoLevelUserCache struct {
+	local  *expirable.LRU[int64, domain.User]
+	remote UserCache
+	client redis.Cmdable
+}
+
+func NewTwoLevelUserCache(remote UserCache, client redis.Cmdable, capacity int, ttl time.Duration) *TwoLevelUserCache {
+	return &TwoLevelUserCache{
+		local:  expirable.NewLRU[int64, domain.User](capacity, nil, ttl),
+		remote: remote,
+		client: client,
+	}
+}
+
+func (c *TwoLevelUserCache) Get(ctx context.Context, id int64) (domain.User, error) {
+	if u, ok := c.local.Get(id); ok {
+		return u, nil
+	}
+	u, err := c.remote.Get(ctx, id)
+	if err != nil {
+		return domain.User{}, err
+	}
+	c.local.Add(id, u)
+	return u, nil
+}
+
+func (c *TwoLevelUserCache) Set(ctx context.Context, u domain.User) error {
+	if err := c.remote.Set(ctx, u); err != nil {
+		return err
+	}
+	// 和 Redis 里面存的一样，去掉密码
+	c.local.Add(u.Id, newCachedUser(u).toDomain())
+	return nil
+}
+
+func (c *TwoLevelUserCache) SetNotExist(ctx context.Context, id int64) error {
+	// 不存在的用户只放在 Redis 里面，本地不缓存，免得注册之后查不到
+	c.local.Remove(id)
+	return c.remote.SetNotExist(ctx, id)
+}
+
+func (c *TwoLevelUserCache) Delete(ctx context.Context, id int64) error {
+	c.local.Remove(id)
+	if err := c.remote.Delete(ctx, id); err != nil {
+		return err
+	}
+	if err := c.client.Publish(ctx, userInvalidateChannel, strconv.FormatInt(id, 10)).Err(); err != nil {
+		// Redis 里面已经删掉了，别的实例的本地缓存过一会儿也会过期
+		log.Println("通知删除本地用户缓存失败", id, err)
+	}
+	return nil
+}
+
+// Listen 订阅删除通知，一直到 ctx 结束。
+// 每次（重新）订阅成功都清空本地缓存，因为断开的这段时间可能漏掉了通知
+func (c *TwoLevelUserCache) Listen(ctx context.Context, sub Subscriber) error {
+	ps := sub.Subscribe(ctx, userInvalidateChannel)
+	defer ps.Close()
+	for {
+		msg, err := ps.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// 下一次 Receive 会重新连接
+			log.Println("接收删除本地用户缓存的通知失败", err)
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		c.handle(msg)
+	}
+}
+
+func (c *TwoLevelUserCache) handle(msg any) {
+	switch m := msg.(type) {
+	case *redis.Subscription:
+		if m.Kind == "subscribe" {
+			c.local.Purge()
+		}
+	case *redis.Message:
+		id, err := strconv.ParseInt(m.Payload, 10, 64)
+		if err != nil {
+			log.Println("删除本地用户缓存的通知格式不对", m.Payload)
+			return
+		}
+		c.local.Remove(id)
+	}
+}
+
+var _ UserCache = (*TwoLevelUserCache)(nil)
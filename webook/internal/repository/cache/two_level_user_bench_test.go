@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"geektime/webook/internal/domain"
+)
+
+// countingUserCache 统计有多少次 Get 落到了 Redis 上
+type countingUserCache struct {
+	UserCache
+	gets *atomic.Int64
+}
+
+func (c countingUserCache) Get(ctx context.Context, id int64) (domain.User, error) {
+	c.gets.Add(1)
+	return c.UserCache.Get(ctx, id)
+}
+
+// BenchmarkUserCache 比较只用 Redis 和本地 + Redis 两级缓存查用户信息的耗时，
+// 以及本地缓存的命中率。用户 id 按 zipf 分布，少数热门用户占了大部分访问：
+//
+//	go test -run=^$ -bench=BenchmarkUserCache ./internal/repository/cache/
+func BenchmarkUserCache(b *testing.B) {
+	client, _ := newBenchRedis(b)
+	const users = 100000
+	ctx := context.Background()
+	remote := NewUserCache(client)
+	for id := int64(1); id <= users; id++ {
+		if err := remote.Set(ctx, domain.User{Id: id, Email: strconv.FormatInt(id, 10) + "@qq.com"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		capacity int
+	}{
+		{name: "redis"},
+		{name: "two-level-1k", capacity: 1000},
+		{name: "two-level-10k", capacity: 10000},
+	}
+	for _, tc := range testCases {
+		b.Run(tc.name, func(b *testing.B) {
+			var gets atomic.Int64
+			var c UserCache = countingUserCache{UserCache: remote, gets: &gets}
+			if tc.capacity > 0 {
+				c = NewTwoLevelUserCache(c, client, tc.capacity, time.Minute)
+			}
+			zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, users-1)
+			ids := make([]int64, b.N)
+			for i := range ids {
+				ids[i] = int64(zipf.Uint64()) + 1
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for _, id := range ids {
+				if _, err := c.Get(ctx, id); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(1-float64(gets.Load())/float64(b.N), "hit-ratio")
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"geektime/webook/internal/domain"
+	cachemocks "geektime/webook/internal/repository/cache/mocks"
+	"geektime/webook/internal/repository/cache/redismocks"
+)
+
+func TestTwoLevelUserCache_Get(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) UserCache
+		// 连续查几次
+		times int
+
+		expectedUser domain.User
+		expectedErr  error
+	}{
+		{
+			name: "第二次命中本地缓存",
+			mock: func(ctrl *gomock.Controller) UserCache {
+				remote := cachemocks.NewMockUserCache(ctrl)
+				remote.EXPECT().Get(gomock.Any(), int64(1)).Return(domain.User{Id: 1, Email: "123@qq.com"}, nil)
+				return remote
+			},
+			times:        3,
+			expectedUser: domain.User{Id: 1, Email: "123@qq.com"},
+		},
+		{
+			name: "Redis 没有，本地也不缓存",
+			mock: func(ctrl *gomock.Controller) UserCache {
+				remote := cachemocks.NewMockUserCache(ctrl)
+				remote.EXPECT().Get(gomock.Any(), int64(1)).Return(domain.User{}, ErrKeyNotExist).Times(2)
+				return remote
+			},
+			times:       2,
+			expectedErr: ErrKeyNotExist,
+		},
+		{
+			name: "缓存了用户不存在",
+			mock: func(ctrl *gomock.Controller) UserCache {
+				remote := cachemocks.NewMockUserCache(ctrl)
+				remote.EXPECT().Get(gomock.Any(), int64(1)).Return(domain.User{}, ErrUserNotExist).Times(2)
+				return remote
+			},
+			times:       2,
+			expectedErr: ErrUserNotExist,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			c := NewTwoLevelUserCache(tc.mock(ctrl), nil, 10, time.Minute)
+			for i := 0; i < tc.times; i++ {
+				u, err := c.Get(context.Background(), 1)
+				assert.Equal(t, tc.expectedErr, err)
+				assert.Equal(t, tc.expectedUser, u)
+			}
+		})
+	}
+}
+
+func TestTwoLevelUserCache_Expire(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	remote := cachemocks.NewMockUserCache(ctrl)
+	remote.EXPECT().Set(gomock.Any(), domain.User{Id: 1, Password: "hash"}).Return(nil)
+	// 本地缓存过期之后再查 Redis
+	remote.EXPECT().Get(gomock.Any(), int64(1)).Return(domain.User{Id: 1}, nil)
+	c := NewTwoLevelUserCache(remote, nil, 10, time.Millisecond*50)
+	require.NoError(t, c.Set(context.Background(), domain.User{Id: 1, Password: "hash"}))
+	u, err := c.Get(context.Background(), 1)
+	require.NoError(t, err)
+	// 本地缓存也不存密码
+	assert.Equal(t, domain.User{Id: 1}, u)
+	time.Sleep(time.Millisecond * 100)
+	_, err = c.Get(context.Background(), 1)
+	require.NoError(t, err)
+}
+
+func TestTwoLevelUserCache_Delete(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (UserCache, redis.Cmdable)
+
+		expectedErr error
+	}{
+		{
+			name: "删除并通知别的实例",
+			mock: func(ctrl *gomock.Controller) (UserCache, redis.Cmdable) {
+				remote := cachemocks.NewMockUserCache(ctrl)
+				remote.EXPECT().Delete(gomock.Any(), int64(1)).Return(nil)
+				remote.EXPECT().Get(gomock.Any(), int64(1)).Return(domain.User{Id: 1}, nil)
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Publish(gomock.Any(), userInvalidateChannel, "1").Return(redis.NewIntCmd(context.Background()))
+				return remote, cmd
+			},
+		},
+		{
+			name: "通知失败不影响删除",
+			mock: func(ctrl *gomock.Controller) (UserCache, redis.Cmdable) {
+				remote := cachemocks.NewMockUserCache(ctrl)
+				remote.EXPECT().Delete(gomock.Any(), int64(1)).Return(nil)
+				remote.EXPECT().Get(gomock.Any(), int64(1)).Return(domain.User{Id: 1}, nil)
+				cmd := redismocks.NewMockCmdable(ctrl)
+				res := redis.NewIntCmd(context.Background())
+				res.SetErr(errors.New("网络错误"))
+				cmd.EXPECT().Publish(gomock.Any(), userInvalidateChannel, "1").Return(res)
+				return remote, cmd
+			},
+		},
+		{
+			name: "Redis 删除失败",
+			mock: func(ctrl *gomock.Controller) (UserCache, redis.Cmdable) {
+				remote := cachemocks.NewMockUserCache(ctrl)
+				remote.EXPECT().Delete(gomock.Any(), int64(1)).Return(errors.New("网络错误"))
+				remote.EXPECT().Get(gomock.Any(), int64(1)).Return(domain.User{Id: 1}, nil)
+				return remote, redismocks.NewMockCmdable(ctrl)
+			},
+			expectedErr: errors.New("网络错误"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			remote, cmd := tc.mock(ctrl)
+			c := NewTwoLevelUserCache(remote, cmd, 10, time.Minute)
+			c.local.Add(1, domain.User{Id: 1})
+			err := c.Delete(context.Background(), 1)
+			assert.Equal(t, tc.expectedErr, err)
+			// 本地缓存一定删掉了，再查要查 Redis
+			_, err = c.Get(context.Background(), 1)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestTwoLevelUserCache_handle(t *testing.T) {
+	c := NewTwoLevelUserCache(nil, nil, 10, time.Minute)
+	c.local.Add(1, domain.User{Id: 1})
+	c.local.Add(2, domain.User{Id: 2})
+	c.local.Add(3, domain.User{Id: 3})
+
+	c.handle(&redis.Message{Channel: userInvalidateChannel, Payload: "1"})
+	assert.False(t, c.local.Contains(1))
+	assert.True(t, c.local.Contains(2))
+
+	c.handle(&redis.Message{Channel: userInvalidateChannel, Payload: "abc"})
+	assert.Equal(t, 2, c.local.Len())
+
+	// 重新订阅之后可能漏掉了通知，全部清空
+	c.handle(&redis.Subscription{Kind: "subscribe", Channel: userInvalidateChannel, Count: 1})
+	assert.Equal(t, 0, c.local.Len())
+}
+
+// TestTwoLevelUserCache_Listen 一个实例删除，另外一个实例的本地缓存也删掉了，需要本地启动 Redis
+func TestTwoLevelUserCache_Listen(t *testing.T) {
+	client, _ := newBenchRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := NewTwoLevelUserCache(NewUserCache(client), client, 10, time.Minute)
+	b := NewTwoLevelUserCache(NewUserCache(client), client, 10, time.Minute)
+	go func() {
+		_ = b.Listen(ctx, client)
+	}()
+	// 等订阅成功
+	time.Sleep(time.Millisecond * 100)
+
+	require.NoError(t, a.Set(ctx, domain.User{Id: 10001}))
+	_, err := b.Get(ctx, 10001)
+	require.NoError(t, err)
+	require.True(t, b.local.Contains(10001))
+
+	require.NoError(t, a.Delete(ctx, 10001))
+	assert.Eventually(t, func() bool {
+		return !b.local.Contains(10001)
+	}, time.Second, time.Millisecond*10)
+}
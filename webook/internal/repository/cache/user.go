@@ -2,8 +2,9 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -11,23 +12,35 @@ import (
 	"geektime/webook/internal/domain"
 )
 
-var ErrKeyNotExist = redis.Nil
+var (
+	ErrKeyNotExist = redis.Nil
+	// ErrUserNotExist 缓存了“用户不存在”，不用再查数据库了
+	ErrUserNotExist = errors.New("缓存：用户不存在")
+)
 
 type UserCache interface {
 	Get(ctx context.Context, id int64) (domain.User, error)
 	Set(ctx context.Context, u domain.User) error
+	// SetNotExist 缓存“用户不存在”，防止用不存在的 id 打穿到数据库
+	SetNotExist(ctx context.Context, id int64) error
 	Delete(ctx context.Context, id int64) error
 }
 
 type RedisUserCache struct {
 	client     redis.Cmdable
 	expiration time.Duration
+	// 不存在的用户只缓存很短的时间，避免用户注册之后还一直查不到
+	notExistExpiration time.Duration
+	// 过期时间随机加上 [0, expiration * jitter)，避免一批 key 同时过期
+	jitter float64
 }
 
 func NewUserCache(client redis.Cmdable) UserCache {
 	return &RedisUserCache{
-		client:     client,
-		expiration: time.Minute * 15,
+		client:             client,
+		expiration:         time.Minute * 15,
+		notExistExpiration: time.Minute,
+		jitter:             0.2,
 	}
 }
 
@@ -40,17 +53,33 @@ func (cache *RedisUserCache) Get(ctx context.Context, id int64) (domain.User, er
 	if err != nil {
 		return domain.User{}, err
 	}
-	var u domain.User
-	err = json.Unmarshal(val, &u)
-	return u, err
+	// 正常的用户序列化之后不会是空的，空的就是 SetNotExist 设置的
+	if len(val) == 0 {
+		return domain.User{}, ErrUserNotExist
+	}
+	u, err := unmarshalCachedUser(val)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return u.toDomain(), nil
 }
 
+// Set 存的是 cachedUser，不会把密码写到 Redis 里面
 func (cache *RedisUserCache) Set(ctx context.Context, u domain.User) error {
-	data, err := json.Marshal(u)
-	if err != nil {
-		return err
+	data := newCachedUser(u).marshal()
+	return cache.client.Set(ctx, cache.key(u.Id), data, cache.ttl(cache.expiration)).Err()
+}
+
+func (cache *RedisUserCache) SetNotExist(ctx context.Context, id int64) error {
+	return cache.client.Set(ctx, cache.key(id), "", cache.ttl(cache.notExistExpiration)).Err()
+}
+
+func (cache *RedisUserCache) ttl(base time.Duration) time.Duration {
+	max := int64(float64(base) * cache.jitter)
+	if max <= 0 {
+		return base
 	}
-	return cache.client.Set(ctx, cache.key(u.Id), data, cache.expiration).Err()
+	return base + time.Duration(rand.Int63n(max))
 }
 
 func (cache *RedisUserCache) key(id int64) string {
@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"geektime/webook/internal/domain"
+)
+
+// userSchemaVersion 缓存格式的版本，放在第一个字节。
+// 改了 cachedUser 的字段或者编码方式就要加一，旧版本的数据当作没命中，
+// 从数据库重新查一次就覆盖掉了
+const userSchemaVersion byte = 1
+
+var errCorruptUser = errors.New("缓存：用户数据格式错误")
+
+// cachedUser 缓存里面的用户。故意没有密码字段，
+// 密码的哈希只应该在数据库里面，登录的时候也是直接查数据库
+type cachedUser struct {
+	Id       int64
+	Email    string
+	Nickname string
+	Phone    string
+	AboutMe  string
+	Ctime    time.Time
+	Birthday time.Time
+}
+
+func newCachedUser(u domain.User) cachedUser {
+	return cachedUser{
+		Id:       u.Id,
+		Email:    u.Email,
+		Nickname: u.Nickname,
+		Phone:    u.Phone,
+		AboutMe:  u.AboutMe,
+		Ctime:    u.Ctime,
+		Birthday: u.Birthday,
+	}
+}
+
+func (u cachedUser) toDomain() domain.User {
+	return domain.User{
+		Id:       u.Id,
+		Email:    u.Email,
+		Nickname: u.Nickname,
+		Phone:    u.Phone,
+		AboutMe:  u.AboutMe,
+		Ctime:    u.Ctime,
+		Birthday: u.Birthday,
+	}
+}
+
+// marshal 版本号 + varint 编码的 id 和时间（毫秒）+ 长度前缀的字符串
+func (u cachedUser) marshal() []byte {
+	buf := make([]byte, 0, 1+binary.MaxVarintLen64*3+
+		binary.MaxVarintLen32*4+len(u.Email)+len(u.Nickname)+len(u.Phone)+len(u.AboutMe))
+	buf = append(buf, userSchemaVersion)
+	buf = binary.AppendVarint(buf, u.Id)
+	for _, s := range []string{u.Email, u.Nickname, u.Phone, u.AboutMe} {
+		buf = binary.AppendUvarint(buf, uint64(len(s)))
+		buf = append(buf, s...)
+	}
+	buf = binary.AppendVarint(buf, unixMilli(u.Ctime))
+	buf = binary.AppendVarint(buf, unixMilli(u.Birthday))
+	return buf
+}
+
+// unmarshalCachedUser 版本不对的时候返回 ErrKeyNotExist，和没命中一样处理
+func unmarshalCachedUser(data []byte) (cachedUser, error) {
+	if len(data) == 0 || data[0] != userSchemaVersion {
+		return cachedUser{}, ErrKeyNotExist
+	}
+	d := userDecoder{data: data[1:]}
+	u := cachedUser{Id: d.varint()}
+	u.Email = d.string()
+	u.Nickname = d.string()
+	u.Phone = d.string()
+	u.AboutMe = d.string()
+	u.Ctime = fromUnixMilli(d.varint())
+	u.Birthday = fromUnixMilli(d.varint())
+	if d.err != nil || len(d.data) != 0 {
+		return cachedUser{}, errCorruptUser
+	}
+	return u, nil
+}
+
+// userDecoder 出错之后后面的读取都不做了，最后检查一次 err 就可以
+type userDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *userDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = errCorruptUser
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *userDecoder) string() string {
+	if d.err != nil {
+		return ""
+	}
+	l, n := binary.Uvarint(d.data)
+	if n <= 0 || uint64(len(d.data)-n) < l {
+		d.err = errCorruptUser
+		return ""
+	}
+	s := string(d.data[n : n+int(l)])
+	d.data = d.data[n+int(l):]
+	return s
+}
+
+// unixMilli 零值编码成 0，不然解码回来是一个很小的负数对应的时间，和零值不相等
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromUnixMilli(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
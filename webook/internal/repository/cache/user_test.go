@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"geektime/webook/internal/domain"
+	"geektime/webook/internal/repository/cache/redismocks"
+)
+
+func TestRedisUserCache_Get(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+
+		expectedUser domain.User
+		expectedErr  error
+	}{
+		{
+			name: "缓存命中",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				res := redis.NewStringCmd(context.Background())
+				res.SetVal(string(newCachedUser(domain.User{Id: 1, Email: "123@qq.com"}).marshal()))
+				cmd.EXPECT().Get(gomock.Any(), "user:info:1").Return(res)
+				return cmd
+			},
+			expectedUser: domain.User{Id: 1, Email: "123@qq.com"},
+		},
+		{
+			name: "以前的 JSON 格式当作没命中",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				res := redis.NewStringCmd(context.Background())
+				res.SetVal(`{"Id":1,"Email":"123@qq.com","Password":"$2a$10$aQc9gokDobCC5ci4QlHVVO"}`)
+				cmd.EXPECT().Get(gomock.Any(), "user:info:1").Return(res)
+				return cmd
+			},
+			expectedErr: ErrKeyNotExist,
+		},
+		{
+			name: "版本不对当作没命中",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				data := newCachedUser(domain.User{Id: 1, Email: "123@qq.com"}).marshal()
+				data[0] = userSchemaVersion + 1
+				res := redis.NewStringCmd(context.Background())
+				res.SetVal(string(data))
+				cmd.EXPECT().Get(gomock.Any(), "user:info:1").Return(res)
+				return cmd
+			},
+			expectedErr: ErrKeyNotExist,
+		},
+		{
+			name: "数据不完整",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				data := newCachedUser(domain.User{Id: 1, Email: "123@qq.com"}).marshal()
+				res := redis.NewStringCmd(context.Background())
+				res.SetVal(string(data[:len(data)-3]))
+				cmd.EXPECT().Get(gomock.Any(), "user:info:1").Return(res)
+				return cmd
+			},
+			expectedErr: errCorruptUser,
+		},
+		{
+			name: "缓存了用户不存在",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				res := redis.NewStringCmd(context.Background())
+				res.SetVal("")
+				cmd.EXPECT().Get(gomock.Any(), "user:info:1").Return(res)
+				return cmd
+			},
+			expectedErr: ErrUserNotExist,
+		},
+		{
+			name: "缓存未命中",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				res := redis.NewStringCmd(context.Background())
+				res.SetErr(redis.Nil)
+				cmd.EXPECT().Get(gomock.Any(), "user:info:1").Return(res)
+				return cmd
+			},
+			expectedErr: ErrKeyNotExist,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			u, err := NewUserCache(tc.mock(ctrl)).Get(context.Background(), 1)
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expectedUser, u)
+		})
+	}
+}
+
+func TestRedisUserCache_Set(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	const hash = "$2a$10$aQc9gokDobCC5ci4QlHVVOuDKZu7vFsak9w3y/7kwYiLvRbO7w90e"
+	u := domain.User{
+		Id:       1,
+		Email:    "123@qq.com",
+		Nickname: "大明",
+		Password: hash,
+		Phone:    "+8615212345678",
+		AboutMe:  "hello",
+		Ctime:    time.UnixMilli(1697500800000),
+		Birthday: time.UnixMilli(946656000000),
+	}
+	var written []byte
+	cmd := redismocks.NewMockCmdable(ctrl)
+	cmd.EXPECT().Set(gomock.Any(), "user:info:1", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, val any, expiration time.Duration) *redis.StatusCmd {
+			written = val.([]byte)
+			return redis.NewStatusCmd(context.Background())
+		})
+	require.NoError(t, NewUserCache(cmd).Set(context.Background(), u))
+
+	// 密码的哈希不管以什么形式都不能写进去
+	assert.NotContains(t, string(written), hash)
+	assert.NotContains(t, string(written), "Password")
+	assert.Equal(t, userSchemaVersion, written[0])
+	cu, err := unmarshalCachedUser(written)
+	require.NoError(t, err)
+	expected := u
+	expected.Password = ""
+	assert.Equal(t, expected, cu.toDomain())
+}
+
+// TestCachedUser_NoSecret 以后给 cachedUser 加字段的时候，不要把敏感字段加进来
+func TestCachedUser_NoSecret(t *testing.T) {
+	typ := reflect.TypeOf(cachedUser{})
+	for i := 0; i < typ.NumField(); i++ {
+		name := strings.ToLower(typ.Field(i).Name)
+		for _, secret := range []string{"password", "secret", "token", "hash"} {
+			assert.NotContains(t, name, secret)
+		}
+	}
+}
+
+func TestCachedUser_marshal(t *testing.T) {
+	testCases := []struct {
+		name string
+		u    domain.User
+	}{
+		{
+			name: "零值",
+		},
+		{
+			name: "所有字段",
+			u: domain.User{
+				Id:       1<<62 + 1,
+				Email:    "123@qq.com",
+				Nickname: "大明",
+				Phone:    "+8615212345678",
+				AboutMe:  strings.Repeat("很长的介绍", 100),
+				Ctime:    time.UnixMilli(1697500800000),
+				Birthday: time.UnixMilli(-946656000000),
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := unmarshalCachedUser(newCachedUser(tc.u).marshal())
+			require.NoError(t, err)
+			assert.Equal(t, tc.u, u.toDomain())
+		})
+	}
+}
+
+func TestRedisUserCache_SetNotExist(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cmd := redismocks.NewMockCmdable(ctrl)
+	res := redis.NewStatusCmd(context.Background())
+	cmd.EXPECT().Set(gomock.Any(), "user:info:1", "", gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, val any, expiration time.Duration) *redis.StatusCmd {
+			// 不存在的用户只缓存一分钟左右
+			assert.GreaterOrEqual(t, expiration, time.Minute)
+			assert.Less(t, expiration, time.Minute*2)
+			return res
+		})
+	assert.NoError(t, NewUserCache(cmd).SetNotExist(context.Background(), 1))
+}
+
+func TestRedisUserCache_ttl(t *testing.T) {
+	cache := NewUserCache(nil).(*RedisUserCache)
+	seen := make(map[time.Duration]struct{})
+	for i := 0; i < 100; i++ {
+		ttl := cache.ttl(time.Minute * 15)
+		assert.GreaterOrEqual(t, ttl, time.Minute*15)
+		assert.Less(t, ttl, time.Minute*18)
+		seen[ttl] = struct{}{}
+	}
+	// 过期时间是打散的
+	assert.Greater(t, len(seen), 1)
+}
@@ -3,17 +3,17 @@ package repository
 import (
 	"context"
 
+	"geektime/webook/internal/domain"
 	"geektime/webook/internal/repository/cache"
 )
 
 var (
-	ErrSendTooMany            = cache.ErrCodeSendTooMany
-	ErrCodeVerifyTooManyTimes = cache.ErrCodeVerifyTooManyTimes
+	ErrSendTooMany = cache.ErrCodeSendTooMany
 )
 
 type CodeRepository interface {
-	Store(ctx context.Context, biz, phone, code string) error
-	Verify(ctx context.Context, biz, phone, inputCode string) (bool, error)
+	Store(ctx context.Context, biz, phone, code string, policy domain.CodePolicy) error
+	Verify(ctx context.Context, biz, phone, inputCode string) (domain.CodeVerifyResult, error)
 }
 
 type CacheCodeRepository struct {
@@ -26,10 +26,10 @@ func NewCodeRepository(c cache.CodeCache) CodeRepository {
 	}
 }
 
-func (repo *CacheCodeRepository) Store(ctx context.Context, biz, phone, code string) error {
-	return repo.cache.Set(ctx, biz, phone, code)
+func (repo *CacheCodeRepository) Store(ctx context.Context, biz, phone, code string, policy domain.CodePolicy) error {
+	return repo.cache.Set(ctx, biz, phone, code, policy)
 }
 
-func (repo *CacheCodeRepository) Verify(ctx context.Context, biz, phone, inputCode string) (bool, error) {
+func (repo *CacheCodeRepository) Verify(ctx context.Context, biz, phone, inputCode string) (domain.CodeVerifyResult, error) {
 	return repo.cache.Verify(ctx, biz, phone, inputCode)
 }
@@ -0,0 +1,64 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// MigratePhoneResult 迁移结果，Invalid 和 Conflicts 需要人工处理
+type MigratePhoneResult struct {
+	Updated int
+	// 解析不了的号码
+	Invalid []int64
+	// 统一格式之后和别的用户重复了
+	Conflicts []int64
+}
+
+// MigratePhone 按 id 分批把 users.phone 统一成 normalize 的格式，
+// 已经是统一格式的不会更新，所以可以重复执行
+func MigratePhone(ctx context.Context, db *gorm.DB,
+	normalize func(string) (string, error), batchSize int) (MigratePhoneResult, error) {
+	var res MigratePhoneResult
+	var lastId int64
+	for {
+		var users []User
+		err := db.WithContext(ctx).Select("id", "phone").
+			Where("id > ? AND phone IS NOT NULL", lastId).
+			Order("id").Limit(batchSize).Find(&users).Error
+		if err != nil {
+			return res, err
+		}
+		for _, u := range users {
+			lastId = u.Id
+			normalized, err := normalize(u.Phone.String)
+			if err != nil {
+				res.Invalid = append(res.Invalid, u.Id)
+				continue
+			}
+			if normalized == u.Phone.String {
+				continue
+			}
+			err = db.WithContext(ctx).Model(&User{}).Where("id = ?", u.Id).
+				Updates(map[string]any{
+					"phone": normalized,
+					"utime": time.Now().UnixMilli(),
+				}).Error
+			var mysqlErr *mysql.MySQLError
+			if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+				res.Conflicts = append(res.Conflicts, u.Id)
+				continue
+			}
+			if err != nil {
+				return res, err
+			}
+			res.Updated++
+		}
+		if len(users) < batchSize {
+			return res, nil
+		}
+	}
+}
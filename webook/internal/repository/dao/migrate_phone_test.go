@@ -0,0 +1,54 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gormMysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestMigratePhone(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	rows := sqlmock.NewRows([]string{"id", "phone"}).
+		AddRow(1, "15212345678").
+		AddRow(2, "+8615212345679").
+		AddRow(3, "abc").
+		AddRow(4, "15212345679")
+	mock.ExpectQuery("SELECT `id`,`phone` FROM `users` .*").WillReturnRows(rows)
+	// 已经是 E.164 和解析不了的都不会更新
+	mock.ExpectExec("UPDATE `users` .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `users` .*").WillReturnError(&mysql.MySQLError{Number: 1062})
+
+	db, err := gorm.Open(gormMysql.New(gormMysql.Config{
+		Conn:                      mockDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+	})
+	require.NoError(t, err)
+	normalize := func(p string) (string, error) {
+		switch p {
+		case "15212345678":
+			return "+8615212345678", nil
+		case "15212345679", "+8615212345679":
+			return "+8615212345679", nil
+		}
+		return "", errors.New("格式错误")
+	}
+	res, err := MigratePhone(context.Background(), db, normalize, 10)
+	require.NoError(t, err)
+	assert.Equal(t, MigratePhoneResult{
+		Updated:   1,
+		Invalid:   []int64{3},
+		Conflicts: []int64{4},
+	}, res)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
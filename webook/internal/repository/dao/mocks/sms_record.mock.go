@@ -0,0 +1,83 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: webook/internal/repository/dao/sms_record.go
+//
+// Generated by this command:
+//
+//	mockgen -source=webook/internal/repository/dao/sms_record.go -destination=webook/internal/repository/dao/mocks/sms_record.mock.go -package=daomocks
+//
+// Package daomocks is a generated GoMock package.
+package daomocks
+
+import (
+	context "context"
+	dao "geektime/webook/internal/repository/dao"
+	reflect "reflect"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockSMSRecordDAO is a mock of SMSRecordDAO interface.
+type MockSMSRecordDAO struct {
+	ctrl     *gomock.Controller
+	recorder *MockSMSRecordDAOMockRecorder
+}
+
+// MockSMSRecordDAOMockRecorder is the mock recorder for MockSMSRecordDAO.
+type MockSMSRecordDAOMockRecorder struct {
+	mock *MockSMSRecordDAO
+}
+
+// NewMockSMSRecordDAO creates a new mock instance.
+func NewMockSMSRecordDAO(ctrl *gomock.Controller) *MockSMSRecordDAO {
+	mock := &MockSMSRecordDAO{ctrl: ctrl}
+	mock.recorder = &MockSMSRecordDAOMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSMSRecordDAO) EXPECT() *MockSMSRecordDAOMockRecorder {
+	return m.recorder
+}
+
+// FindByPhoneHash mocks base method.
+func (m *MockSMSRecordDAO) FindByPhoneHash(ctx context.Context, phoneHash string, limit int) ([]dao.SMSRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByPhoneHash", ctx, phoneHash, limit)
+	ret0, _ := ret[0].([]dao.SMSRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByPhoneHash indicates an expected call of FindByPhoneHash.
+func (mr *MockSMSRecordDAOMockRecorder) FindByPhoneHash(ctx, phoneHash, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByPhoneHash", reflect.TypeOf((*MockSMSRecordDAO)(nil).FindByPhoneHash), ctx, phoneHash, limit)
+}
+
+// Insert mocks base method.
+func (m *MockSMSRecordDAO) Insert(ctx context.Context, rs []dao.SMSRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Insert", ctx, rs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Insert indicates an expected call of Insert.
+func (mr *MockSMSRecordDAOMockRecorder) Insert(ctx, rs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockSMSRecordDAO)(nil).Insert), ctx, rs)
+}
+
+// UpdateStatus mocks base method.
+func (m *MockSMSRecordDAO) UpdateStatus(ctx context.Context, provider, requestId string, status uint8, msg string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateStatus", ctx, provider, requestId, status, msg)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateStatus indicates an expected call of UpdateStatus.
+func (mr *MockSMSRecordDAOMockRecorder) UpdateStatus(ctx, provider, requestId, status, msg any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateStatus", reflect.TypeOf((*MockSMSRecordDAO)(nil).UpdateStatus), ctx, provider, requestId, status, msg)
+}
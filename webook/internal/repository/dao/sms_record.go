@@ -0,0 +1,70 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SMSRecord 短信发送记录，不保存完整的手机号码
+type SMSRecord struct {
+	Id       int64  `gorm:"primaryKey,autoIncrement"`
+	Provider string `gorm:"type:varchar(32);uniqueIndex:provider_request_id"`
+	// 服务商没有受理的时候没有流水号，所以用 NULL
+	RequestId *string `gorm:"type:varchar(128);uniqueIndex:provider_request_id"`
+	TplId     string  `gorm:"type:varchar(64)"`
+	// 脱敏之后的号码，用来展示
+	Phone string `gorm:"type:varchar(32)"`
+	// 号码的哈希，用来查询
+	PhoneHash string `gorm:"type:char(64);index:phone_hash_ctime"`
+	Status    uint8
+	// 耗时，毫秒数
+	Latency int64
+	Msg     string
+
+	Ctime int64 `gorm:"index:phone_hash_ctime"`
+	Utime int64
+}
+
+type SMSRecordDAO interface {
+	Insert(ctx context.Context, rs []SMSRecord) error
+	UpdateStatus(ctx context.Context, provider, requestId string, status uint8, msg string) error
+	FindByPhoneHash(ctx context.Context, phoneHash string, limit int) ([]SMSRecord, error)
+}
+
+type GORMSMSRecordDAO struct {
+	db *gorm.DB
+}
+
+func NewSMSRecordDAO(db *gorm.DB) SMSRecordDAO {
+	return &GORMSMSRecordDAO{
+		db: db,
+	}
+}
+
+func (d *GORMSMSRecordDAO) Insert(ctx context.Context, rs []SMSRecord) error {
+	now := time.Now().UnixMilli()
+	for i := range rs {
+		rs[i].Ctime = now
+		rs[i].Utime = now
+	}
+	return d.db.WithContext(ctx).Create(&rs).Error
+}
+
+func (d *GORMSMSRecordDAO) UpdateStatus(ctx context.Context, provider, requestId string, status uint8, msg string) error {
+	return d.db.WithContext(ctx).Model(&SMSRecord{}).
+		Where("provider = ? AND request_id = ?", provider, requestId).
+		Updates(map[string]any{
+			"status": status,
+			"msg":    msg,
+			"utime":  time.Now().UnixMilli(),
+		}).Error
+}
+
+func (d *GORMSMSRecordDAO) FindByPhoneHash(ctx context.Context, phoneHash string, limit int) ([]SMSRecord, error) {
+	var rs []SMSRecord
+	err := d.db.WithContext(ctx).Where("phone_hash = ?", phoneHash).
+		Order("ctime DESC").Limit(limit).Find(&rs).Error
+	return rs, err
+}
@@ -10,6 +10,7 @@ package repomocks
 
 import (
 	context "context"
+	domain "geektime/webook/internal/domain"
 	reflect "reflect"
 
 	gomock "go.uber.org/mock/gomock"
@@ -39,24 +40,24 @@ func (m *MockCodeRepository) EXPECT() *MockCodeRepositoryMockRecorder {
 }
 
 // Store mocks base method.
-func (m *MockCodeRepository) Store(ctx context.Context, biz, phone, code string) error {
+func (m *MockCodeRepository) Store(ctx context.Context, biz, phone, code string, policy domain.CodePolicy) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Store", ctx, biz, phone, code)
+	ret := m.ctrl.Call(m, "Store", ctx, biz, phone, code, policy)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Store indicates an expected call of Store.
-func (mr *MockCodeRepositoryMockRecorder) Store(ctx, biz, phone, code any) *gomock.Call {
+func (mr *MockCodeRepositoryMockRecorder) Store(ctx, biz, phone, code, policy any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Store", reflect.TypeOf((*MockCodeRepository)(nil).Store), ctx, biz, phone, code)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Store", reflect.TypeOf((*MockCodeRepository)(nil).Store), ctx, biz, phone, code, policy)
 }
 
 // Verify mocks base method.
-func (m *MockCodeRepository) Verify(ctx context.Context, biz, phone, inputCode string) (bool, error) {
+func (m *MockCodeRepository) Verify(ctx context.Context, biz, phone, inputCode string) (domain.CodeVerifyResult, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Verify", ctx, biz, phone, inputCode)
-	ret0, _ := ret[0].(bool)
+	ret0, _ := ret[0].(domain.CodeVerifyResult)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -0,0 +1,83 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: webook/internal/repository/sms_record.go
+//
+// Generated by this command:
+//
+//	mockgen -source=webook/internal/repository/sms_record.go -destination=webook/internal/repository/mocks/sms_record.mock.go -package=repomocks
+//
+// Package repomocks is a generated GoMock package.
+package repomocks
+
+import (
+	context "context"
+	domain "geektime/webook/internal/domain"
+	reflect "reflect"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockSMSRecordRepository is a mock of SMSRecordRepository interface.
+type MockSMSRecordRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockSMSRecordRepositoryMockRecorder
+}
+
+// MockSMSRecordRepositoryMockRecorder is the mock recorder for MockSMSRecordRepository.
+type MockSMSRecordRepositoryMockRecorder struct {
+	mock *MockSMSRecordRepository
+}
+
+// NewMockSMSRecordRepository creates a new mock instance.
+func NewMockSMSRecordRepository(ctrl *gomock.Controller) *MockSMSRecordRepository {
+	mock := &MockSMSRecordRepository{ctrl: ctrl}
+	mock.recorder = &MockSMSRecordRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSMSRecordRepository) EXPECT() *MockSMSRecordRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockSMSRecordRepository) Create(ctx context.Context, rs []domain.SMSRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, rs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockSMSRecordRepositoryMockRecorder) Create(ctx, rs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockSMSRecordRepository)(nil).Create), ctx, rs)
+}
+
+// FindByPhone mocks base method.
+func (m *MockSMSRecordRepository) FindByPhone(ctx context.Context, phone string, limit int) ([]domain.SMSRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByPhone", ctx, phone, limit)
+	ret0, _ := ret[0].([]domain.SMSRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByPhone indicates an expected call of FindByPhone.
+func (mr *MockSMSRecordRepositoryMockRecorder) FindByPhone(ctx, phone, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByPhone", reflect.TypeOf((*MockSMSRecordRepository)(nil).FindByPhone), ctx, phone, limit)
+}
+
+// UpdateStatus mocks base method.
+func (m *MockSMSRecordRepository) UpdateStatus(ctx context.Context, report domain.SMSReport) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateStatus", ctx, report)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateStatus indicates an expected call of UpdateStatus.
+func (mr *MockSMSRecordRepositoryMockRecorder) UpdateStatus(ctx, report any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateStatus", reflect.TypeOf((*MockSMSRecordRepository)(nil).UpdateStatus), ctx, report)
+}
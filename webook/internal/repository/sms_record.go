@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/ecodeclub/ekit/slice"
+
+	"geektime/webook/internal/domain"
+	"geektime/webook/internal/repository/dao"
+)
+
+type SMSRecordRepository interface {
+	Create(ctx context.Context, rs []domain.SMSRecord) error
+	UpdateStatus(ctx context.Context, report domain.SMSReport) error
+	// FindByPhone 最近的 limit 条记录，号码是脱敏之后的
+	FindByPhone(ctx context.Context, phone string, limit int) ([]domain.SMSRecord, error)
+}
+
+// SMSPhoneHashKey 号码摘要用的密钥，单独定义一个类型方便 wire 注入
+type SMSPhoneHashKey []byte
+
+type DBSMSRecordRepository struct {
+	dao     dao.SMSRecordDAO
+	hashKey SMSPhoneHashKey
+}
+
+func NewSMSRecordRepository(d dao.SMSRecordDAO, hashKey SMSPhoneHashKey) SMSRecordRepository {
+	return &DBSMSRecordRepository{
+		dao:     d,
+		hashKey: hashKey,
+	}
+}
+
+func (r *DBSMSRecordRepository) Create(ctx context.Context, rs []domain.SMSRecord) error {
+	return r.dao.Insert(ctx, slice.Map[domain.SMSRecord, dao.SMSRecord](rs,
+		func(idx int, src domain.SMSRecord) dao.SMSRecord {
+			return r.domainToEntity(src)
+		}))
+}
+
+func (r *DBSMSRecordRepository) UpdateStatus(ctx context.Context, report domain.SMSReport) error {
+	status := domain.SMSStatusUndelivered
+	if report.Delivered {
+		status = domain.SMSStatusDelivered
+	}
+	return r.dao.UpdateStatus(ctx, report.Provider, report.RequestId, uint8(status), report.Msg)
+}
+
+func (r *DBSMSRecordRepository) FindByPhone(ctx context.Context, phone string, limit int) ([]domain.SMSRecord, error) {
+	rs, err := r.dao.FindByPhoneHash(ctx, r.hashPhone(phone), limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.SMSRecord, domain.SMSRecord](rs, func(idx int, src dao.SMSRecord) domain.SMSRecord {
+		return r.entityToDomain(src)
+	}), nil
+}
+
+func (r *DBSMSRecordRepository) domainToEntity(rec domain.SMSRecord) dao.SMSRecord {
+	res := dao.SMSRecord{
+		Provider:  rec.Provider,
+		TplId:     rec.TplId,
+		Phone:     maskPhone(rec.Phone),
+		PhoneHash: r.hashPhone(rec.Phone),
+		Status:    uint8(rec.Status),
+		Latency:   rec.Latency.Milliseconds(),
+		Msg:       rec.Msg,
+	}
+	if rec.RequestId != "" {
+		res.RequestId = &rec.RequestId
+	}
+	return res
+}
+
+func (r *DBSMSRecordRepository) entityToDomain(rec dao.SMSRecord) domain.SMSRecord {
+	res := domain.SMSRecord{
+		Id:       rec.Id,
+		Provider: rec.Provider,
+		TplId:    rec.TplId,
+		Phone:    rec.Phone,
+		Status:   domain.SMSStatus(rec.Status),
+		Latency:  time.Duration(rec.Latency) * time.Millisecond,
+		Msg:      rec.Msg,
+		Ctime:    time.UnixMilli(rec.Ctime),
+		Utime:    time.UnixMilli(rec.Utime),
+	}
+	if rec.RequestId != nil {
+		res.RequestId = *rec.RequestId
+	}
+	return res
+}
+
+// maskPhone 只保留前三位和后四位，例如 152****5678
+func maskPhone(phone string) string {
+	if len(phone) <= 7 {
+		return "****"
+	}
+	return phone[:3] + "****" + phone[len(phone)-4:]
+}
+
+// hashPhone 手机号码的空间很小，直接 SHA-256 可以穷举出来，所以要用 HMAC
+func (r *DBSMSRecordRepository) hashPhone(phone string) string {
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(phone))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -3,11 +3,17 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"log"
+	"strconv"
 	"time"
 
+	"golang.org/x/sync/singleflight"
+
 	"geektime/webook/internal/domain"
 	"geektime/webook/internal/repository/cache"
 	"geektime/webook/internal/repository/dao"
+	"geektime/webook/pkg/phone"
 )
 
 var (
@@ -26,12 +32,24 @@ type UserRepository interface {
 type CacheUserRepository struct {
 	ud    dao.UserDAO
 	cache cache.UserCache
+	// 同一个 id 同时没命中缓存的请求，只有一个去查数据库
+	group singleflight.Group
+	// 查数据库和回写缓存都不跟着某一个请求的 ctx 走，
+	// 不然一个请求取消了，等着同一个结果的请求都会失败，回写也会失败
+	queryTimeout time.Duration
+	writeTimeout time.Duration
+	// 更新之后隔多久再删一次缓存
+	deleteDelay time.Duration
 }
 
 func NewUserRepository(ud dao.UserDAO, c cache.UserCache) UserRepository {
 	return &CacheUserRepository{
-		ud:    ud,
-		cache: c,
+		ud:           ud,
+		cache:        c,
+		queryTimeout: time.Second * 3,
+		writeTimeout: time.Second,
+		// 超过了查询和回写的超时时间，更新之前发起的查询都已经回写完了
+		deleteDelay: time.Second * 5,
 	}
 }
 
@@ -40,7 +58,24 @@ func (r *CacheUserRepository) Update(ctx context.Context, u domain.User) error {
 	if err != nil {
 		return err
 	}
-	return r.cache.Delete(ctx, u.Id)
+	if err = r.cache.Delete(ctx, u.Id); err != nil {
+		return err
+	}
+	r.delayDelete(ctx, u.Id)
+	return nil
+}
+
+// delayDelete 延迟双删。并发的 FindById 可能在更新之前就查到了旧数据，
+// 等到第一次删除之后才异步回写，缓存里面就又是旧数据了，所以过一会儿再删一次
+func (r *CacheUserRepository) delayDelete(ctx context.Context, id int64) {
+	ctx = context.WithoutCancel(ctx)
+	time.AfterFunc(r.deleteDelay, func() {
+		ctx, cancel := context.WithTimeout(ctx, r.writeTimeout)
+		defer cancel()
+		if err := r.cache.Delete(ctx, id); err != nil {
+			log.Println("延迟删除用户缓存失败", err)
+		}
+	})
 }
 
 func (r *CacheUserRepository) Create(ctx context.Context, u domain.User) error {
@@ -48,7 +83,7 @@ func (r *CacheUserRepository) Create(ctx context.Context, u domain.User) error {
 }
 
 func (r *CacheUserRepository) FindByPhone(ctx context.Context, phone string) (domain.User, error) {
-	u, err := r.ud.FindByPhone(ctx, phone)
+	u, err := r.ud.FindByPhone(ctx, r.normalizePhone(phone))
 	return r.entityToDomain(u), err
 }
 
@@ -59,28 +94,61 @@ func (r *CacheUserRepository) FindByEmail(ctx context.Context, email string) (do
 
 func (r *CacheUserRepository) FindById(ctx context.Context, id int64) (domain.User, error) {
 	u, err := r.cache.Get(ctx, id)
+	switch {
 	// 缓存命中
-	if err == nil {
+	case err == nil:
 		return u, nil
+	// 缓存了用户不存在
+	case errors.Is(err, cache.ErrUserNotExist):
+		return domain.User{}, ErrUserNotFound
+	}
+	ch := r.group.DoChan(strconv.FormatInt(id, 10), func() (any, error) {
+		return r.findById(ctx, id)
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return domain.User{}, res.Err
+		}
+		return res.Val.(domain.User), nil
+	case <-ctx.Done():
+		// 自己不等了，别的请求还可以拿到结果
+		return domain.User{}, ctx.Err()
+	}
+}
+
+// findById 查数据库，然后异步回写缓存。不存在的用户也缓存一下，防止缓存穿透
+func (r *CacheUserRepository) findById(ctx context.Context, id int64) (domain.User, error) {
+	dctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.queryTimeout)
+	defer cancel()
+	user, err := r.ud.FindById(dctx, id)
+	if errors.Is(err, ErrUserNotFound) {
+		r.writeBack(ctx, func(ctx context.Context) error {
+			return r.cache.SetNotExist(ctx, id)
+		})
+		return domain.User{}, err
 	}
-	user, err := r.ud.FindById(ctx, id)
 	// 数据库出错
 	if err != nil {
 		return domain.User{}, err
 	}
-	u = r.entityToDomain(user)
-	// 异步设置缓存
-	// go func() {
-	// 	err = r.cache.Set(ctx, u)
-	// 	if err != nil {
-	// 		// log
-	// 	}
-	// }()
+	u := r.entityToDomain(user)
+	r.writeBack(ctx, func(ctx context.Context) error {
+		return r.cache.Set(ctx, u)
+	})
+	return u, nil
+}
+
+// writeBack 异步回写缓存，用的是独立的 ctx，请求结束了也能写进去
+func (r *CacheUserRepository) writeBack(ctx context.Context, set func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.writeTimeout)
 	go func() {
-		_ = r.cache.Set(ctx, u)
+		defer cancel()
+		if err := set(ctx); err != nil {
+			// 回写失败了下次再查数据库就是了
+			log.Println("回写用户缓存失败", err)
+		}
 	}()
-
-	return u, nil
 }
 
 func (r *CacheUserRepository) domainToEntity(u domain.User) dao.User {
@@ -92,13 +160,21 @@ func (r *CacheUserRepository) domainToEntity(u domain.User) dao.User {
 		},
 		Password: u.Password,
 		Phone: sql.NullString{
-			String: u.Phone,
+			String: r.normalizePhone(u.Phone),
 			Valid:  u.Phone != "",
 		},
 		Ctime: u.Ctime.UnixMilli(),
 	}
 }
 
+// normalizePhone 库里统一存 E.164，解析不了的原样存，交给上层校验
+func (r *CacheUserRepository) normalizePhone(p string) string {
+	if normalized, err := phone.Normalize(p); err == nil {
+		return normalized
+	}
+	return p
+}
+
 func (r *CacheUserRepository) entityToDomain(u dao.User) domain.User {
 	return domain.User{
 		Id:       u.Id,
@@ -4,10 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 
 	"geektime/webook/internal/domain"
@@ -103,6 +106,34 @@ func TestCacheUserRepository_FindById(t *testing.T) {
 			expectedUser: domain.User{},
 			expectedErr:  errors.New("数据库查询失败"),
 		},
+		{
+			name: "缓存未命中，用户不存在，缓存不存在",
+			mock: func(ctrl *gomock.Controller) (dao.UserDAO, cache.UserCache) {
+				ud := daomocks.NewMockUserDAO(ctrl)
+				uc := cachemocks.NewMockUserCache(ctrl)
+				uc.EXPECT().Get(gomock.Any(), int64(1)).Return(domain.User{}, cache.ErrKeyNotExist)
+				ud.EXPECT().FindById(gomock.Any(), int64(1)).Return(dao.User{}, dao.ErrUserNotFound)
+				uc.EXPECT().SetNotExist(gomock.Any(), int64(1)).Return(nil)
+				return ud, uc
+			},
+			ctx:          context.Background(),
+			id:           1,
+			expectedUser: domain.User{},
+			expectedErr:  ErrUserNotFound,
+		},
+		{
+			name: "缓存了用户不存在，不查数据库",
+			mock: func(ctrl *gomock.Controller) (dao.UserDAO, cache.UserCache) {
+				ud := daomocks.NewMockUserDAO(ctrl)
+				uc := cachemocks.NewMockUserCache(ctrl)
+				uc.EXPECT().Get(gomock.Any(), int64(1)).Return(domain.User{}, cache.ErrUserNotExist)
+				return ud, uc
+			},
+			ctx:          context.Background(),
+			id:           1,
+			expectedUser: domain.User{},
+			expectedErr:  ErrUserNotFound,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -118,3 +149,158 @@ func TestCacheUserRepository_FindById(t *testing.T) {
 		})
 	}
 }
+
+// TestCacheUserRepository_FindById_Concurrent 同时有很多请求没命中缓存，每个 id 只查一次数据库
+func TestCacheUserRepository_FindById_Concurrent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	const ids, perId = 3, 50
+	var gets atomic.Int32
+	// 所有请求都没命中缓存之后，数据库才返回，保证这些请求是同时在等的
+	release := make(chan struct{})
+	uc := cachemocks.NewMockUserCache(ctrl)
+	uc.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, id int64) (domain.User, error) {
+		if gets.Add(1) == ids*perId {
+			go func() {
+				time.Sleep(time.Millisecond * 50)
+				close(release)
+			}()
+		}
+		return domain.User{}, cache.ErrKeyNotExist
+	}).Times(ids * perId)
+	var sets sync.WaitGroup
+	sets.Add(ids)
+	uc.EXPECT().Set(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, u domain.User) error {
+		defer sets.Done()
+		return nil
+	}).Times(ids)
+	ud := daomocks.NewMockUserDAO(ctrl)
+	for id := int64(1); id <= ids; id++ {
+		// 每个 id 只查一次
+		ud.EXPECT().FindById(gomock.Any(), id).DoAndReturn(func(ctx context.Context, id int64) (dao.User, error) {
+			<-release
+			return dao.User{Id: id}, nil
+		}).Times(1)
+	}
+
+	repo := NewUserRepository(ud, uc)
+	var wg sync.WaitGroup
+	for id := int64(1); id <= ids; id++ {
+		for i := 0; i < perId; i++ {
+			wg.Add(1)
+			go func(id int64) {
+				defer wg.Done()
+				u, err := repo.FindById(context.Background(), id)
+				assert.NoError(t, err)
+				assert.Equal(t, id, u.Id)
+			}(id)
+		}
+	}
+	wg.Wait()
+	sets.Wait()
+}
+
+// TestCacheUserRepository_FindById_Cancel 请求取消了，不影响别的请求和回写缓存
+func TestCacheUserRepository_FindById_Cancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	release := make(chan struct{})
+	uc := cachemocks.NewMockUserCache(ctrl)
+	uc.EXPECT().Get(gomock.Any(), int64(1)).Return(domain.User{}, cache.ErrKeyNotExist).Times(2)
+	written := make(chan error, 1)
+	uc.EXPECT().Set(gomock.Any(), domain.User{Id: 1, Ctime: time.UnixMilli(0)}).
+		DoAndReturn(func(ctx context.Context, u domain.User) error {
+			_, ok := ctx.Deadline()
+			assert.True(t, ok)
+			written <- ctx.Err()
+			return nil
+		})
+	ud := daomocks.NewMockUserDAO(ctrl)
+	ud.EXPECT().FindById(gomock.Any(), int64(1)).DoAndReturn(func(ctx context.Context, id int64) (dao.User, error) {
+		<-release
+		// 第一个请求已经取消了，查询还能继续
+		if err := ctx.Err(); err != nil {
+			return dao.User{}, err
+		}
+		return dao.User{Id: id}, nil
+	})
+	repo := NewUserRepository(ud, uc)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := repo.FindById(ctx, 1)
+		first <- err
+	}()
+	second := make(chan domain.User, 1)
+	go func() {
+		// 等第一个请求先去查数据库
+		time.Sleep(time.Millisecond * 50)
+		u, err := repo.FindById(context.Background(), 1)
+		assert.NoError(t, err)
+		second <- u
+	}()
+	time.Sleep(time.Millisecond * 100)
+	cancel()
+	assert.Equal(t, context.Canceled, <-first)
+	close(release)
+	assert.Equal(t, int64(1), (<-second).Id)
+	select {
+	case err := <-written:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("没有回写缓存")
+	}
+}
+
+// TestCacheUserRepository_Update_DelayDelete 更新之前查到的旧数据在第一次删除之后才回写，
+// 延迟双删要把它删掉
+func TestCacheUserRepository_Update_DelayDelete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	querying := make(chan struct{})
+	release := make(chan struct{})
+	ud := daomocks.NewMockUserDAO(ctrl)
+	ud.EXPECT().FindById(gomock.Any(), int64(1)).DoAndReturn(func(ctx context.Context, id int64) (dao.User, error) {
+		close(querying)
+		<-release
+		return dao.User{Id: id, Password: "old"}, nil
+	})
+	ud.EXPECT().UpdateNonZeroFields(gomock.Any(), gomock.Any()).Return(nil)
+
+	written := make(chan struct{})
+	deleted := make(chan struct{})
+	uc := cachemocks.NewMockUserCache(ctrl)
+	uc.EXPECT().Get(gomock.Any(), int64(1)).Return(domain.User{}, cache.ErrKeyNotExist)
+	gomock.InOrder(
+		uc.EXPECT().Delete(gomock.Any(), int64(1)).Return(nil),
+		// 旧数据回写进去了
+		uc.EXPECT().Set(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, u domain.User) error {
+			close(written)
+			return nil
+		}),
+		uc.EXPECT().Delete(gomock.Any(), int64(1)).DoAndReturn(func(ctx context.Context, id int64) error {
+			close(deleted)
+			return nil
+		}),
+	)
+
+	repo := NewUserRepository(ud, uc).(*CacheUserRepository)
+	repo.deleteDelay = time.Millisecond * 100
+	go func() {
+		_, err := repo.FindById(context.Background(), 1)
+		assert.NoError(t, err)
+	}()
+	<-querying
+	require.NoError(t, repo.Update(context.Background(), domain.User{Id: 1, Password: "new"}))
+	close(release)
+	<-written
+	select {
+	case <-deleted:
+	case <-time.After(time.Second):
+		t.Fatal("没有延迟删除缓存")
+	}
+}
@@ -0,0 +1,10 @@
+-- 同一个 IP、同一个手机号码在窗口内发送验证码的次数
+local window = tonumber(ARGV[1])
+for _, key in ipairs(KEYS) do
+    local cnt = redis.call("incr", key)
+    if cnt == 1 then
+        -- 第一次发送，开始一个新的窗口
+        redis.call("expire", key, window)
+    end
+end
+return 0
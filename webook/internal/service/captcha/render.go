@@ -0,0 +1,262 @@
+package captcha
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math/rand"
+)
+
+const (
+	imageWidth  = 120
+	imageHeight = 44
+
+	sliderWidth  = 280
+	sliderHeight = 160
+	pieceSize    = 44
+)
+
+// 七段数码管，从低位开始依次是 上、右上、右下、下、左下、左上、中
+var segments = [10]uint8{63, 6, 91, 79, 102, 109, 125, 7, 127, 111}
+
+// renderDigits 画成数码管的样子再加一点干扰线，只用标准库，不依赖字体
+func renderDigits(code string) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, imageWidth, imageHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: randomColor(200, 255)}, image.Point{}, draw.Src)
+	const w, h, t = 18, 30, 3
+	for i, ch := range code {
+		ox := 10 + i*26 + rand.Intn(5)
+		oy := 4 + rand.Intn(8)
+		c := randomColor(0, 120)
+		rects := [7]image.Rectangle{
+			image.Rect(ox, oy, ox+w, oy+t),
+			image.Rect(ox+w-t, oy, ox+w, oy+h/2),
+			image.Rect(ox+w-t, oy+h/2, ox+w, oy+h),
+			image.Rect(ox, oy+h-t, ox+w, oy+h),
+			image.Rect(ox, oy+h/2, ox+t, oy+h),
+			image.Rect(ox, oy, ox+t, oy+h/2),
+			image.Rect(ox, oy+h/2-1, ox+w, oy+h/2+2),
+		}
+		for s, r := range rects {
+			if segments[ch-'0']&(1<<s) != 0 {
+				draw.Draw(img, r, &image.Uniform{C: c}, image.Point{}, draw.Src)
+			}
+		}
+	}
+	for i := 0; i < 4; i++ {
+		drawLine(img, rand.Intn(imageWidth), rand.Intn(imageHeight),
+			rand.Intn(imageWidth), rand.Intn(imageHeight), randomColor(0, 200))
+	}
+	for i := 0; i < 80; i++ {
+		img.Set(rand.Intn(imageWidth), rand.Intn(imageHeight), randomColor(0, 255))
+	}
+	return img
+}
+
+// renderSlider 背景上 (x, y) 的位置挖一个缺口，拼图是缺口原来的内容。
+// 拼图和缺口的轮廓是随机的，不是正方形；缺口里面原来的内容整个换成和它无关的暗色纹理，
+// 拿拼图去背景上做模板匹配（例如归一化互相关）找不到缺口。
+// 同一行再挖一个一样轮廓的假缺口，只看哪里像缺口的话只有一半的机会，
+// 拼图的 y 是给了前端的，假缺口放在别的行没有用
+func renderSlider(x, y int) (*image.RGBA, *image.RGBA) {
+	bg := image.NewRGBA(image.Rect(0, 0, sliderWidth, sliderHeight))
+	draw.Draw(bg, bg.Bounds(), &image.Uniform{C: randomColor(120, 220)}, image.Point{}, draw.Src)
+	for i := 0; i < 30; i++ {
+		x0, y0 := rand.Intn(sliderWidth), rand.Intn(sliderHeight)
+		r := image.Rect(x0, y0, x0+10+rand.Intn(60), y0+10+rand.Intn(40))
+		draw.Draw(bg, r, &image.Uniform{C: randomColor(40, 255)}, image.Point{}, draw.Src)
+	}
+	for i := 0; i < 8; i++ {
+		drawLine(bg, rand.Intn(sliderWidth), rand.Intn(sliderHeight),
+			rand.Intn(sliderWidth), rand.Intn(sliderHeight), randomColor(0, 255))
+	}
+	addNoise(bg, bg.Bounds(), 40)
+	m := randomMask()
+	piece := cutPiece(bg, image.Pt(x, y), m)
+	fillGap(bg, image.Pt(x, y), m)
+	if decoy, ok := decoyGap(x, y); ok {
+		fillGap(bg, decoy.Min, m)
+	}
+	return bg, piece
+}
+
+// pieceMask 拼图的轮廓，true 是拼图里面的像素
+type pieceMask [pieceSize][pieceSize]bool
+
+// tabRadius 凸起和凹口的半径，拼图的主体四周留出这么宽放凸起
+const tabRadius = 7
+
+// randomMask 正方形的主体，随机一条边上有一个凸起，另一条边上有一个凹口，
+// 凸起和凹口在边上的位置也是随机的
+func randomMask() *pieceMask {
+	var m pieceMask
+	lo, hi := tabRadius, pieceSize-tabRadius
+	for py := lo; py < hi; py++ {
+		for px := lo; px < hi; px++ {
+			m[py][px] = true
+		}
+	}
+	sides := rand.Perm(4)
+	circle(&m, sideCenter(sides[0], lo, hi), tabRadius-1, true)
+	circle(&m, sideCenter(sides[1], lo, hi), tabRadius-2, false)
+	return &m
+}
+
+// sideCenter 第 side 条边（上右下左）上随机一个点
+func sideCenter(side, lo, hi int) image.Point {
+	t := lo + tabRadius + rand.Intn(hi-lo-tabRadius*2+1)
+	switch side {
+	case 0:
+		return image.Pt(t, lo)
+	case 1:
+		return image.Pt(hi-1, t)
+	case 2:
+		return image.Pt(t, hi-1)
+	default:
+		return image.Pt(lo, t)
+	}
+}
+
+func circle(m *pieceMask, c image.Point, r int, val bool) {
+	for py := max(c.Y-r, 0); py <= min(c.Y+r, pieceSize-1); py++ {
+		for px := max(c.X-r, 0); px <= min(c.X+r, pieceSize-1); px++ {
+			if (px-c.X)*(px-c.X)+(py-c.Y)*(py-c.Y) <= r*r {
+				m[py][px] = val
+			}
+		}
+	}
+}
+
+// edge 在拼图里面，并且挨着拼图外面的像素
+func (m *pieceMask) edge(px, py int) bool {
+	if !m[py][px] {
+		return false
+	}
+	for _, d := range [4]image.Point{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+		nx, ny := px+d.X, py+d.Y
+		if nx < 0 || ny < 0 || nx >= pieceSize || ny >= pieceSize || !m[ny][nx] {
+			return true
+		}
+	}
+	return false
+}
+
+// cutPiece 把 at 位置轮廓里面的内容拿出来，轮廓外面是透明的。
+// 拼图单独加一层噪点，边上描一圈亮边，和背景逐像素比对不上
+func cutPiece(bg *image.RGBA, at image.Point, m *pieceMask) *image.RGBA {
+	piece := image.NewRGBA(image.Rect(0, 0, pieceSize, pieceSize))
+	for py := 0; py < pieceSize; py++ {
+		for px := 0; px < pieceSize; px++ {
+			if m[py][px] {
+				piece.SetRGBA(px, py, bg.RGBAAt(at.X+px, at.Y+py))
+			}
+		}
+	}
+	addNoise(piece, piece.Bounds(), 12)
+	for py := 0; py < pieceSize; py++ {
+		for px := 0; px < pieceSize; px++ {
+			switch {
+			case !m[py][px]:
+				piece.SetRGBA(px, py, color.RGBA{})
+			case m.edge(px, py):
+				piece.SetRGBA(px, py, color.RGBA{R: 240, G: 240, B: 240, A: 255})
+			}
+		}
+	}
+	return piece
+}
+
+// fillGap 轮廓里面原来的内容换成一块暗色的纹理，颜色和纹理都是随机的，和原来的内容无关；
+// 边上描一圈暗边，人还是能看出缺口的形状
+func fillGap(bg *image.RGBA, at image.Point, m *pieceMask) {
+	base := randomColor(30, 90)
+	for py := 0; py < pieceSize; py++ {
+		for px := 0; px < pieceSize; px++ {
+			if !m[py][px] {
+				continue
+			}
+			c := base
+			if m.edge(px, py) {
+				c = color.RGBA{R: 20, G: 20, B: 20, A: 255}
+			}
+			bg.SetRGBA(at.X+px, at.Y+py, jitter(c, 24))
+		}
+	}
+}
+
+// decoyGap 在同一行找一个不和缺口重叠、也不和拼图初始位置重叠的假缺口
+func decoyGap(x, y int) (image.Rectangle, bool) {
+	for i := 0; i < 10; i++ {
+		dx := pieceSize + rand.Intn(sliderWidth-pieceSize*2)
+		if abs(dx-x) >= pieceSize {
+			return image.Rect(dx, y, dx+pieceSize, y+pieceSize), true
+		}
+	}
+	return image.Rectangle{}, false
+}
+
+// addNoise 每个像素的每个通道随机加减 [0, amp]
+func addNoise(img *image.RGBA, r image.Rectangle, amp int) {
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		for px := r.Min.X; px < r.Max.X; px++ {
+			img.SetRGBA(px, py, jitter(img.RGBAAt(px, py), amp))
+		}
+	}
+}
+
+func jitter(c color.RGBA, amp int) color.RGBA {
+	n := func(v uint8) uint8 {
+		return uint8(min(max(int(v)+rand.Intn(amp*2+1)-amp, 0), 255))
+	}
+	return color.RGBA{R: n(c.R), G: n(c.G), B: n(c.B), A: 255}
+}
+
+func drawLine(img draw.Image, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func randomColor(lo, hi int) color.RGBA {
+	n := func() uint8 { return uint8(lo + rand.Intn(hi-lo)) }
+	return color.RGBA{R: n(), G: n(), B: n(), A: 255}
+}
+
+func encodePNG(img image.Image) (string, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
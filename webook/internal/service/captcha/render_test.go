@@ -0,0 +1,129 @@
+package captcha
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRenderSlider_Threshold 按亮度找同一行最暗的位置，不能稳定地找到缺口
+func TestRenderSlider_Threshold(t *testing.T) {
+	const rounds = 50
+	hits := 0
+	for i := 0; i < rounds; i++ {
+		x, y := pieceSize+i%(sliderWidth-pieceSize*2), (i*7)%(sliderHeight-pieceSize)
+		bg, _ := renderSlider(x, y)
+		if abs(darkestWindow(bg, y)-x) <= 2 {
+			hits++
+		}
+	}
+	// 只压暗缺口的时候每次都能找到，现在和假缺口差不多是一半一半
+	assert.Less(t, hits, rounds*4/5)
+}
+
+// TestRenderSlider_NCC 拿拼图的内容在同一行做归一化互相关，相关性最高的位置不能稳定地是缺口。
+// 轮廓是故意留给人看的，真假缺口的轮廓一样，这里只看轮廓里面的内容
+func TestRenderSlider_NCC(t *testing.T) {
+	const rounds = 50
+	hits := 0
+	for i := 0; i < rounds; i++ {
+		x, y := pieceSize+i%(sliderWidth-pieceSize*2), (i*7)%(sliderHeight-pieceSize)
+		bg, piece := renderSlider(x, y)
+		if abs(bestNCC(bg, piece, y)-x) <= 2 {
+			hits++
+		}
+	}
+	// 缺口里面还是原来的内容的时候（只是压暗了），每次都能找到
+	assert.Less(t, hits, rounds/5)
+}
+
+func TestRenderSlider_GapNotFlat(t *testing.T) {
+	bg, _ := renderSlider(100, 50)
+	seen := make(map[[3]uint8]struct{})
+	for py := 50; py < 50+pieceSize; py++ {
+		for px := 100; px < 100+pieceSize; px++ {
+			c := bg.RGBAAt(px, py)
+			seen[[3]uint8{c.R, c.G, c.B}] = struct{}{}
+		}
+	}
+	assert.Greater(t, len(seen), pieceSize*pieceSize/2)
+}
+
+// darkestWindow 第 y 行开始、pieceSize 大小的窗口里面，亮度最低的那个的横坐标
+func darkestWindow(img *image.RGBA, y int) int {
+	cols := make([]int, sliderWidth)
+	for px := 0; px < sliderWidth; px++ {
+		for py := y; py < y+pieceSize; py++ {
+			c := img.RGBAAt(px, py)
+			cols[px] += int(c.R) + int(c.G) + int(c.B)
+		}
+	}
+	best, bestX, sum := -1, 0, 0
+	for px := 0; px < sliderWidth; px++ {
+		sum += cols[px]
+		if px >= pieceSize {
+			sum -= cols[px-pieceSize]
+		}
+		if px >= pieceSize-1 && (best < 0 || sum < best) {
+			best, bestX = sum, px-pieceSize+1
+		}
+	}
+	return bestX
+}
+
+// bestNCC 拼图轮廓里面（不含描边）的像素和第 y 行每个位置的背景做归一化互相关，相关性最高的那个的横坐标。
+// 对亮度的整体缩放和平移不敏感，只把缺口压暗是没用的
+func bestNCC(bg, piece *image.RGBA, y int) int {
+	gray := func(img *image.RGBA, px, py int) float64 {
+		c := img.RGBAAt(px, py)
+		return (float64(c.R) + float64(c.G) + float64(c.B)) / 3
+	}
+	opaque := func(px, py int) bool {
+		return px >= 0 && py >= 0 && px < pieceSize && py < pieceSize && piece.RGBAAt(px, py).A != 0
+	}
+	var pts []image.Point
+	for py := 0; py < pieceSize; py++ {
+		for px := 0; px < pieceSize; px++ {
+			if opaque(px, py) && opaque(px-1, py) && opaque(px+1, py) && opaque(px, py-1) && opaque(px, py+1) {
+				pts = append(pts, image.Pt(px, py))
+			}
+		}
+	}
+	a := make([]float64, len(pts))
+	for i, p := range pts {
+		a[i] = gray(piece, p.X, p.Y)
+	}
+	b := make([]float64, len(pts))
+	best, bestX := math.Inf(-1), 0
+	for ox := 0; ox+pieceSize <= sliderWidth; ox++ {
+		for i, p := range pts {
+			b[i] = gray(bg, ox+p.X, y+p.Y)
+		}
+		if v := ncc(a, b); v > best {
+			best, bestX = v, ox
+		}
+	}
+	return bestX
+}
+
+func ncc(a, b []float64) float64 {
+	var ma, mb float64
+	for i := range a {
+		ma += a[i]
+		mb += b[i]
+	}
+	ma /= float64(len(a))
+	mb /= float64(len(b))
+	var num, da, db float64
+	for i := range a {
+		num += (a[i] - ma) * (b[i] - mb)
+		da += (a[i] - ma) * (a[i] - ma)
+		db += (b[i] - mb) * (b[i] - mb)
+	}
+	if da == 0 || db == 0 {
+		return 0
+	}
+	return num / math.Sqrt(da*db)
+}
@@ -0,0 +1,70 @@
+package captcha
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"geektime/webook/pkg/redisx"
+)
+
+//go:embed lua/record.lua
+var luaRecord string
+
+var recordScript = redisx.Register(luaRecord)
+
+// RedisRiskChecker 同一个 IP 或者同一个手机号码在窗口内发送次数超过阈值之后，
+// 要先做人机验证。阈值是 0 表示这个维度不检查
+type RedisRiskChecker struct {
+	cmd            redis.Cmdable
+	window         time.Duration
+	ipThreshold    int
+	phoneThreshold int
+}
+
+func NewRiskChecker(cmd redis.Cmdable, window time.Duration, ipThreshold, phoneThreshold int) RiskChecker {
+	return &RedisRiskChecker{
+		cmd:            cmd,
+		window:         window,
+		ipThreshold:    ipThreshold,
+		phoneThreshold: phoneThreshold,
+	}
+}
+
+func (r *RedisRiskChecker) Required(ctx context.Context, ip, phone string) (bool, error) {
+	vals, err := r.cmd.MGet(ctx, r.ipKey(ip), r.phoneKey(phone)).Result()
+	if err != nil {
+		return false, err
+	}
+	return r.exceeded(vals[0], r.ipThreshold) || r.exceeded(vals[1], r.phoneThreshold), nil
+}
+
+func (r *RedisRiskChecker) exceeded(val any, threshold int) bool {
+	if threshold <= 0 {
+		return false
+	}
+	// key 不存在的时候是 nil
+	str, ok := val.(string)
+	if !ok {
+		return false
+	}
+	cnt, err := strconv.Atoi(str)
+	return err == nil && cnt >= threshold
+}
+
+func (r *RedisRiskChecker) Record(ctx context.Context, ip, phone string) error {
+	return recordScript.Run(ctx, r.cmd, []string{r.ipKey(ip), r.phoneKey(phone)},
+		int64(r.window/time.Second)).Err()
+}
+
+func (r *RedisRiskChecker) ipKey(ip string) string {
+	return fmt.Sprintf("captcha:risk:ip:%s", ip)
+}
+
+func (r *RedisRiskChecker) phoneKey(phone string) string {
+	return fmt.Sprintf("captcha:risk:phone:%s", phone)
+}
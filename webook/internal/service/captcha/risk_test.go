@@ -0,0 +1,53 @@
+package captcha
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"geektime/webook/internal/repository/cache/redismocks"
+)
+
+func TestRedisRiskChecker_Required(t *testing.T) {
+	testCases := []struct {
+		name string
+		vals []any
+
+		expected bool
+	}{
+		{name: "第一次发送", vals: []any{nil, nil}},
+		{name: "没有超过阈值", vals: []any{"4", "2"}},
+		{name: "IP 超过阈值", vals: []any{"5", "1"}, expected: true},
+		{name: "手机号码超过阈值", vals: []any{"1", "3"}, expected: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			res := redis.NewSliceCmd(context.Background())
+			res.SetVal(tc.vals)
+			cmd.EXPECT().MGet(gomock.Any(), "captcha:risk:ip:127.0.0.1", "captcha:risk:phone:+8615212345678").
+				Return(res)
+			checker := NewRiskChecker(cmd, time.Minute*10, 5, 3)
+			ok, err := checker.Required(context.Background(), "127.0.0.1", "+8615212345678")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, ok)
+		})
+	}
+}
+
+func TestRedisRiskChecker_Record(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	cmd.EXPECT().EvalSha(gomock.Any(), recordScript.Hash(),
+		[]string{"captcha:risk:ip:127.0.0.1", "captcha:risk:phone:+8615212345678"}, int64(600)).
+		Return(redis.NewCmd(context.Background()))
+	checker := NewRiskChecker(cmd, time.Minute*10, 5, 3)
+	assert.NoError(t, checker.Record(context.Background(), "127.0.0.1", "+8615212345678"))
+}
@@ -0,0 +1,160 @@
+package captcha
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	challengeExpiration = time.Minute * 5
+	tokenExpiration     = time.Minute * 2
+	// 滑块允许的误差，单位是像素
+	sliderTolerance = 4
+	imageCodeLength = 4
+)
+
+// RedisService 题目的答案和 token 都存在 Redis 里面
+type RedisService struct {
+	cmd redis.Cmdable
+}
+
+func NewService(cmd redis.Cmdable) Service {
+	return &RedisService{
+		cmd: cmd,
+	}
+}
+
+func (s *RedisService) Generate(ctx context.Context, kind Kind) (Challenge, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return Challenge{}, err
+	}
+	c := Challenge{Id: id, Kind: kind}
+	var answer string
+	switch kind {
+	case KindImage:
+		var code strings.Builder
+		for i := 0; i < imageCodeLength; i++ {
+			d, err := randomInt(10)
+			if err != nil {
+				return Challenge{}, err
+			}
+			code.WriteByte(byte('0' + d))
+		}
+		answer = code.String()
+		c.Image, err = encodePNG(renderDigits(answer))
+	case KindSlider:
+		x, err := randomInt(sliderWidth - pieceSize*2)
+		if err != nil {
+			return Challenge{}, err
+		}
+		y, err := randomInt(sliderHeight - pieceSize)
+		if err != nil {
+			return Challenge{}, err
+		}
+		// 缺口不会和拼图的初始位置重叠
+		x += pieceSize
+		bg, piece := renderSlider(x, y)
+		if c.Image, err = encodePNG(bg); err != nil {
+			return Challenge{}, err
+		}
+		c.Piece, err = encodePNG(piece)
+		c.PieceY = y
+		answer = strconv.Itoa(x)
+	default:
+		return Challenge{}, ErrUnknownKind
+	}
+	if err != nil {
+		return Challenge{}, err
+	}
+	err = s.cmd.Set(ctx, s.challengeKey(id), string(kind)+":"+answer, challengeExpiration).Err()
+	return c, err
+}
+
+func (s *RedisService) Check(ctx context.Context, id, answer, ip string) (string, error) {
+	// 取出来就删掉，一个题目只能猜一次
+	val, err := s.cmd.GetDel(ctx, s.challengeKey(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrChallengeNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	kind, expected, _ := strings.Cut(val, ":")
+	if !s.match(Kind(kind), expected, strings.TrimSpace(answer)) {
+		return "", ErrWrongAnswer
+	}
+	token, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	err = s.cmd.Set(ctx, s.tokenKey(token), ip, tokenExpiration).Err()
+	return token, err
+}
+
+func (s *RedisService) match(kind Kind, expected, answer string) bool {
+	switch kind {
+	case KindImage:
+		return answer == expected
+	case KindSlider:
+		x, err := strconv.Atoi(expected)
+		if err != nil {
+			return false
+		}
+		got, err := strconv.Atoi(answer)
+		if err != nil {
+			return false
+		}
+		return got >= x-sliderTolerance && got <= x+sliderTolerance
+	}
+	return false
+}
+
+func (s *RedisService) Verify(ctx context.Context, token, ip string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	boundIP, err := s.cmd.GetDel(ctx, s.tokenKey(token)).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// token 只能在拿到它的 IP 上使用
+	return boundIP == "" || boundIP == ip, nil
+}
+
+func (s *RedisService) challengeKey(id string) string {
+	return fmt.Sprintf("captcha:challenge:%s", id)
+}
+
+func (s *RedisService) tokenKey(token string) string {
+	return fmt.Sprintf("captcha:token:%s", token)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// randomInt 返回 [0, n)，答案要用 crypto/rand 生成
+func randomInt(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(v.Int64()), nil
+}
@@ -0,0 +1,195 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"geektime/webook/internal/repository/cache/redismocks"
+)
+
+func TestRedisService_Generate(t *testing.T) {
+	testCases := []struct {
+		name string
+		kind Kind
+
+		expectedAnswer func(t *testing.T, val string)
+		expectedErr    error
+	}{
+		{
+			name: "数字图片",
+			kind: KindImage,
+			expectedAnswer: func(t *testing.T, val string) {
+				assert.Regexp(t, `^image:\d{4}$`, val)
+			},
+		},
+		{
+			name: "滑块",
+			kind: KindSlider,
+			expectedAnswer: func(t *testing.T, val string) {
+				assert.Regexp(t, `^slider:\d+$`, val)
+			},
+		},
+		{
+			name:        "未知类型",
+			kind:        "audio",
+			expectedErr: ErrUnknownKind,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			var stored string
+			if tc.expectedErr == nil {
+				cmd.EXPECT().Set(gomock.Any(), gomock.Any(), gomock.Any(), challengeExpiration).
+					DoAndReturn(func(ctx context.Context, key string, val any, exp time.Duration) *redis.StatusCmd {
+						assert.True(t, strings.HasPrefix(key, "captcha:challenge:"))
+						stored = val.(string)
+						return redis.NewStatusCmd(ctx)
+					})
+			}
+			c, err := NewService(cmd).Generate(context.Background(), tc.kind)
+			assert.Equal(t, tc.expectedErr, err)
+			if err != nil {
+				return
+			}
+			tc.expectedAnswer(t, stored)
+			assert.Equal(t, tc.kind, c.Kind)
+			assert.True(t, strings.HasPrefix(c.Image, "data:image/png;base64,"))
+		})
+	}
+}
+
+func TestRedisService_Check(t *testing.T) {
+	getDel := func(val string, err error) *redis.StringCmd {
+		res := redis.NewStringCmd(context.Background())
+		res.SetVal(val)
+		res.SetErr(err)
+		return res
+	}
+	testCases := []struct {
+		name   string
+		mock   func(ctrl *gomock.Controller) redis.Cmdable
+		answer string
+
+		expectedErr error
+	}{
+		{
+			name: "数字答对了",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().GetDel(gomock.Any(), "captcha:challenge:abc").Return(getDel("image:1234", nil))
+				cmd.EXPECT().Set(gomock.Any(), gomock.Any(), "127.0.0.1", tokenExpiration).
+					Return(redis.NewStatusCmd(context.Background()))
+				return cmd
+			},
+			answer: " 1234 ",
+		},
+		{
+			name: "滑块在误差范围内",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().GetDel(gomock.Any(), "captcha:challenge:abc").Return(getDel("slider:100", nil))
+				cmd.EXPECT().Set(gomock.Any(), gomock.Any(), "127.0.0.1", tokenExpiration).
+					Return(redis.NewStatusCmd(context.Background()))
+				return cmd
+			},
+			answer: "97",
+		},
+		{
+			name: "滑块超出误差",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().GetDel(gomock.Any(), "captcha:challenge:abc").Return(getDel("slider:100", nil))
+				return cmd
+			},
+			answer:      "90",
+			expectedErr: ErrWrongAnswer,
+		},
+		{
+			name: "数字答错了",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().GetDel(gomock.Any(), "captcha:challenge:abc").Return(getDel("image:1234", nil))
+				return cmd
+			},
+			answer:      "4321",
+			expectedErr: ErrWrongAnswer,
+		},
+		{
+			name: "题目不存在",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().GetDel(gomock.Any(), "captcha:challenge:abc").Return(getDel("", redis.Nil))
+				return cmd
+			},
+			answer:      "1234",
+			expectedErr: ErrChallengeNotFound,
+		},
+		{
+			name: "Redis 错误",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().GetDel(gomock.Any(), "captcha:challenge:abc").Return(getDel("", errors.New("mock redis error")))
+				return cmd
+			},
+			answer:      "1234",
+			expectedErr: errors.New("mock redis error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			token, err := NewService(tc.mock(ctrl)).Check(context.Background(), "abc", tc.answer, "127.0.0.1")
+			assert.Equal(t, tc.expectedErr, err)
+			if err == nil {
+				assert.Len(t, token, 32)
+			}
+		})
+	}
+}
+
+func TestRedisService_Verify(t *testing.T) {
+	testCases := []struct {
+		name  string
+		val   string
+		err   error
+		token string
+
+		expected    bool
+		expectedErr error
+	}{
+		{name: "通过", token: "abc", val: "127.0.0.1", expected: true},
+		{name: "换了 IP", token: "abc", val: "10.0.0.1"},
+		{name: "token 不存在", token: "abc", err: redis.Nil},
+		{name: "Redis 错误", token: "abc", err: errors.New("mock redis error"), expectedErr: errors.New("mock redis error")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			res := redis.NewStringCmd(context.Background())
+			res.SetVal(tc.val)
+			res.SetErr(tc.err)
+			cmd.EXPECT().GetDel(gomock.Any(), "captcha:token:"+tc.token).Return(res)
+			ok, err := NewService(cmd).Verify(context.Background(), tc.token, "127.0.0.1")
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expected, ok)
+		})
+	}
+	// 没带 token 不会查 Redis
+	ok, err := NewService(nil).Verify(context.Background(), "", "127.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
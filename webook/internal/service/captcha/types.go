@@ -0,0 +1,54 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrChallengeNotFound = errors.New("图形验证码不存在或者已经过期")
+	ErrWrongAnswer       = errors.New("图形验证码错误")
+	ErrUnknownKind       = errors.New("未知的图形验证码类型")
+)
+
+type Kind string
+
+const (
+	// KindImage 图片上的数字
+	KindImage Kind = "image"
+	// KindSlider 把拼图拖到缺口的位置
+	KindSlider Kind = "slider"
+)
+
+// Verifier 校验前端完成人机验证之后拿到的 token，
+// 第三方的人机验证（腾讯天御、reCAPTCHA 之类）实现这个接口就可以替换内置的实现
+type Verifier interface {
+	// Verify token 只能用一次，ip 是用户的 IP，第三方一般也需要
+	Verify(ctx context.Context, token, ip string) (bool, error)
+}
+
+// Service 内置的图形验证码，服务端生成题目，校验通过之后发一次性的 token
+type Service interface {
+	Verifier
+	Generate(ctx context.Context, kind Kind) (Challenge, error)
+	// Check 每个题目只能回答一次，答对了返回 token
+	Check(ctx context.Context, id, answer, ip string) (string, error)
+}
+
+// Challenge 图片都是 data:image/png;base64 格式
+type Challenge struct {
+	Id    string
+	Kind  Kind
+	Image string
+	// 滑块的拼图和它的纵坐标，只有 KindSlider 有
+	Piece  string
+	PieceY int
+}
+
+// RiskChecker 判断发送验证码之前要不要先做人机验证。
+// 邮箱验证码也用它，phone 传邮箱，和手机号码不会冲突
+type RiskChecker interface {
+	Required(ctx context.Context, ip, phone string) (bool, error)
+	// Record 记录一次发送
+	Record(ctx context.Context, ip, phone string) error
+}
@@ -2,58 +2,181 @@ package service
 
 import (
 	"context"
-	"fmt"
-	"math/rand"
+	"crypto/rand"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
+
+	"geektime/webook/internal/domain"
 	"geektime/webook/internal/repository"
+	"geektime/webook/internal/service/notify"
 	"geektime/webook/internal/service/sms"
+	smsratelimit "geektime/webook/internal/service/sms/ratelimit"
+	"geektime/webook/pkg/phone"
 )
 
-const codeTplId = "1877556"
-
 var (
-	ErrSendTooMany       = repository.ErrSendTooMany
-	ErrCodeVerifyTooMany = repository.ErrCodeVerifyTooManyTimes
+	ErrSendTooMany  = repository.ErrSendTooMany
+	ErrInvalidPhone = phone.ErrInvalidNumber
 )
 
+// ErrSMSLimited 短信服务触发了限流，Dimension 说明是哪个维度
+type ErrSMSLimited = smsratelimit.LimitedError
+
+// CodeProofKey 签发验证凭证用的密钥，单独定义一个类型方便 wire 注入
+type CodeProofKey []byte
+
 type CodeService interface {
-	Send(ctx context.Context, biz, phone string) error
-	Verify(ctx context.Context, biz, phone, inputCode string) (bool, error)
+	// Send target 是手机号码或者邮箱，由 channel 决定
+	Send(ctx context.Context, biz string, channel notify.Channel, target string) error
+	// Verify 返回校验结果，输错、过期之类的都不是 error。
+	// channel 要和发送的时候一样，短信的验证码不能拿到邮箱那里用。
+	// 业务要求的话，验证通过之后结果里面带一个凭证
+	Verify(ctx context.Context, biz string, channel notify.Channel, target, inputCode string) (domain.CodeVerifyResult, error)
+	// VerifyProof 校验 Verify 签发的凭证，返回当时验证的手机号码或者邮箱
+	VerifyProof(ctx context.Context, biz, proof string) (string, error)
 }
 
 type CodeServiceImpl struct {
-	repo   repository.CodeRepository
-	smsSvc sms.Service
+	repo      repository.CodeRepository
+	notifySvc notify.Service
+	bizs      CodeBizRegistry
+	proofKey  CodeProofKey
+	now       func() time.Time
 }
 
-func NewCodeService(repo repository.CodeRepository, smsSvc sms.Service) CodeService {
+func NewCodeService(repo repository.CodeRepository, notifySvc notify.Service,
+	bizs CodeBizRegistry, proofKey CodeProofKey) CodeService {
 	return &CodeServiceImpl{
-		repo:   repo,
-		smsSvc: smsSvc,
+		repo:      repo,
+		notifySvc: notifySvc,
+		bizs:      bizs,
+		proofKey:  proofKey,
+		now:       time.Now,
 	}
 }
 
 // Send 发送验证码
-func (svc *CodeServiceImpl) Send(ctx context.Context, biz, phone string) error {
+func (svc *CodeServiceImpl) Send(ctx context.Context, biz string, channel notify.Channel, target string) error {
+	b, err := svc.bizs.Get(biz)
+	if err != nil {
+		return err
+	}
+	if !b.allow(channel) {
+		return ErrChannelNotAllowed
+	}
+	target, err = svc.normalize(channel, target)
+	if err != nil {
+		return err
+	}
 	// 生成一个验证码
-	code := svc.generateCode()
+	code, err := svc.generateCode(b.Policy)
+	if err != nil {
+		return err
+	}
 	// 塞进去 Redis
-	err := svc.repo.Store(ctx, biz, phone, code)
+	err = svc.repo.Store(ctx, svc.scope(biz, channel), target, code, b.Policy)
 	if err != nil {
 		return err
 	}
-	// 发送出去
-	err = svc.smsSvc.Send(ctx, codeTplId, []string{code}, phone)
+	// 发送出去，带上业务，短信服务按业务限流
+	err = svc.notifySvc.Send(sms.WithBiz(ctx, biz), channel, b.Template, svc.args(channel, code, b.Policy), target)
 	return err
 }
 
-func (svc *CodeServiceImpl) generateCode() string {
-	// 生成 6 位数的验证码(0~999999)
-	num := rand.Intn(1000000)
-	// 6 位数，不足 6 位前面补 0
-	return fmt.Sprintf("%06d", num)
+// args 模板参数。短信模板在服务商那边审核过，参数个数是固定的，只传验证码；
+// 邮件模板是我们自己的，把有效期也传进去，免得文案和真实的有效期对不上
+func (svc *CodeServiceImpl) args(channel notify.Channel, code string, policy domain.CodePolicy) []string {
+	if channel == notify.ChannelEmail {
+		return []string{code, strconv.Itoa(int(policy.TTL / time.Minute))}
+	}
+	return []string{code}
+}
+
+// generateCode 用 crypto/rand，math/rand 的输出是可以预测的
+func (svc *CodeServiceImpl) generateCode(policy domain.CodePolicy) (string, error) {
+	// 每一位都从 Alphabet 里面随便挑一个
+	alphabet := []rune(policy.Alphabet)
+	n := big.NewInt(int64(len(alphabet)))
+	var sb strings.Builder
+	for i := 0; i < policy.Length; i++ {
+		idx, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteRune(alphabet[idx.Int64()])
+	}
+	return sb.String(), nil
+}
+
+func (svc *CodeServiceImpl) Verify(ctx context.Context, biz string, channel notify.Channel,
+	target, inputCode string) (domain.CodeVerifyResult, error) {
+	b, err := svc.bizs.Get(biz)
+	if err != nil {
+		return domain.CodeVerifyResult{}, err
+	}
+	target, err = svc.normalize(channel, target)
+	if err != nil {
+		return domain.CodeVerifyResult{}, err
+	}
+	res, err := svc.repo.Verify(ctx, svc.scope(biz, channel), target, inputCode)
+	if err != nil || !res.OK() || b.ProofTTL <= 0 {
+		return res, err
+	}
+	res.Proof, err = svc.signProof(b, target)
+	return res, err
+}
+
+// codeProofClaims 凭证只能在签发它的业务里面用，Subject 是验证过的手机号码或者邮箱
+type codeProofClaims struct {
+	jwt.RegisteredClaims
+	Biz string `json:"biz"`
+}
+
+func (svc *CodeServiceImpl) signProof(b CodeBiz, target string) (string, error) {
+	now := svc.now()
+	claims := codeProofClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   target,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(b.ProofTTL)),
+		},
+		Biz: b.Name,
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte(svc.proofKey))
+}
+
+func (svc *CodeServiceImpl) VerifyProof(ctx context.Context, biz, proof string) (string, error) {
+	if _, err := svc.bizs.Get(biz); err != nil {
+		return "", err
+	}
+	var claims codeProofClaims
+	token, err := jwt.ParseWithClaims(proof, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(svc.proofKey), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}), jwt.WithTimeFunc(svc.now))
+	if err != nil || !token.Valid {
+		return "", ErrInvalidProof
+	}
+	// 别的业务签发的凭证不能拿来用，例如登录的凭证不能拿来注销账号
+	if claims.Biz != biz || claims.Subject == "" {
+		return "", ErrInvalidProof
+	}
+	return claims.Subject, nil
+}
+
+// normalize 手机号码统一成 E.164，同一个号码不同写法要落到同一个 key 上。
+// 只有短信渠道才这么做，不然一个手机号码可以当成邮箱来用
+func (svc *CodeServiceImpl) normalize(channel notify.Channel, target string) (string, error) {
+	if channel != notify.ChannelSMS {
+		return target, nil
+	}
+	return phone.Normalize(target)
 }
 
-func (svc *CodeServiceImpl) Verify(ctx context.Context, biz, phone, inputCode string) (bool, error) {
-	return svc.repo.Verify(ctx, biz, phone, inputCode)
+// scope 渠道也放到 key 里面，发到手机上的验证码只能在短信登录那里用
+func (svc *CodeServiceImpl) scope(biz string, channel notify.Channel) string {
+	return biz + ":" + string(channel)
 }
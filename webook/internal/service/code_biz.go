@@ -0,0 +1,64 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ecodeclub/ekit/slice"
+
+	"geektime/webook/internal/domain"
+	"geektime/webook/internal/service/notify"
+)
+
+var (
+	ErrUnknownBiz        = errors.New("未知的验证码业务")
+	ErrChannelNotAllowed = errors.New("这个业务不能用这个渠道发送验证码")
+	ErrInvalidProof      = errors.New("验证凭证无效")
+)
+
+// CodeBiz 一种使用验证码的业务，例如登录、绑定手机、注销账号。
+// 新增业务只需要注册一个 CodeBiz
+type CodeBiz struct {
+	Name string
+	// 逻辑模板，例如 template.LoginCode，具体用哪个服务商的哪个模板由各个渠道自己决定
+	Template string
+	Policy   domain.CodePolicy
+	// 允许用哪些渠道发送
+	Channels []notify.Channel
+	// 大于 0 的时候，验证通过之后签发一个有效期这么长的凭证，
+	// 后续的接口用它证明用户刚刚验证过，例如注销账号之前先验证手机
+	ProofTTL time.Duration
+}
+
+func (b CodeBiz) allow(channel notify.Channel) bool {
+	return slice.Contains(b.Channels, channel)
+}
+
+// CodeBizRegistry 注册过的业务才能发送验证码
+type CodeBizRegistry interface {
+	Get(biz string) (CodeBiz, error)
+}
+
+type MapCodeBizRegistry struct {
+	bizs map[string]CodeBiz
+}
+
+// NewCodeBizRegistry Policy 里面没有设置的字段用默认值
+func NewCodeBizRegistry(bizs ...CodeBiz) CodeBizRegistry {
+	m := make(map[string]CodeBiz, len(bizs))
+	for _, b := range bizs {
+		b.Policy = b.Policy.WithDefaults()
+		m[b.Name] = b
+	}
+	return &MapCodeBizRegistry{
+		bizs: m,
+	}
+}
+
+func (r *MapCodeBizRegistry) Get(biz string) (CodeBiz, error) {
+	b, ok := r.bizs[biz]
+	if !ok {
+		return CodeBiz{}, ErrUnknownBiz
+	}
+	return b, nil
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"geektime/webook/internal/domain"
+	"geektime/webook/internal/repository"
+	repomocks "geektime/webook/internal/repository/mocks"
+	"geektime/webook/internal/service/notify"
+	notifymocks "geektime/webook/internal/service/notify/mocks"
+	"geektime/webook/internal/service/sms/template"
+)
+
+func testCodeBizRegistry() CodeBizRegistry {
+	return NewCodeBizRegistry(
+		CodeBiz{
+			Name:     "login",
+			Template: template.LoginCode,
+			Channels: []notify.Channel{notify.ChannelSMS, notify.ChannelEmail},
+		},
+		CodeBiz{
+			Name:     "reset",
+			Template: template.ResetPassword,
+			Policy:   domain.CodePolicy{Length: 8, Alphabet: "ABC", TTL: time.Minute * 5, ResendInterval: time.Minute * 2, MaxAttempts: 5},
+			Channels: []notify.Channel{notify.ChannelSMS},
+			ProofTTL: time.Minute * 5,
+		},
+	)
+}
+
+func TestCodeServiceImpl_Send(t *testing.T) {
+	resetPolicy := domain.CodePolicy{Length: 8, Alphabet: "ABC", TTL: time.Minute * 5, ResendInterval: time.Minute * 2, MaxAttempts: 5}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (repository.CodeRepository, notify.Service)
+
+		biz     string
+		channel notify.Channel
+		target  string
+
+		expectedErr error
+	}{
+		{
+			name: "自定义策略的业务",
+			mock: func(ctrl *gomock.Controller) (repository.CodeRepository, notify.Service) {
+				repo := repomocks.NewMockCodeRepository(ctrl)
+				repo.EXPECT().Store(gomock.Any(), "reset:sms", "+8615212345678", gomock.Any(), resetPolicy).
+					DoAndReturn(func(ctx context.Context, biz, phone, code string, policy domain.CodePolicy) error {
+						assert.Regexp(t, `^[ABC]{8}$`, code)
+						return nil
+					})
+				notifySvc := notifymocks.NewMockService(ctrl)
+				notifySvc.EXPECT().Send(gomock.Any(), notify.ChannelSMS, template.ResetPassword, gomock.Any(), "+8615212345678").
+					DoAndReturn(func(ctx context.Context, channel notify.Channel, tpl string, args []string, target string) error {
+						// 短信模板的参数个数是固定的，只有验证码
+						assert.Len(t, args, 1)
+						return nil
+					})
+				return repo, notifySvc
+			},
+			biz:     "reset",
+			channel: notify.ChannelSMS,
+			target:  "152 1234 5678",
+		},
+		{
+			name: "没有配置策略的业务用默认策略",
+			mock: func(ctrl *gomock.Controller) (repository.CodeRepository, notify.Service) {
+				repo := repomocks.NewMockCodeRepository(ctrl)
+				repo.EXPECT().Store(gomock.Any(), "login:email", "123@qq.com", gomock.Any(), domain.DefaultCodePolicy).
+					DoAndReturn(func(ctx context.Context, biz, phone, code string, policy domain.CodePolicy) error {
+						assert.Regexp(t, `^\d{6}$`, code)
+						return nil
+					})
+				notifySvc := notifymocks.NewMockService(ctrl)
+				notifySvc.EXPECT().Send(gomock.Any(), notify.ChannelEmail, template.LoginCode, gomock.Any(), "123@qq.com").
+					DoAndReturn(func(ctx context.Context, channel notify.Channel, tpl string, args []string, target string) error {
+						// 邮件带上有效期，和策略保持一致
+						assert.Len(t, args, 2)
+						assert.Equal(t, "10", args[1])
+						return nil
+					})
+				return repo, notifySvc
+			},
+			biz:     "login",
+			channel: notify.ChannelEmail,
+			target:  "123@qq.com",
+		},
+		{
+			name: "没有注册的业务",
+			mock: func(ctrl *gomock.Controller) (repository.CodeRepository, notify.Service) {
+				return repomocks.NewMockCodeRepository(ctrl), notifymocks.NewMockService(ctrl)
+			},
+			biz:         "unknown",
+			channel:     notify.ChannelSMS,
+			target:      "15212345678",
+			expectedErr: ErrUnknownBiz,
+		},
+		{
+			name: "业务不允许这个渠道",
+			mock: func(ctrl *gomock.Controller) (repository.CodeRepository, notify.Service) {
+				return repomocks.NewMockCodeRepository(ctrl), notifymocks.NewMockService(ctrl)
+			},
+			biz:         "reset",
+			channel:     notify.ChannelEmail,
+			target:      "123@qq.com",
+			expectedErr: ErrChannelNotAllowed,
+		},
+		{
+			name: "手机号码格式错误",
+			mock: func(ctrl *gomock.Controller) (repository.CodeRepository, notify.Service) {
+				return repomocks.NewMockCodeRepository(ctrl), notifymocks.NewMockService(ctrl)
+			},
+			biz:         "login",
+			channel:     notify.ChannelSMS,
+			target:      "152",
+			expectedErr: ErrInvalidPhone,
+		},
+		{
+			name: "发送太频繁",
+			mock: func(ctrl *gomock.Controller) (repository.CodeRepository, notify.Service) {
+				repo := repomocks.NewMockCodeRepository(ctrl)
+				repo.EXPECT().Store(gomock.Any(), "login:sms", "+8615212345678", gomock.Any(), gomock.Any()).
+					Return(ErrSendTooMany)
+				return repo, notifymocks.NewMockService(ctrl)
+			},
+			biz:         "login",
+			channel:     notify.ChannelSMS,
+			target:      "15212345678",
+			expectedErr: ErrSendTooMany,
+		},
+		{
+			name: "发送失败",
+			mock: func(ctrl *gomock.Controller) (repository.CodeRepository, notify.Service) {
+				repo := repomocks.NewMockCodeRepository(ctrl)
+				repo.EXPECT().Store(gomock.Any(), "login:sms", "+8615212345678", gomock.Any(), gomock.Any()).Return(nil)
+				notifySvc := notifymocks.NewMockService(ctrl)
+				notifySvc.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(errors.New("mock notify error"))
+				return repo, notifySvc
+			},
+			biz:         "login",
+			channel:     notify.ChannelSMS,
+			target:      "15212345678",
+			expectedErr: errors.New("mock notify error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo, notifySvc := tc.mock(ctrl)
+			svc := NewCodeService(repo, notifySvc, testCodeBizRegistry(), CodeProofKey("proof key"))
+			err := svc.Send(context.Background(), tc.biz, tc.channel, tc.target)
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func TestCodeServiceImpl_Verify(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.CodeRepository
+
+		biz     string
+		channel notify.Channel
+		target  string
+
+		expectedRes   domain.CodeVerifyResult
+		expectedErr   error
+		expectedProof bool
+	}{
+		{
+			name: "不签发凭证的业务",
+			mock: func(ctrl *gomock.Controller) repository.CodeRepository {
+				repo := repomocks.NewMockCodeRepository(ctrl)
+				repo.EXPECT().Verify(gomock.Any(), "login:sms", "+8615212345678", "123456").
+					Return(domain.CodeVerifyResult{Status: domain.CodeVerifyOK}, nil)
+				return repo
+			},
+			biz:         "login",
+			channel:     notify.ChannelSMS,
+			target:      "15212345678",
+			expectedRes: domain.CodeVerifyResult{Status: domain.CodeVerifyOK},
+		},
+		{
+			name: "验证通过，签发凭证",
+			mock: func(ctrl *gomock.Controller) repository.CodeRepository {
+				repo := repomocks.NewMockCodeRepository(ctrl)
+				repo.EXPECT().Verify(gomock.Any(), "reset:sms", "+8615212345678", "123456").
+					Return(domain.CodeVerifyResult{Status: domain.CodeVerifyOK}, nil)
+				return repo
+			},
+			biz:           "reset",
+			channel:       notify.ChannelSMS,
+			target:        "15212345678",
+			expectedRes:   domain.CodeVerifyResult{Status: domain.CodeVerifyOK},
+			expectedProof: true,
+		},
+		{
+			name: "验证码错误，不签发凭证",
+			mock: func(ctrl *gomock.Controller) repository.CodeRepository {
+				repo := repomocks.NewMockCodeRepository(ctrl)
+				repo.EXPECT().Verify(gomock.Any(), "reset:sms", "+8615212345678", "123456").
+					Return(domain.CodeVerifyResult{Status: domain.CodeVerifyWrong, Remaining: 2}, nil)
+				return repo
+			},
+			biz:         "reset",
+			channel:     notify.ChannelSMS,
+			target:      "15212345678",
+			expectedRes: domain.CodeVerifyResult{Status: domain.CodeVerifyWrong, Remaining: 2},
+		},
+		{
+			name: "短信的验证码不能拿到邮箱登录用",
+			mock: func(ctrl *gomock.Controller) repository.CodeRepository {
+				repo := repomocks.NewMockCodeRepository(ctrl)
+				// 邮箱渠道不会把号码规范化，key 里面也带着渠道，查不到短信的验证码
+				repo.EXPECT().Verify(gomock.Any(), "login:email", "+8615212345678", "123456").
+					Return(domain.CodeVerifyResult{Status: domain.CodeVerifyNotSent}, nil)
+				return repo
+			},
+			biz:         "login",
+			channel:     notify.ChannelEmail,
+			target:      "+8615212345678",
+			expectedRes: domain.CodeVerifyResult{Status: domain.CodeVerifyNotSent},
+		},
+		{
+			name: "没有注册的业务",
+			mock: func(ctrl *gomock.Controller) repository.CodeRepository {
+				return repomocks.NewMockCodeRepository(ctrl)
+			},
+			biz:         "unknown",
+			channel:     notify.ChannelSMS,
+			target:      "15212345678",
+			expectedErr: ErrUnknownBiz,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewCodeService(tc.mock(ctrl), notifymocks.NewMockService(ctrl), testCodeBizRegistry(), CodeProofKey("proof key"))
+			res, err := svc.Verify(context.Background(), tc.biz, tc.channel, tc.target, "123456")
+			assert.Equal(t, tc.expectedErr, err)
+			if !tc.expectedProof {
+				assert.Equal(t, tc.expectedRes, res)
+				return
+			}
+			assert.NotEmpty(t, res.Proof)
+			target, err := svc.VerifyProof(context.Background(), tc.biz, res.Proof)
+			assert.NoError(t, err)
+			assert.Equal(t, "+8615212345678", target)
+		})
+	}
+}
+
+func TestCodeServiceImpl_VerifyProof(t *testing.T) {
+	now := time.Date(2023, 10, 17, 8, 0, 0, 0, time.Local)
+	svc := NewCodeService(nil, nil, testCodeBizRegistry(), CodeProofKey("proof key")).(*CodeServiceImpl)
+	svc.now = func() time.Time { return now }
+	reset, err := svc.bizs.Get("reset")
+	assert.NoError(t, err)
+	proof, err := svc.signProof(reset, "+8615212345678")
+	assert.NoError(t, err)
+	login, err := svc.bizs.Get("login")
+	assert.NoError(t, err)
+	loginProof, err := svc.signProof(login, "+8615212345678")
+	assert.NoError(t, err)
+	other := NewCodeService(nil, nil, testCodeBizRegistry(), CodeProofKey("other key")).(*CodeServiceImpl)
+	otherProof, err := other.signProof(reset, "+8615212345678")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name  string
+		biz   string
+		proof string
+		after time.Duration
+
+		expectedTarget string
+		expectedErr    error
+	}{
+		{name: "有效的凭证", biz: "reset", proof: proof, expectedTarget: "+8615212345678"},
+		{name: "过期了", biz: "reset", proof: proof, after: time.Minute * 6, expectedErr: ErrInvalidProof},
+		{name: "别的业务签发的", biz: "reset", proof: loginProof, expectedErr: ErrInvalidProof},
+		{name: "密钥不对", biz: "reset", proof: otherProof, expectedErr: ErrInvalidProof},
+		{name: "乱写的", biz: "reset", proof: "abc", expectedErr: ErrInvalidProof},
+		{name: "没有注册的业务", biz: "unknown", proof: proof, expectedErr: ErrUnknownBiz},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc.now = func() time.Time { return now.Add(tc.after) }
+			target, err := svc.VerifyProof(context.Background(), tc.biz, tc.proof)
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expectedTarget, target)
+		})
+	}
+}
+
+func TestCodeServiceImpl_generateCode(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy domain.CodePolicy
+
+		expected string
+	}{
+		{name: "默认 6 位数字", policy: domain.DefaultCodePolicy, expected: `^\d{6}$`},
+		{name: "4 位数字", policy: domain.CodePolicy{Length: 4, Alphabet: "0123456789"}, expected: `^\d{4}$`},
+		{name: "8 位字母", policy: domain.CodePolicy{Length: 8, Alphabet: "ABCDEFGH"}, expected: `^[A-H]{8}$`},
+		{name: "只有一个字符", policy: domain.CodePolicy{Length: 3, Alphabet: "x"}, expected: `^xxx$`},
+		{name: "非 ASCII 字符", policy: domain.CodePolicy{Length: 2, Alphabet: "甲乙"}, expected: `^[甲乙]{2}$`},
+	}
+	svc := &CodeServiceImpl{}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, err := svc.generateCode(tc.policy)
+			assert.NoError(t, err)
+			assert.Regexp(t, tc.expected, code)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Message 发出去的一封邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	Time    time.Time
+}
+
+// defaultCapacity 发件箱最多保留多少封邮件，满了之后丢掉最早的
+const defaultCapacity = 1000
+
+// Service 内存里面的发件箱，邮件不会真的发出去，测试可以从里面拿到验证码。
+// 里面存的是明文的验证码，只能在开发环境和测试里面用
+type Service struct {
+	mu       sync.RWMutex
+	msgs     []Message
+	capacity int
+}
+
+func NewService() *Service {
+	return &Service{capacity: defaultCapacity}
+}
+
+func (s *Service) Send(ctx context.Context, to, subject, body string) error {
+	now := time.Now()
+	s.mu.Lock()
+	if len(s.msgs) >= s.capacity {
+		s.msgs = s.msgs[len(s.msgs)-s.capacity+1:]
+	}
+	s.msgs = append(s.msgs, Message{
+		To:      to,
+		Subject: subject,
+		Body:    body,
+		Time:    now,
+	})
+	s.mu.Unlock()
+	fmt.Printf("%v 邮件 %s 发给 %s：%s\n", now.Format("2006-01-02 15:04:05"), subject, to, body)
+	return nil
+}
+
+// Last 最后一封发给 to 的邮件
+func (s *Service) Last(to string) (Message, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := len(s.msgs) - 1; i >= 0; i-- {
+		if s.msgs[i].To == to {
+			return s.msgs[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// Messages 所有的邮件，按发送顺序
+func (s *Service) Messages() []Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]Message, len(s.msgs))
+	copy(res, s.msgs)
+	return res
+}
+
+// Reset 清空发件箱
+func (s *Service) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = nil
+}
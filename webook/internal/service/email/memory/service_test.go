@@ -0,0 +1,25 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Capacity(t *testing.T) {
+	svc := NewService()
+	svc.capacity = 3
+	ctx := context.Background()
+	for _, code := range []string{"111111", "222222", "333333", "444444", "555555"} {
+		require.NoError(t, svc.Send(ctx, "123@qq.com", "验证码", code))
+	}
+	msgs := svc.Messages()
+	// 只保留最近的几封
+	require.Len(t, msgs, 3)
+	assert.Equal(t, "333333", msgs[0].Body)
+	msg, ok := svc.Last("123@qq.com")
+	require.True(t, ok)
+	assert.Equal(t, "555555", msg.Body)
+}
@@ -0,0 +1,66 @@
+package smtp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestService_Send_Timeout 服务器接受了连接但是一直不响应，不能把请求一直挂着
+func TestService_Send_Timeout(t *testing.T) {
+	testCases := []struct {
+		name    string
+		timeout time.Duration
+		ctx     func() (context.Context, context.CancelFunc)
+
+		expectedErr error
+	}{
+		{
+			name:    "超时",
+			timeout: time.Millisecond * 100,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.Background(), func() {}
+			},
+			expectedErr: context.DeadlineExceeded,
+		},
+		{
+			name:    "请求被取消",
+			timeout: time.Minute,
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(time.Millisecond*100, cancel)
+				return ctx, cancel
+			},
+			expectedErr: context.Canceled,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer l.Close()
+			go func() {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				// 什么都不回，等客户端断开
+				defer conn.Close()
+				_, _ = conn.Read(make([]byte, 1))
+			}()
+
+			svc, err := NewService(l.Addr().String(), "user", "pwd", "noreply@webook.com", tc.timeout)
+			require.NoError(t, err)
+			ctx, cancel := tc.ctx()
+			defer cancel()
+			start := time.Now()
+			err = svc.Send(ctx, "abc@qq.com", "验证码", "123456")
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.Less(t, time.Since(start), time.Second*5)
+		})
+	}
+}
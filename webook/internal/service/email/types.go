@@ -0,0 +1,10 @@
+package email
+
+import (
+	"context"
+)
+
+type Service interface {
+	// Send body 是纯文本
+	Send(ctx context.Context, to, subject, body string) error
+}
@@ -0,0 +1,69 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: webook/internal/service/sms_record.go
+//
+// Generated by this command:
+//
+//	mockgen -source=webook/internal/service/sms_record.go -package=svcmocks -destination=webook/internal/service/mocks/sms_record.mock.go
+//
+// Package svcmocks is a generated GoMock package.
+package svcmocks
+
+import (
+	context "context"
+	domain "geektime/webook/internal/domain"
+	reflect "reflect"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockSMSRecordService is a mock of SMSRecordService interface.
+type MockSMSRecordService struct {
+	ctrl     *gomock.Controller
+	recorder *MockSMSRecordServiceMockRecorder
+}
+
+// MockSMSRecordServiceMockRecorder is the mock recorder for MockSMSRecordService.
+type MockSMSRecordServiceMockRecorder struct {
+	mock *MockSMSRecordService
+}
+
+// NewMockSMSRecordService creates a new mock instance.
+func NewMockSMSRecordService(ctrl *gomock.Controller) *MockSMSRecordService {
+	mock := &MockSMSRecordService{ctrl: ctrl}
+	mock.recorder = &MockSMSRecordServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSMSRecordService) EXPECT() *MockSMSRecordServiceMockRecorder {
+	return m.recorder
+}
+
+// FindByPhone mocks base method.
+func (m *MockSMSRecordService) FindByPhone(ctx context.Context, phone string, limit int) ([]domain.SMSRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByPhone", ctx, phone, limit)
+	ret0, _ := ret[0].([]domain.SMSRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByPhone indicates an expected call of FindByPhone.
+func (mr *MockSMSRecordServiceMockRecorder) FindByPhone(ctx, phone, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByPhone", reflect.TypeOf((*MockSMSRecordService)(nil).FindByPhone), ctx, phone, limit)
+}
+
+// Report mocks base method.
+func (m *MockSMSRecordService) Report(ctx context.Context, reports []domain.SMSReport) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Report", ctx, reports)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Report indicates an expected call of Report.
+func (mr *MockSMSRecordServiceMockRecorder) Report(ctx, reports any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Report", reflect.TypeOf((*MockSMSRecordService)(nil).Report), ctx, reports)
+}
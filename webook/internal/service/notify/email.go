@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+
+	"geektime/webook/internal/service/email"
+)
+
+// EmailTemplate 邮件模板，用 text/template 的语法，
+// 参数按 Params 的顺序和 args 一一对应，例如 {{.code}}
+type EmailTemplate struct {
+	Subject string
+	Body    string
+	Params  []string
+}
+
+type emailTemplate struct {
+	subject *template.Template
+	body    *template.Template
+	params  []string
+}
+
+// EmailSender 邮件渠道
+type EmailSender struct {
+	svc  email.Service
+	tpls map[string]emailTemplate
+}
+
+// NewEmailSender 模板在初始化的时候解析，有错误直接返回
+func NewEmailSender(svc email.Service, tpls map[string]EmailTemplate) (Sender, error) {
+	parsed := make(map[string]emailTemplate, len(tpls))
+	for name, tpl := range tpls {
+		subject, err := template.New(name + ":subject").Option("missingkey=error").Parse(tpl.Subject)
+		if err != nil {
+			return nil, err
+		}
+		body, err := template.New(name + ":body").Option("missingkey=error").Parse(tpl.Body)
+		if err != nil {
+			return nil, err
+		}
+		parsed[name] = emailTemplate{
+			subject: subject,
+			body:    body,
+			params:  tpl.Params,
+		}
+	}
+	return &EmailSender{
+		svc:  svc,
+		tpls: parsed,
+	}, nil
+}
+
+func (s *EmailSender) Send(ctx context.Context, tpl string, args []string, target string) error {
+	t, ok := s.tpls[tpl]
+	if !ok {
+		return fmt.Errorf("邮件模板不存在：%s", tpl)
+	}
+	if len(t.params) != len(args) {
+		return fmt.Errorf("邮件模板参数个数不匹配：期望 %d 个，实际 %d 个", len(t.params), len(args))
+	}
+	data := make(map[string]string, len(args))
+	for i, name := range t.params {
+		data[name] = args[i]
+	}
+	var subject, body bytes.Buffer
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return err
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return err
+	}
+	return s.svc.Send(ctx, target, subject.String(), body.String())
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"geektime/webook/internal/service/email"
+	emailmocks "geektime/webook/internal/service/email/mocks"
+)
+
+func TestEmailSender_Send(t *testing.T) {
+	tpls := map[string]EmailTemplate{
+		"login_code": {
+			Subject: "webook 登录验证码",
+			Body:    "你的验证码是 {{.code}}，{{.minutes}} 分钟内有效。",
+			Params:  []string{"code", "minutes"},
+		},
+	}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) email.Service
+
+		tpl  string
+		args []string
+
+		expectedErr error
+	}{
+		{
+			name: "发送成功",
+			mock: func(ctrl *gomock.Controller) email.Service {
+				svc := emailmocks.NewMockService(ctrl)
+				svc.EXPECT().Send(gomock.Any(), "123@qq.com", "webook 登录验证码", "你的验证码是 123456，10 分钟内有效。").
+					Return(nil)
+				return svc
+			},
+			tpl:  "login_code",
+			args: []string{"123456", "10"},
+		},
+		{
+			name: "模板不存在",
+			mock: func(ctrl *gomock.Controller) email.Service {
+				return emailmocks.NewMockService(ctrl)
+			},
+			tpl:         "reset_password",
+			args:        []string{"123456", "10"},
+			expectedErr: errors.New("邮件模板不存在：reset_password"),
+		},
+		{
+			name: "参数个数不对",
+			mock: func(ctrl *gomock.Controller) email.Service {
+				return emailmocks.NewMockService(ctrl)
+			},
+			tpl:         "login_code",
+			args:        []string{"123456"},
+			expectedErr: errors.New("邮件模板参数个数不匹配：期望 2 个，实际 1 个"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			sender, err := NewEmailSender(tc.mock(ctrl), tpls)
+			require.NoError(t, err)
+			err = sender.Send(context.Background(), tc.tpl, tc.args, "123@qq.com")
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func TestNewEmailSender(t *testing.T) {
+	_, err := NewEmailSender(nil, map[string]EmailTemplate{
+		"login_code": {Subject: "{{.code", Body: "{{.code}}"},
+	})
+	assert.Error(t, err)
+}
+
+func TestRouterService_Send(t *testing.T) {
+	svc := NewService(map[Channel]Sender{})
+	err := svc.Send(context.Background(), ChannelEmail, "login_code", []string{"123456"}, "123@qq.com")
+	assert.Equal(t, ErrUnsupportedChannel, err)
+}
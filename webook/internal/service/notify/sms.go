@@ -0,0 +1,22 @@
+package notify
+
+import (
+	"context"
+
+	"geektime/webook/internal/service/sms"
+)
+
+// SMSSender 短信渠道，模板由短信的模板注册中心解析
+type SMSSender struct {
+	svc sms.Service
+}
+
+func NewSMSSender(svc sms.Service) Sender {
+	return &SMSSender{
+		svc: svc,
+	}
+}
+
+func (s *SMSSender) Send(ctx context.Context, tpl string, args []string, target string) error {
+	return s.svc.Send(ctx, tpl, args, target)
+}
@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrUnsupportedChannel = errors.New("不支持的通知渠道")
+
+// Channel 通知渠道
+type Channel string
+
+const (
+	ChannelSMS   Channel = "sms"
+	ChannelEmail Channel = "email"
+)
+
+// Service 渠道无关的通知服务
+type Service interface {
+	// Send tpl 是逻辑模板，例如 login_code，target 是手机号码或者邮箱
+	Send(ctx context.Context, channel Channel, tpl string, args []string, target string) error
+}
+
+// Sender 单个渠道的发送者
+type Sender interface {
+	Send(ctx context.Context, tpl string, args []string, target string) error
+}
+
+// RouterService 按渠道找到对应的发送者
+type RouterService struct {
+	senders map[Channel]Sender
+}
+
+func NewService(senders map[Channel]Sender) Service {
+	return &RouterService{
+		senders: senders,
+	}
+}
+
+func (s *RouterService) Send(ctx context.Context, channel Channel, tpl string, args []string, target string) error {
+	sender, ok := s.senders[channel]
+	if !ok {
+		return ErrUnsupportedChannel
+	}
+	return sender.Send(ctx, tpl, args, target)
+}
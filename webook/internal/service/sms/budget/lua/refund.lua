@@ -0,0 +1,12 @@
+-- 发送失败，把预占的费用和次数退回去
+local dayKey = KEYS[1]
+local monthKey = KEYS[2]
+local statKey = KEYS[3]
+local cost = tonumber(ARGV[1])
+local tpl = ARGV[2]
+local cnt = tonumber(ARGV[3])
+redis.call("decrby", dayKey, cost)
+redis.call("decrby", monthKey, cost)
+redis.call("hincrby", statKey, tpl .. ":cnt", -cnt)
+redis.call("hincrby", statKey, tpl .. ":cost", -cost)
+return 0
\ No newline at end of file
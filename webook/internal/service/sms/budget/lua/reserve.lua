@@ -0,0 +1,29 @@
+-- 今天、这个月的预估费用，单位是分
+local dayKey = KEYS[1]
+local monthKey = KEYS[2]
+-- 按服务商和天统计，field 是 模板:cnt 和 模板:cost
+local statKey = KEYS[3]
+local cost = tonumber(ARGV[1])
+-- 预算，0 表示不限制
+local dayBudget = tonumber(ARGV[2])
+local monthBudget = tonumber(ARGV[3])
+local tpl = ARGV[4]
+local cnt = tonumber(ARGV[5])
+local dayUsed = tonumber(redis.call("get", dayKey) or "0")
+local monthUsed = tonumber(redis.call("get", monthKey) or "0")
+if dayBudget > 0 and dayUsed + cost > dayBudget then
+    -- 超出每日预算
+    return {-1, dayUsed, monthUsed}
+elseif monthBudget > 0 and monthUsed + cost > monthBudget then
+    -- 超出每月预算
+    return {-2, dayUsed, monthUsed}
+end
+dayUsed = redis.call("incrby", dayKey, cost)
+-- 多留一天，方便对账
+redis.call("expire", dayKey, 172800)
+monthUsed = redis.call("incrby", monthKey, cost)
+redis.call("expire", monthKey, 3024000)
+redis.call("hincrby", statKey, tpl .. ":cnt", cnt)
+redis.call("hincrby", statKey, tpl .. ":cost", cost)
+redis.call("expire", statKey, 3024000)
+return {0, dayUsed, monthUsed}
\ No newline at end of file
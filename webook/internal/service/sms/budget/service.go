@@ -0,0 +1,164 @@
+package budget
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"geektime/webook/internal/service/sms"
+	"geektime/webook/pkg/redisx"
+)
+
+var (
+	ErrOverDailyBudget   = errors.New("短信超出每日预算")
+	ErrOverMonthlyBudget = errors.New("短信超出每月预算")
+)
+
+//go:embed lua/reserve.lua
+var luaReserve string
+
+//go:embed lua/refund.lua
+var luaRefund string
+
+var (
+	reserveScript = redisx.Register(luaReserve)
+	refundScript  = redisx.Register(luaRefund)
+)
+
+// Service 按预估费用控制短信开销，要直接装饰服务商的实现
+// 预算是所有服务商共享的，费用按服务商单价预估
+type Service struct {
+	svc      sms.Service
+	provider string
+	cmd      redis.Cmdable
+	// 每条短信的单价，单位是分
+	price int64
+	// 预算，单位是分，0 表示不限制
+	dailyBudget   int64
+	monthlyBudget int64
+	// 告警阈值，例如 0.8 表示用了 80% 的时候告警
+	thresholds []float64
+	notifier   Notifier
+	now        func() time.Time
+}
+
+func NewService(svc sms.Service, provider string, cmd redis.Cmdable, price int64,
+	dailyBudget, monthlyBudget int64, thresholds []float64, notifier Notifier) sms.Service {
+	return &Service{
+		svc:           svc,
+		provider:      provider,
+		cmd:           cmd,
+		price:         price,
+		dailyBudget:   dailyBudget,
+		monthlyBudget: monthlyBudget,
+		thresholds:    thresholds,
+		notifier:      notifier,
+		now:           time.Now,
+	}
+}
+
+func (s *Service) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
+	cost := s.price * int64(len(numbers))
+	keys := s.keys()
+	// 先预占，发送失败再退回去
+	res, err := reserveScript.Run(ctx, s.cmd, keys, cost, s.dailyBudget, s.monthlyBudget,
+		tplId, len(numbers)).Int64Slice()
+	if err != nil {
+		return fmt.Errorf("短信预算检查异常：%w", err)
+	}
+	if len(res) != 3 {
+		return fmt.Errorf("短信预算检查异常：脚本返回了 %d 个值", len(res))
+	}
+	switch res[0] {
+	case 0:
+	case -1:
+		return ErrOverDailyBudget
+	case -2:
+		return ErrOverMonthlyBudget
+	default:
+		return errors.New("系统错误")
+	}
+	s.alert(PeriodDay, res[1]-cost, res[1], s.dailyBudget)
+	s.alert(PeriodMonth, res[2]-cost, res[2], s.monthlyBudget)
+
+	failed, err := s.send(ctx, tplId, args, numbers)
+	if failed > 0 {
+		if er := refundScript.Run(context.WithoutCancel(ctx), s.cmd, keys,
+			s.price*int64(failed), tplId, failed).Err(); er != nil {
+			log.Println("退回短信预算失败", er)
+		}
+	}
+	return err
+}
+
+// send 返回有几个号码没有发出去，这些号码的预算要退回去。
+// 服务商能返回回执的时候只退没有受理的号码，有的号码已经受理了就是已经花了钱；
+// 拿不到回执的时候只能认为整个请求都没有发出去
+func (s *Service) send(ctx context.Context, tplId string, args []string, numbers []string) (int, error) {
+	rs, ok := s.svc.(sms.ReceiptService)
+	if !ok {
+		if err := s.svc.Send(ctx, tplId, args, numbers...); err != nil {
+			return len(numbers), err
+		}
+		return 0, nil
+	}
+	receipts, err := rs.SendWithReceipts(ctx, tplId, args, numbers...)
+	if len(receipts) != len(numbers) {
+		if err != nil {
+			return len(numbers), err
+		}
+		// 回执对不上，不知道哪些号码发出去了，宁可多算也不要少算
+		return 0, nil
+	}
+	failed := 0
+	for _, r := range receipts {
+		if !r.Ok {
+			failed++
+		}
+	}
+	if err == nil {
+		err = sms.ReceiptsError(receipts)
+	}
+	return failed, err
+}
+
+// alert 只有这一次发送越过阈值的时候才告警，预占是原子的，所以每个阈值只会告警一次
+func (s *Service) alert(period Period, before, after, budget int64) {
+	if budget <= 0 {
+		return
+	}
+	for _, threshold := range s.thresholds {
+		line := int64(float64(budget) * threshold)
+		if before < line && after >= line {
+			alert := Alert{
+				Period:    period,
+				Threshold: threshold,
+				Used:      after,
+				Budget:    budget,
+			}
+			// 不能因为告警拖慢发送，也不能用请求的 ctx
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+				defer cancel()
+				if err := s.notifier.Notify(ctx, alert); err != nil {
+					log.Println("短信预算告警失败", err)
+				}
+			}()
+		}
+	}
+}
+
+func (s *Service) keys() []string {
+	now := s.now()
+	day := now.Format("20060102")
+	return []string{
+		"sms:budget:day:" + day,
+		"sms:budget:month:" + now.Format("200601"),
+		fmt.Sprintf("sms:budget:stat:%s:%s", s.provider, day),
+	}
+}
@@ -0,0 +1,178 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"geektime/webook/internal/repository/cache/redismocks"
+	"geektime/webook/internal/service/sms"
+	smsmocks "geektime/webook/internal/service/sms/mocks"
+)
+
+type chanNotifier chan Alert
+
+func (n chanNotifier) Notify(ctx context.Context, alert Alert) error {
+	n <- alert
+	return nil
+}
+
+func TestService_Send(t *testing.T) {
+	keys := []string{"sms:budget:day:20231017", "sms:budget:month:202310", "sms:budget:stat:tencent:20231017"}
+	reserveRes := func(vals ...any) *redis.Cmd {
+		res := redis.NewCmd(context.Background())
+		res.SetVal(vals)
+		return res
+	}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (sms.Service, redis.Cmdable)
+
+		expectedErr    error
+		expectedAlerts []Alert
+	}{
+		{
+			name: "发送成功",
+			mock: func(ctrl *gomock.Controller) (sms.Service, redis.Cmdable) {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), reserveScript.Hash(), keys, []any{int64(10), int64(1000), int64(20000), "login_code", 2}).
+					Return(reserveRes(int64(0), int64(100), int64(100)))
+				svc := smsmocks.NewMockService(ctrl)
+				svc.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				return svc, cmd
+			},
+		},
+		{
+			name: "超出每日预算",
+			mock: func(ctrl *gomock.Controller) (sms.Service, redis.Cmdable) {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), reserveScript.Hash(), keys, gomock.Any()).
+					Return(reserveRes(int64(-1), int64(995), int64(995)))
+				return smsmocks.NewMockService(ctrl), cmd
+			},
+			expectedErr: ErrOverDailyBudget,
+		},
+		{
+			name: "超出每月预算",
+			mock: func(ctrl *gomock.Controller) (sms.Service, redis.Cmdable) {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), reserveScript.Hash(), keys, gomock.Any()).
+					Return(reserveRes(int64(-2), int64(10), int64(19995)))
+				return smsmocks.NewMockService(ctrl), cmd
+			},
+			expectedErr: ErrOverMonthlyBudget,
+		},
+		{
+			name: "越过每日预算的 80%，告警",
+			mock: func(ctrl *gomock.Controller) (sms.Service, redis.Cmdable) {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), reserveScript.Hash(), keys, gomock.Any()).
+					Return(reserveRes(int64(0), int64(805), int64(805)))
+				svc := smsmocks.NewMockService(ctrl)
+				svc.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				return svc, cmd
+			},
+			expectedAlerts: []Alert{{Period: PeriodDay, Threshold: 0.8, Used: 805, Budget: 1000}},
+		},
+		{
+			name: "发送失败，退回预算",
+			mock: func(ctrl *gomock.Controller) (sms.Service, redis.Cmdable) {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), reserveScript.Hash(), keys, gomock.Any()).
+					Return(reserveRes(int64(0), int64(100), int64(100)))
+				svc := smsmocks.NewMockService(ctrl)
+				svc.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("mock send err"))
+				refundRes := redis.NewCmd(context.Background())
+				refundRes.SetVal(int64(0))
+				cmd.EXPECT().EvalSha(gomock.Any(), refundScript.Hash(), keys, []any{int64(10), "login_code", 2}).Return(refundRes)
+				return svc, cmd
+			},
+			expectedErr: errors.New("mock send err"),
+		},
+		{
+			name: "部分号码没有受理，只退回没有受理的",
+			mock: func(ctrl *gomock.Controller) (sms.Service, redis.Cmdable) {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), reserveScript.Hash(), keys, gomock.Any()).
+					Return(reserveRes(int64(0), int64(100), int64(100)))
+				svc := smsmocks.NewMockReceiptService(ctrl)
+				svc.EXPECT().SendWithReceipts(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return([]sms.Receipt{{Number: "152xxx", Ok: true}, {Number: "153xxx", Msg: "LimitExceeded"}}, nil)
+				refundRes := redis.NewCmd(context.Background())
+				refundRes.SetVal(int64(0))
+				cmd.EXPECT().EvalSha(gomock.Any(), refundScript.Hash(), keys, []any{int64(5), "login_code", 1}).Return(refundRes)
+				return svc, cmd
+			},
+			expectedErr: errors.New("发送短信失败:LimitExceeded"),
+		},
+		{
+			name: "请求失败，没有回执，全部退回",
+			mock: func(ctrl *gomock.Controller) (sms.Service, redis.Cmdable) {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), reserveScript.Hash(), keys, gomock.Any()).
+					Return(reserveRes(int64(0), int64(100), int64(100)))
+				svc := smsmocks.NewMockReceiptService(ctrl)
+				svc.EXPECT().SendWithReceipts(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, errors.New("mock send err"))
+				refundRes := redis.NewCmd(context.Background())
+				refundRes.SetVal(int64(0))
+				cmd.EXPECT().EvalSha(gomock.Any(), refundScript.Hash(), keys, []any{int64(10), "login_code", 2}).Return(refundRes)
+				return svc, cmd
+			},
+			expectedErr: errors.New("mock send err"),
+		},
+		{
+			name: "脚本返回值不对",
+			mock: func(ctrl *gomock.Controller) (sms.Service, redis.Cmdable) {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), reserveScript.Hash(), keys, gomock.Any()).
+					Return(reserveRes())
+				return smsmocks.NewMockService(ctrl), cmd
+			},
+			expectedErr: errors.New("短信预算检查异常：脚本返回了 0 个值"),
+		},
+		{
+			name: "预算检查异常",
+			mock: func(ctrl *gomock.Controller) (sms.Service, redis.Cmdable) {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetErr(errors.New("mock redis err"))
+				cmd.EXPECT().EvalSha(gomock.Any(), reserveScript.Hash(), keys, gomock.Any()).Return(res)
+				return smsmocks.NewMockService(ctrl), cmd
+			},
+			expectedErr: errors.New("短信预算检查异常：mock redis err"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			notifier := make(chanNotifier, 4)
+			svc, cmd := tc.mock(ctrl)
+			s := NewService(svc, "tencent", cmd, 5, 1000, 20000, []float64{0.8}, notifier).(*Service)
+			s.now = func() time.Time {
+				return time.Date(2023, 10, 17, 8, 0, 0, 0, time.Local)
+			}
+			err := s.Send(context.Background(), "login_code", []string{"123456"}, "152xxx", "153xxx")
+			if tc.expectedErr != nil {
+				assert.EqualError(t, err, tc.expectedErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			for _, expected := range tc.expectedAlerts {
+				select {
+				case alert := <-notifier:
+					assert.Equal(t, expected, alert)
+				case <-time.After(time.Second):
+					t.Fatal("没有收到告警")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package budget
+
+import (
+	"context"
+	"log"
+)
+
+// Period 预算周期
+type Period string
+
+const (
+	PeriodDay   Period = "day"
+	PeriodMonth Period = "month"
+)
+
+// Alert 预算用量越过了某个阈值
+type Alert struct {
+	Period Period
+	// 越过的阈值，例如 0.8
+	Threshold float64
+	// 已经用掉的预估费用和预算，单位是分
+	Used   int64
+	Budget int64
+}
+
+// Notifier 告警通知，可以接短信、邮件、IM 之类的
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// LogNotifier 只输出日志
+type LogNotifier struct {
+}
+
+func (n LogNotifier) Notify(ctx context.Context, alert Alert) error {
+	log.Printf("短信%s预算已经用了 %.0f%%：%d/%d 分\n", alert.Period, alert.Threshold*100, alert.Used, alert.Budget)
+	return nil
+}
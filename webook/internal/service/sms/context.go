@@ -0,0 +1,31 @@
+package sms
+
+import (
+	"context"
+)
+
+type clientIPKey struct{}
+
+type bizKey struct{}
+
+// WithClientIP 在 ctx 里面带上发起请求的用户 IP，限流之类的装饰器会用到
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP 没有的时候返回空字符串
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// WithBiz 在 ctx 里面带上业务，例如 login
+func WithBiz(ctx context.Context, biz string) context.Context {
+	return context.WithValue(ctx, bizKey{}, biz)
+}
+
+// Biz 没有的时候返回空字符串
+func Biz(ctx context.Context) string {
+	biz, _ := ctx.Value(bizKey{}).(string)
+	return biz
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 
 	"geektime/webook/internal/service/sms"
+	"geektime/webook/internal/service/sms/memory"
 	smsmocks "geektime/webook/internal/service/sms/mocks"
+	"geektime/webook/internal/service/sms/template"
 )
 
 func TestTimeoutFailoverSMSService_Send(t *testing.T) {
@@ -101,3 +104,26 @@ func TestTimeoutFailoverSMSService_Send(t *testing.T) {
 		})
 	}
 }
+
+// 用内存发件箱模拟服务商连续超时，验证切换之后短信确实是从第二个服务商发出去的
+func TestTimeoutFailoverSMSService_SendWithOutbox(t *testing.T) {
+	tpls := template.NewMapRegistry(map[string]map[string]template.Template{
+		template.LoginCode: {memory.Provider: {Id: "login_code"}},
+	})
+	slow, backup := memory.NewService(tpls), memory.NewService(tpls)
+	slow.Delay(time.Second)
+	svc := NewTimeoutFailoverSMSService([]sms.Service{slow, backup}, 2)
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		err := svc.Send(ctx, template.LoginCode, []string{"123456"}, "152xxx")
+		cancel()
+		assert.Equal(t, context.DeadlineExceeded, err)
+	}
+	err := svc.Send(context.Background(), template.LoginCode, []string{"654321"}, "152xxx")
+	assert.NoError(t, err)
+	assert.Empty(t, slow.Messages())
+	msg, ok := backup.Last("152xxx")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"654321"}, msg.Args)
+}
@@ -0,0 +1,74 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"geektime/webook/internal/service/sms"
+	"geektime/webook/internal/service/sms/ratelimit"
+)
+
+var ErrUnauthorized = errors.New("短信网关鉴权失败")
+
+// Client 短信网关的客户端，它本身就是一个 sms.Service
+// 所以可以直接替换掉本地的 sms.Service
+type Client struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+func NewClient(addr string, token string, client *http.Client) sms.Service {
+	return &Client{
+		addr:   addr,
+		token:  token,
+		client: client,
+	}
+}
+
+func (c *Client) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
+	body, err := json.Marshal(SendReq{
+		TplId:    tplId,
+		Args:     args,
+		Numbers:  numbers,
+		Biz:      sms.Biz(ctx),
+		ClientIP: sms.ClientIP(ctx),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.addr+"/sms/send", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	default:
+		return fmt.Errorf("短信网关响应异常：%d", resp.StatusCode)
+	}
+	var res Result
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return err
+	}
+	if res.Limited != "" {
+		return &ratelimit.LimitedError{Dimension: res.Limited, RetryAfter: time.Duration(res.RetryAfter) * time.Second}
+	}
+	if res.Code != 0 {
+		return fmt.Errorf("短信网关发送失败：%d %s", res.Code, res.Msg)
+	}
+	return nil
+}
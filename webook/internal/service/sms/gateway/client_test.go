@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Send(t *testing.T) {
+	testCases := []struct {
+		name    string
+		handler http.HandlerFunc
+
+		expectedErr error
+	}{
+		{
+			name: "发送成功",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/sms/send", r.URL.Path)
+				assert.Equal(t, "Bearer my-token", r.Header.Get("Authorization"))
+				var req SendReq
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.Equal(t, SendReq{TplId: "login_code", Args: []string{"123456"}, Numbers: []string{"152xxx"}}, req)
+				_ = json.NewEncoder(w).Encode(Result{Msg: "发送成功"})
+			},
+		},
+		{
+			name: "鉴权失败",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			expectedErr: ErrUnauthorized,
+		},
+		{
+			name: "网关发送失败",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(Result{Code: 5, Msg: "系统错误"})
+			},
+			expectedErr: errors.New("短信网关发送失败：5 系统错误"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(tc.handler)
+			defer server.Close()
+
+			c := NewClient(server.URL, "my-token", server.Client())
+			err := c.Send(context.Background(), "login_code", []string{"123456"}, "152xxx")
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
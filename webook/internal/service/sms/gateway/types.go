@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"geektime/webook/internal/service/sms/ratelimit"
+)
+
+// Claims 短信网关的调用凭证
+type Claims struct {
+	jwt.RegisteredClaims
+	// 调用方，例如 webook
+	App string
+	// 允许使用的逻辑模板，例如 login_code
+	Tpls []string
+}
+
+// Allow 调用方能不能使用这个模板
+func (c Claims) Allow(tpl string) bool {
+	for _, t := range c.Tpls {
+		if t == tpl {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrNoExpiration 给其它团队的凭证没法撤销，只能靠过期时间兜底
+var ErrNoExpiration = errors.New("网关 token 必须设置过期时间")
+
+// NewToken 给调用方签发 token，必须设置过期时间，到期之前重新签发
+func NewToken(key []byte, app string, tpls []string, expiration time.Duration) (string, error) {
+	if expiration <= 0 {
+		return "", ErrNoExpiration
+	}
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
+		},
+		App:  app,
+		Tpls: tpls,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	return token.SignedString(key)
+}
+
+// SendReq 网关发送短信的请求
+type SendReq struct {
+	TplId   string   `json:"tplId"`
+	Args    []string `json:"args"`
+	Numbers []string `json:"numbers"`
+	// 调用方的业务和用户 IP，网关用来限流
+	Biz      string `json:"biz,omitempty"`
+	ClientIP string `json:"clientIp,omitempty"`
+}
+
+// Result 网关的响应
+type Result struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	// 触发了限流的时候，说明是哪个维度
+	Limited ratelimit.Dimension `json:"limited,omitempty"`
+	// 触发了限流的时候，多少秒之后可以重试
+	RetryAfter int `json:"retryAfter,omitempty"`
+}
@@ -0,0 +1,26 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewToken(t *testing.T) {
+	key := []byte("gateway-test-key")
+	_, err := NewToken(key, "webook", []string{"login_code"}, 0)
+	assert.Equal(t, ErrNoExpiration, err)
+
+	tokenStr, err := NewToken(key, "webook", []string{"login_code"}, time.Hour)
+	require.NoError(t, err)
+	claims := &Claims{}
+	_, err = jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	})
+	require.NoError(t, err)
+	require.NotNil(t, claims.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), claims.ExpiresAt.Time, time.Second)
+}
@@ -3,17 +3,154 @@ package memory
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
+
+	"geektime/webook/internal/service/sms/template"
 )
 
+// Provider 在模板注册中心里面的服务商名字
+const Provider = "memory"
+
+// defaultCapacity 发件箱最多保留多少条短信，满了之后丢掉最早的
+const defaultCapacity = 1000
+
+// Message 发出去的一条短信，一个号码一条
+type Message struct {
+	// 逻辑模板，例如 login_code
+	TplId string
+	// 解析之后的模板 ID
+	ProviderTplId string
+	Args          []string
+	Number        string
+	Time          time.Time
+}
+
+// Service 内存里面的发件箱，短信不会真的发出去，而是保存下来，
+// 测试可以查到发给某个号码的验证码，也可以注入错误和延迟。
+// 里面存的是明文的验证码，只能在开发环境和测试里面用
 type Service struct {
+	tpls template.Registry
+
+	mu   sync.RWMutex
+	msgs []Message
+	// 最多保留多少条，开发环境的进程一直跑也不会越用越多
+	capacity int
+	// 注入的错误，failTimes 次之后恢复正常，小于等于 0 表示一直失败
+	err       error
+	failTimes int
+	// 注入的延迟
+	latency time.Duration
 }
 
-func NewService() *Service {
-	return &Service{}
+func NewService(tpls template.Registry) *Service {
+	return &Service{
+		tpls:     tpls,
+		capacity: defaultCapacity,
+	}
 }
 
 func (s *Service) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
-	fmt.Printf("%v 验证码是%v\n", time.Now().Format("2006-01-02 15:04:05"), args)
+	tpl, err := s.tpls.Resolve(ctx, tplId, Provider)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	latency := s.latency
+	err = s.err
+	if s.failTimes > 0 {
+		s.failTimes--
+		if s.failTimes == 0 {
+			s.err = nil
+		}
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	for _, number := range numbers {
+		if len(s.msgs) >= s.capacity {
+			s.msgs = s.msgs[len(s.msgs)-s.capacity+1:]
+		}
+		s.msgs = append(s.msgs, Message{
+			TplId:         tplId,
+			ProviderTplId: tpl.Id,
+			Args:          args,
+			Number:        number,
+			Time:          now,
+		})
+	}
+	s.mu.Unlock()
+	fmt.Printf("%v 模板 %s 验证码是%v\n", now.Format("2006-01-02 15:04:05"), tpl.Id, args)
 	return nil
 }
+
+// Last 最后一条发给 number 的短信
+func (s *Service) Last(number string) (Message, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := len(s.msgs) - 1; i >= 0; i-- {
+		if s.msgs[i].Number == number {
+			return s.msgs[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// ByTemplate 所有用了 tplId 这个逻辑模板的短信，按发送顺序
+func (s *Service) ByTemplate(tplId string) []Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res []Message
+	for _, msg := range s.msgs {
+		if msg.TplId == tplId {
+			res = append(res, msg)
+		}
+	}
+	return res
+}
+
+// Messages 所有的短信，按发送顺序
+func (s *Service) Messages() []Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]Message, len(s.msgs))
+	copy(res, s.msgs)
+	return res
+}
+
+// FailWith 接下来 times 次发送都返回 err，times 小于等于 0 表示一直失败，直到 Reset
+func (s *Service) FailWith(err error, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+	s.failTimes = times
+}
+
+// Delay 每次发送都等待 latency，ctx 超时的时候返回 ctx.Err()
+func (s *Service) Delay(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = latency
+}
+
+// Reset 清空发件箱，去掉注入的错误和延迟
+func (s *Service) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = nil
+	s.err = nil
+	s.failTimes = 0
+	s.latency = 0
+}
@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"geektime/webook/internal/service/sms/template"
+)
+
+func newTestService() *Service {
+	return NewService(template.NewMapRegistry(map[string]map[string]template.Template{
+		template.LoginCode:     {Provider: {Id: "login_code"}},
+		template.ResetPassword: {Provider: {Id: "reset_password"}},
+	}))
+}
+
+func TestService_Outbox(t *testing.T) {
+	svc := newTestService()
+	ctx := context.Background()
+	require.NoError(t, svc.Send(ctx, template.LoginCode, []string{"111111"}, "152xxx"))
+	require.NoError(t, svc.Send(ctx, template.ResetPassword, []string{"222222"}, "152xxx", "153xxx"))
+	require.NoError(t, svc.Send(ctx, template.LoginCode, []string{"333333"}, "153xxx"))
+
+	msg, ok := svc.Last("152xxx")
+	assert.True(t, ok)
+	assert.Equal(t, template.ResetPassword, msg.TplId)
+	assert.Equal(t, []string{"222222"}, msg.Args)
+
+	msg, ok = svc.Last("153xxx")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"333333"}, msg.Args)
+
+	_, ok = svc.Last("154xxx")
+	assert.False(t, ok)
+
+	assert.Len(t, svc.ByTemplate(template.LoginCode), 2)
+	assert.Len(t, svc.Messages(), 4)
+
+	// 模板不存在
+	err := svc.Send(ctx, "unknown", nil, "152xxx")
+	assert.True(t, errors.Is(err, template.ErrTemplateNotFound))
+
+	svc.Reset()
+	assert.Empty(t, svc.Messages())
+}
+
+func TestService_Capacity(t *testing.T) {
+	svc := newTestService()
+	svc.capacity = 3
+	ctx := context.Background()
+	for _, code := range []string{"111111", "222222", "333333", "444444", "555555"} {
+		require.NoError(t, svc.Send(ctx, template.LoginCode, []string{code}, "152xxx"))
+	}
+	msgs := svc.Messages()
+	// 只保留最近的几条
+	require.Len(t, msgs, 3)
+	assert.Equal(t, []string{"333333"}, msgs[0].Args)
+	assert.Equal(t, []string{"555555"}, msgs[2].Args)
+}
+
+func TestService_FailWith(t *testing.T) {
+	svc := newTestService()
+	ctx := context.Background()
+	mockErr := errors.New("mock send err")
+
+	svc.FailWith(mockErr, 2)
+	assert.Equal(t, mockErr, svc.Send(ctx, template.LoginCode, []string{"123456"}, "152xxx"))
+	assert.Equal(t, mockErr, svc.Send(ctx, template.LoginCode, []string{"123456"}, "152xxx"))
+	assert.NoError(t, svc.Send(ctx, template.LoginCode, []string{"123456"}, "152xxx"))
+	assert.Len(t, svc.Messages(), 1)
+
+	svc.FailWith(mockErr, 0)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, mockErr, svc.Send(ctx, template.LoginCode, []string{"123456"}, "152xxx"))
+	}
+	svc.Reset()
+	assert.NoError(t, svc.Send(ctx, template.LoginCode, []string{"123456"}, "152xxx"))
+}
+
+func TestService_Delay(t *testing.T) {
+	svc := newTestService()
+	svc.Delay(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	err := svc.Send(ctx, template.LoginCode, []string{"123456"}, "152xxx")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Empty(t, svc.Messages())
+}
+
+func TestService_Concurrent(t *testing.T) {
+	svc := newTestService()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = svc.Send(context.Background(), template.LoginCode, []string{"123456"}, "152xxx")
+			svc.Last("152xxx")
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, svc.Messages(), 100)
+}
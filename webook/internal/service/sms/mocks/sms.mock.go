@@ -10,6 +10,7 @@ package smsmocks
 
 import (
 	context "context"
+	sms "geektime/webook/internal/service/sms"
 	reflect "reflect"
 
 	gomock "go.uber.org/mock/gomock"
@@ -56,3 +57,65 @@ func (mr *MockServiceMockRecorder) Send(ctx, tplId, args any, numbers ...any) *g
 	varargs := append([]any{ctx, tplId, args}, numbers...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockService)(nil).Send), varargs...)
 }
+
+// MockReceiptService is a mock of ReceiptService interface.
+type MockReceiptService struct {
+	ctrl     *gomock.Controller
+	recorder *MockReceiptServiceMockRecorder
+}
+
+// MockReceiptServiceMockRecorder is the mock recorder for MockReceiptService.
+type MockReceiptServiceMockRecorder struct {
+	mock *MockReceiptService
+}
+
+// NewMockReceiptService creates a new mock instance.
+func NewMockReceiptService(ctrl *gomock.Controller) *MockReceiptService {
+	mock := &MockReceiptService{ctrl: ctrl}
+	mock.recorder = &MockReceiptServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReceiptService) EXPECT() *MockReceiptServiceMockRecorder {
+	return m.recorder
+}
+
+// Send mocks base method.
+func (m *MockReceiptService) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, tplId, args}
+	for _, a := range numbers {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Send", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Send indicates an expected call of Send.
+func (mr *MockReceiptServiceMockRecorder) Send(ctx, tplId, args any, numbers ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, tplId, args}, numbers...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockReceiptService)(nil).Send), varargs...)
+}
+
+// SendWithReceipts mocks base method.
+func (m *MockReceiptService) SendWithReceipts(ctx context.Context, tplId string, args []string, numbers ...string) ([]sms.Receipt, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, tplId, args}
+	for _, a := range numbers {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "SendWithReceipts", varargs...)
+	ret0, _ := ret[0].([]sms.Receipt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SendWithReceipts indicates an expected call of SendWithReceipts.
+func (mr *MockReceiptServiceMockRecorder) SendWithReceipts(ctx, tplId, args any, numbers ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, tplId, args}, numbers...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendWithReceipts", reflect.TypeOf((*MockReceiptService)(nil).SendWithReceipts), varargs...)
+}
@@ -3,40 +3,91 @@ package ratelimit
 import (
 	"context"
 	"fmt"
+	"log"
 
 	"geektime/webook/internal/service/sms"
 	"geektime/webook/pkg/ratelimit"
 )
 
-var errLimited = fmt.Errorf("短信服务触发限流")
-
 type RatelimitSMSService struct {
-	svc     sms.Service
-	limiter ratelimit.Limiter
+	svc sms.Service
+	// 按维度从粗到细检查，见 Dimension.rank
+	rules *Rules
+}
+
+func NewRatelimitSMSService(svc sms.Service, rules ...Rule) sms.Service {
+	return NewReloadableRatelimitSMSService(svc, NewRules(rules...))
 }
 
-func NewRatelimitSMSService(svc sms.Service, limiter ratelimit.Limiter) sms.Service {
+// NewReloadableRatelimitSMSService 调用方持有 rules，可以在运行时替换规则
+func NewReloadableRatelimitSMSService(svc sms.Service, rules *Rules) sms.Service {
 	return &RatelimitSMSService{
-		svc:     svc,
-		limiter: limiter,
+		svc:   svc,
+		rules: rules,
 	}
 }
 
 func (s *RatelimitSMSService) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
-	// 这里加一些代码，新特性
-	limit, err := s.limiter.Limit(ctx, "sms:tencent")
-	if err != nil {
-		/*
-			系统错误，要不要限流呢？
-			可以限流：保守策略，你的下游很坑的时候
-			可以不限流：你的下有很强，业务可用性要求很高，尽量容错策略
-		*/
-		return fmt.Errorf("短信服务判断是否限流异常：%w", err)
+	// 已经放行的规则，后面拒绝了或者没发出去要把计数退回去
+	var granted []grant
+	for _, rule := range s.rules.Get() {
+		for _, key := range s.keys(ctx, rule.Dimension, numbers) {
+			d, err := rule.Limiter.Allow(ctx, key)
+			if err != nil {
+				s.refund(ctx, granted)
+				// 出错了要不要限流由 Rule 的 Limiter 决定，见 ratelimit.FailSafeLimiter，
+				// 走到这里说明没有配置降级策略
+				return fmt.Errorf("短信服务判断是否限流异常：%w", err)
+			}
+			if !d.Allowed {
+				s.refund(ctx, granted)
+				return &LimitedError{Dimension: rule.Dimension, RetryAfter: d.RetryAfter}
+			}
+			granted = append(granted, grant{limiter: rule.Limiter, key: key, decision: d})
+		}
 	}
-	if limit {
-		return errLimited
+	err := s.svc.Send(ctx, tplId, args, numbers...)
+	if err != nil {
+		s.refund(ctx, granted)
 	}
-	err = s.svc.Send(ctx, tplId, args, numbers...)
-	// 这里也可以加一些代码，新特性
 	return err
 }
+
+type grant struct {
+	limiter  ratelimit.Limiter
+	key      string
+	decision ratelimit.Decision
+}
+
+// refund 请求可能已经被取消了，退回计数不能跟着失败
+func (s *RatelimitSMSService) refund(ctx context.Context, granted []grant) {
+	ctx = context.WithoutCancel(ctx)
+	for _, g := range granted {
+		if err := ratelimit.Refund(ctx, g.limiter, g.key, g.decision); err != nil {
+			log.Println("退回短信限流计数失败", g.key, err)
+		}
+	}
+}
+
+// keys ctx 里面没有 IP 或者业务的时候，对应的维度就不限流
+func (s *RatelimitSMSService) keys(ctx context.Context, dimension Dimension, numbers []string) []string {
+	switch dimension {
+	case DimensionPhone:
+		keys := make([]string, 0, len(numbers))
+		for _, number := range numbers {
+			keys = append(keys, "sms:phone:"+number)
+		}
+		return keys
+	case DimensionIP:
+		if ip := sms.ClientIP(ctx); ip != "" {
+			return []string{"sms:ip:" + ip}
+		}
+	case DimensionBiz:
+		if biz := sms.Biz(ctx); biz != "" {
+			return []string{"sms:biz:" + biz}
+		}
+	case DimensionGlobal:
+		return []string{"sms:global"}
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
@@ -18,40 +19,175 @@ import (
 func TestRatelimitSMSService_Send(t *testing.T) {
 	testCases := []struct {
 		name string
-		mock func(ctrl *gomock.Controller) (sms.Service, ratelimit.Limiter)
+		mock func(ctrl *gomock.Controller) (sms.Service, []Rule)
 
-		// 因为这边测试限流，输入什么不用管
+		ctx context.Context
 
 		expectedErr error
 	}{
 		{
 			name: "正常发送",
-			mock: func(ctrl *gomock.Controller) (sms.Service, ratelimit.Limiter) {
+			mock: func(ctrl *gomock.Controller) (sms.Service, []Rule) {
 				svc := smsmocks.NewMockService(ctrl)
 				limiter := limitmocks.NewMockLimiter(ctrl)
-				limiter.EXPECT().Limit(gomock.Any(), gomock.Any()).Return(false, nil)
+				limiter.EXPECT().Allow(gomock.Any(), "sms:global").Return(ratelimit.Decision{Allowed: true}, nil)
 				svc.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
-				return svc, limiter
+				return svc, []Rule{{Dimension: DimensionGlobal, Limiter: limiter}}
 			},
+			ctx:         context.Background(),
 			expectedErr: nil,
 		},
 		{
 			name: "限流异常",
-			mock: func(ctrl *gomock.Controller) (sms.Service, ratelimit.Limiter) {
+			mock: func(ctrl *gomock.Controller) (sms.Service, []Rule) {
 				limiter := limitmocks.NewMockLimiter(ctrl)
-				limiter.EXPECT().Limit(gomock.Any(), gomock.Any()).Return(false, errors.New("mock limit err"))
-				return nil, limiter
+				limiter.EXPECT().Allow(gomock.Any(), gomock.Any()).Return(ratelimit.Decision{}, errors.New("mock limit err"))
+				return nil, []Rule{{Dimension: DimensionGlobal, Limiter: limiter}}
 			},
+			ctx:         context.Background(),
 			expectedErr: fmt.Errorf("短信服务判断是否限流异常：%w", errors.New("mock limit err")),
 		},
 		{
-			name: "触发限流",
-			mock: func(ctrl *gomock.Controller) (sms.Service, ratelimit.Limiter) {
+			name: "触发全局限流",
+			mock: func(ctrl *gomock.Controller) (sms.Service, []Rule) {
 				limiter := limitmocks.NewMockLimiter(ctrl)
-				limiter.EXPECT().Limit(gomock.Any(), gomock.Any()).Return(true, nil)
-				return nil, limiter
+				limiter.EXPECT().Allow(gomock.Any(), gomock.Any()).Return(ratelimit.Decision{RetryAfter: time.Minute}, nil)
+				return nil, []Rule{{Dimension: DimensionGlobal, Limiter: limiter}}
 			},
-			expectedErr: errLimited,
+			ctx:         context.Background(),
+			expectedErr: &LimitedError{Dimension: DimensionGlobal, RetryAfter: time.Minute},
+		},
+		{
+			name: "每个号码单独限流",
+			mock: func(ctrl *gomock.Controller) (sms.Service, []Rule) {
+				limiter := limitmocks.NewMockLimiter(ctrl)
+				limiter.EXPECT().Allow(gomock.Any(), "sms:phone:152xxx").Return(ratelimit.Decision{Allowed: true}, nil)
+				limiter.EXPECT().Allow(gomock.Any(), "sms:phone:153xxx").Return(ratelimit.Decision{RetryAfter: time.Minute}, nil)
+				return nil, []Rule{{Dimension: DimensionPhone, Limiter: limiter}}
+			},
+			ctx:         context.Background(),
+			expectedErr: &LimitedError{Dimension: DimensionPhone, RetryAfter: time.Minute},
+		},
+		{
+			name: "触发 IP 限流，不占用号码的配额",
+			mock: func(ctrl *gomock.Controller) (sms.Service, []Rule) {
+				// 没有设置预期，调用了就会失败
+				phoneLimiter := limitmocks.NewMockLimiter(ctrl)
+				ipLimiter := limitmocks.NewMockLimiter(ctrl)
+				ipLimiter.EXPECT().Allow(gomock.Any(), "sms:ip:127.0.0.1").Return(ratelimit.Decision{RetryAfter: time.Minute}, nil)
+				globalLimiter := limitmocks.NewMockLimiter(ctrl)
+				globalLimiter.EXPECT().Allow(gomock.Any(), "sms:global").Return(ratelimit.Decision{Allowed: true}, nil)
+				return nil, []Rule{
+					{Dimension: DimensionPhone, Limiter: phoneLimiter},
+					{Dimension: DimensionIP, Limiter: ipLimiter},
+					{Dimension: DimensionGlobal, Limiter: globalLimiter},
+				}
+			},
+			ctx:         sms.WithClientIP(context.Background(), "127.0.0.1"),
+			expectedErr: &LimitedError{Dimension: DimensionIP, RetryAfter: time.Minute},
+		},
+		{
+			name: "触发全局限流，不占用号码和 IP 的配额",
+			mock: func(ctrl *gomock.Controller) (sms.Service, []Rule) {
+				globalLimiter := limitmocks.NewMockLimiter(ctrl)
+				globalLimiter.EXPECT().Allow(gomock.Any(), "sms:global").Return(ratelimit.Decision{RetryAfter: time.Minute}, nil)
+				return nil, []Rule{
+					{Dimension: DimensionPhone, Limiter: limitmocks.NewMockLimiter(ctrl)},
+					{Dimension: DimensionIP, Limiter: limitmocks.NewMockLimiter(ctrl)},
+					{Dimension: DimensionGlobal, Limiter: globalLimiter},
+				}
+			},
+			ctx:         sms.WithClientIP(context.Background(), "127.0.0.1"),
+			expectedErr: &LimitedError{Dimension: DimensionGlobal, RetryAfter: time.Minute},
+		},
+		{
+			name: "触发业务限流",
+			mock: func(ctrl *gomock.Controller) (sms.Service, []Rule) {
+				limiter := limitmocks.NewMockLimiter(ctrl)
+				limiter.EXPECT().Allow(gomock.Any(), "sms:biz:login").Return(ratelimit.Decision{RetryAfter: time.Minute}, nil)
+				return nil, []Rule{{Dimension: DimensionBiz, Limiter: limiter}}
+			},
+			ctx:         sms.WithBiz(context.Background(), "login"),
+			expectedErr: &LimitedError{Dimension: DimensionBiz, RetryAfter: time.Minute},
+		},
+		{
+			name: "ctx 里面没有 IP 和业务，不限流",
+			mock: func(ctrl *gomock.Controller) (sms.Service, []Rule) {
+				svc := smsmocks.NewMockService(ctrl)
+				svc.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				return svc, []Rule{
+					{Dimension: DimensionIP, Limiter: limitmocks.NewMockLimiter(ctrl)},
+					{Dimension: DimensionBiz, Limiter: limitmocks.NewMockLimiter(ctrl)},
+				}
+			},
+			ctx:         context.Background(),
+			expectedErr: nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc, rules := tc.mock(ctrl)
+			limitSvc := NewRatelimitSMSService(svc, rules...)
+			err := limitSvc.Send(tc.ctx, "mytpl", []string{"123"}, "152xxx", "153xxx")
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func TestRules_Set(t *testing.T) {
+	rules := NewRules()
+	// 规则源里面按名字排序，重新加载之后也要从粗到细检查
+	rules.Set(
+		Rule{Dimension: DimensionBiz},
+		Rule{Dimension: DimensionGlobal},
+		Rule{Dimension: DimensionIP},
+		Rule{Dimension: DimensionPhone},
+	)
+	dimensions := make([]Dimension, 0, 4)
+	for _, r := range rules.Get() {
+		dimensions = append(dimensions, r.Dimension)
+	}
+	assert.Equal(t, []Dimension{DimensionGlobal, DimensionBiz, DimensionIP, DimensionPhone}, dimensions)
+}
+
+func TestRatelimitSMSService_Refund(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) sms.Service
+		// 之前已经给这个号码发过几条了
+		sent int
+
+		expectedErr error
+		// 发完之后全局还剩多少配额
+		expectedGlobalRemaining int
+		// 发完之后这个号码还剩多少配额
+		expectedPhoneRemaining int
+	}{
+		{
+			name: "号码限流，退回全局的配额",
+			mock: func(ctrl *gomock.Controller) sms.Service {
+				svc := smsmocks.NewMockService(ctrl)
+				svc.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2)
+				return svc
+			},
+			sent:                    2,
+			expectedErr:             &LimitedError{Dimension: DimensionPhone},
+			expectedGlobalRemaining: 1,
+			expectedPhoneRemaining:  0,
+		},
+		{
+			name: "发送失败，都退回去",
+			mock: func(ctrl *gomock.Controller) sms.Service {
+				svc := smsmocks.NewMockService(ctrl)
+				svc.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("mock send err"))
+				return svc
+			},
+			expectedErr:             errors.New("mock send err"),
+			expectedGlobalRemaining: 3,
+			expectedPhoneRemaining:  1,
 		},
 	}
 	for _, tc := range testCases {
@@ -59,10 +195,31 @@ func TestRatelimitSMSService_Send(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			limitSvc := NewRatelimitSMSService(tc.mock(ctrl))
-			err := limitSvc.Send(context.Background(), "mytpl", []string{"123"}, "152xxx")
-			fmt.Printf("%+v\n", err)
+			// 一个小时才补充一个令牌，测试期间可以认为不会补充
+			global := ratelimit.NewLocalTokenBucketLimiter(time.Hour, 1, 4)
+			phone := ratelimit.NewLocalTokenBucketLimiter(time.Hour, 1, 2)
+			limitSvc := NewRatelimitSMSService(tc.mock(ctrl),
+				Rule{Dimension: DimensionGlobal, Limiter: global},
+				Rule{Dimension: DimensionPhone, Limiter: phone},
+			)
+			ctx := context.Background()
+			for i := 0; i < tc.sent; i++ {
+				err := limitSvc.Send(ctx, "mytpl", []string{"123"}, "152xxx")
+				assert.NoError(t, err)
+			}
+			err := limitSvc.Send(ctx, "mytpl", []string{"123"}, "152xxx")
+			if le, ok := err.(*LimitedError); ok {
+				le.RetryAfter = 0
+			}
 			assert.Equal(t, tc.expectedErr, err)
+
+			// 再拿一个令牌看看还剩多少
+			d, err := global.Allow(ctx, "sms:global")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedGlobalRemaining, d.Remaining)
+			d, err = phone.Allow(ctx, "sms:phone:152xxx")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPhoneRemaining, d.Remaining)
 		})
 	}
 }
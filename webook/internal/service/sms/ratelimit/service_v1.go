@@ -14,8 +14,8 @@ type RatelimitSMsServiceV1 struct {
 }
 
 func NewRatelimitSMsServiceV1(svc sms.Service, limiter ratelimit.Limiter) sms.Service {
-	return &RatelimitSMSService{
-		svc:     svc,
+	return &RatelimitSMsServiceV1{
+		Service: svc,
 		limiter: limiter,
 	}
 }
@@ -32,7 +32,7 @@ func (s *RatelimitSMsServiceV1) Send(ctx context.Context, tplId string, args []s
 		return fmt.Errorf("短信服务判断是否限流异常：%w", err)
 	}
 	if limit {
-		return errLimited
+		return &LimitedError{Dimension: DimensionGlobal}
 	}
 	err = s.Service.Send(ctx, tplId, args, numbers...)
 	// 这里也可以加一些代码，新特性
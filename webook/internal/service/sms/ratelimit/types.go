@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"geektime/webook/pkg/ratelimit"
+)
+
+// Dimension 限流的维度
+type Dimension string
+
+const (
+	// DimensionPhone 每个手机号码
+	DimensionPhone Dimension = "phone"
+	// DimensionIP 每个用户 IP，IP 从 ctx 里面拿
+	DimensionIP Dimension = "ip"
+	// DimensionBiz 每个业务，业务从 ctx 里面拿
+	DimensionBiz Dimension = "biz"
+	// DimensionGlobal 整个短信服务
+	DimensionGlobal Dimension = "global"
+)
+
+// rank 检查的顺序，从粗到细。限流器放行的时候就已经计数了，后面的规则拒绝的时候，
+// 前面放行的会退回去（见 ratelimit.Refunder），不支持退回的限流器还是会占用配额。
+// 所以每个号码的规则放在最后，攻击者不能不发短信就用掉别人的号码的配额
+func (d Dimension) rank() int {
+	switch d {
+	case DimensionGlobal:
+		return 0
+	case DimensionBiz:
+		return 1
+	case DimensionIP:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// Rule 一个维度一条规则，窗口大小、阈值和出错的时候怎么办都由 Limiter 决定
+type Rule struct {
+	Dimension Dimension
+	Limiter   ratelimit.Limiter
+}
+
+// Rules 一组可以在运行时整体替换的规则
+type Rules struct {
+	rules atomic.Pointer[[]Rule]
+}
+
+func NewRules(rules ...Rule) *Rules {
+	r := &Rules{}
+	r.Set(rules...)
+	return r
+}
+
+// Set 原子地替换所有规则，正在发送的短信还是用旧的规则。
+// 不管传进来是什么顺序，都按照维度从粗到细检查
+func (r *Rules) Set(rules ...Rule) {
+	sorted := make([]Rule, len(rules))
+	copy(sorted, rules)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Dimension.rank() < sorted[j].Dimension.rank()
+	})
+	r.rules.Store(&sorted)
+}
+
+func (r *Rules) Get() []Rule {
+	return *r.rules.Load()
+}
+
+// LimitedError 触发了哪个维度的限流
+type LimitedError struct {
+	Dimension Dimension
+	// 多久之后可以重试，由规则的窗口决定，0 就是不知道
+	RetryAfter time.Duration
+}
+
+func (e *LimitedError) Error() string {
+	return fmt.Sprintf("短信服务触发限流：%s", e.Dimension)
+}
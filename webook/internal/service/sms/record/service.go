@@ -0,0 +1,81 @@
+package record
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"geektime/webook/internal/domain"
+	"geektime/webook/internal/repository"
+	"geektime/webook/internal/service/sms"
+)
+
+var _ sms.ReceiptService = (*Service)(nil)
+
+// Service 记录每一次发送，要直接装饰服务商的实现，
+// 这样才知道是哪个服务商，才能拿到服务商的流水号
+type Service struct {
+	svc      sms.Service
+	provider string
+	repo     repository.SMSRecordRepository
+}
+
+func NewService(svc sms.Service, provider string, repo repository.SMSRecordRepository) sms.Service {
+	return &Service{
+		svc:      svc,
+		provider: provider,
+		repo:     repo,
+	}
+}
+
+func (s *Service) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
+	receipts, err := s.SendWithReceipts(ctx, tplId, args, numbers...)
+	if err != nil {
+		return err
+	}
+	return sms.ReceiptsError(receipts)
+}
+
+// SendWithReceipts 把服务商的回执继续往上传，预算要按照没有受理的号码退回去。
+// 被装饰的服务不能返回回执的时候，回执是 nil
+func (s *Service) SendWithReceipts(ctx context.Context, tplId string, args []string, numbers ...string) ([]sms.Receipt, error) {
+	start := time.Now()
+	var (
+		receipts []sms.Receipt
+		err      error
+	)
+	if rs, ok := s.svc.(sms.ReceiptService); ok {
+		receipts, err = rs.SendWithReceipts(ctx, tplId, args, numbers...)
+	} else {
+		err = s.svc.Send(ctx, tplId, args, numbers...)
+	}
+	latency := time.Since(start)
+
+	records := make([]domain.SMSRecord, 0, len(numbers))
+	for i, number := range numbers {
+		r := domain.SMSRecord{
+			Provider: s.provider,
+			TplId:    tplId,
+			Phone:    number,
+			Status:   domain.SMSStatusAccepted,
+			Latency:  latency,
+		}
+		switch {
+		case err != nil:
+			r.Status = domain.SMSStatusFailed
+			r.Msg = err.Error()
+		case len(receipts) == len(numbers):
+			r.RequestId = receipts[i].RequestId
+			if !receipts[i].Ok {
+				r.Status = domain.SMSStatusFailed
+				r.Msg = receipts[i].Msg
+			}
+		}
+		records = append(records, r)
+	}
+	// 记录失败不能影响发送，只输出日志
+	if er := s.repo.Create(ctx, records); er != nil {
+		log.Println("保存短信发送记录失败", er)
+	}
+	return receipts, err
+}
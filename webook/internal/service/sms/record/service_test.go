@@ -0,0 +1,97 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"geektime/webook/internal/domain"
+	"geektime/webook/internal/repository"
+	repomocks "geektime/webook/internal/repository/mocks"
+	"geektime/webook/internal/service/sms"
+	smsmocks "geektime/webook/internal/service/sms/mocks"
+)
+
+func TestService_Send(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (sms.Service, repository.SMSRecordRepository)
+
+		expectedErr error
+	}{
+		{
+			name: "服务商受理，记录流水号",
+			mock: func(ctrl *gomock.Controller) (sms.Service, repository.SMSRecordRepository) {
+				svc := smsmocks.NewMockReceiptService(ctrl)
+				svc.EXPECT().SendWithReceipts(gomock.Any(), "login_code", []string{"123456"}, "15212345678").
+					Return([]sms.Receipt{{Number: "15212345678", RequestId: "sid-1", Ok: true}}, nil)
+				repo := repomocks.NewMockSMSRecordRepository(ctrl)
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, rs []domain.SMSRecord) error {
+						assert.Len(t, rs, 1)
+						assert.Equal(t, "tencent", rs[0].Provider)
+						assert.Equal(t, "sid-1", rs[0].RequestId)
+						assert.Equal(t, domain.SMSStatusAccepted, rs[0].Status)
+						return nil
+					})
+				return svc, repo
+			},
+		},
+		{
+			name: "服务商没有受理",
+			mock: func(ctrl *gomock.Controller) (sms.Service, repository.SMSRecordRepository) {
+				svc := smsmocks.NewMockReceiptService(ctrl)
+				svc.EXPECT().SendWithReceipts(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return([]sms.Receipt{{Number: "15212345678", RequestId: "sid-1", Msg: "LimitExceeded"}}, nil)
+				repo := repomocks.NewMockSMSRecordRepository(ctrl)
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, rs []domain.SMSRecord) error {
+						assert.Equal(t, domain.SMSStatusFailed, rs[0].Status)
+						return nil
+					})
+				return svc, repo
+			},
+			expectedErr: errors.New("发送短信失败:LimitExceeded"),
+		},
+		{
+			name: "发送失败，记录也失败",
+			mock: func(ctrl *gomock.Controller) (sms.Service, repository.SMSRecordRepository) {
+				svc := smsmocks.NewMockService(ctrl)
+				svc.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(errors.New("mock send err"))
+				repo := repomocks.NewMockSMSRecordRepository(ctrl)
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, rs []domain.SMSRecord) error {
+						assert.Equal(t, domain.SMSStatusFailed, rs[0].Status)
+						assert.Equal(t, "mock send err", rs[0].Msg)
+						return errors.New("mock db err")
+					})
+				return svc, repo
+			},
+			expectedErr: errors.New("mock send err"),
+		},
+		{
+			name: "记录失败不影响发送",
+			mock: func(ctrl *gomock.Controller) (sms.Service, repository.SMSRecordRepository) {
+				svc := smsmocks.NewMockService(ctrl)
+				svc.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				repo := repomocks.NewMockSMSRecordRepository(ctrl)
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(errors.New("mock db err"))
+				return svc, repo
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc, repo := tc.mock(ctrl)
+			err := NewService(svc, "tencent", repo).Send(context.Background(), "login_code", []string{"123456"}, "15212345678")
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// 逻辑模板，业务方只认这些名字，不认具体服务商的模板 ID
+const (
+	LoginCode     = "login_code"
+	ResetPassword = "reset_password"
+)
+
+var (
+	ErrTemplateNotFound = errors.New("短信模板不存在")
+	ErrParamsMismatch   = errors.New("短信模板参数个数不匹配")
+)
+
+// ParamFormat 服务商的模板参数格式
+type ParamFormat uint8
+
+const (
+	// ParamPositional 按位置传参，例如腾讯云 {1} {2}
+	ParamPositional ParamFormat = iota
+	// ParamNamed 按名字传参，例如阿里云 ${code}
+	ParamNamed
+)
+
+// Template 某个逻辑模板在某个服务商上的具体配置
+type Template struct {
+	// 服务商那边的模板 ID
+	Id string
+	// 签名，为空的时候用服务商自己的默认签名
+	SignName string
+	Format   ParamFormat
+	// 参数名，按顺序和 args 一一对应，ParamNamed 的时候必须有
+	ParamNames []string
+}
+
+// Positional 把 args 转成按位置传参
+func (t Template) Positional(args []string) ([]string, error) {
+	if len(t.ParamNames) > 0 && len(t.ParamNames) != len(args) {
+		return nil, fmt.Errorf("%w: 期望 %d 个，实际 %d 个", ErrParamsMismatch, len(t.ParamNames), len(args))
+	}
+	return args, nil
+}
+
+// Named 把 args 转成按名字传参
+func (t Template) Named(args []string) (map[string]string, error) {
+	if len(t.ParamNames) != len(args) {
+		return nil, fmt.Errorf("%w: 期望 %d 个，实际 %d 个", ErrParamsMismatch, len(t.ParamNames), len(args))
+	}
+	res := make(map[string]string, len(args))
+	for i, name := range t.ParamNames {
+		res[name] = args[i]
+	}
+	return res, nil
+}
+
+// Registry 模板注册中心
+// 所有的 sms.Service 实现都通过它把逻辑模板解析成自己的模板
+type Registry interface {
+	// Resolve tpl 是逻辑模板，例如 LoginCode，provider 是服务商，例如 tencent
+	Resolve(ctx context.Context, tpl, provider string) (Template, error)
+}
+
+// MapRegistry 基于配置的注册中心，初始化之后只读，所以不需要加锁
+type MapRegistry struct {
+	// 逻辑模板 => 服务商 => 模板
+	tpls map[string]map[string]Template
+}
+
+func NewMapRegistry(tpls map[string]map[string]Template) Registry {
+	return &MapRegistry{
+		tpls: tpls,
+	}
+}
+
+func (r *MapRegistry) Resolve(ctx context.Context, tpl, provider string) (Template, error) {
+	t, ok := r.tpls[tpl][provider]
+	if !ok {
+		return Template{}, fmt.Errorf("%w: %s %s", ErrTemplateNotFound, provider, tpl)
+	}
+	return t, nil
+}
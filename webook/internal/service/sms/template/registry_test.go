@@ -0,0 +1,72 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapRegistry_Resolve(t *testing.T) {
+	r := NewMapRegistry(map[string]map[string]Template{
+		LoginCode: {
+			"tencent": {Id: "1877556", ParamNames: []string{"code"}},
+			"aliyun":  {Id: "SMS_001", SignName: "webook", Format: ParamNamed, ParamNames: []string{"code"}},
+		},
+	})
+	testCases := []struct {
+		name     string
+		tpl      string
+		provider string
+
+		expectedTpl Template
+		expectedErr error
+	}{
+		{
+			name:        "按位置传参的模板",
+			tpl:         LoginCode,
+			provider:    "tencent",
+			expectedTpl: Template{Id: "1877556", ParamNames: []string{"code"}},
+		},
+		{
+			name:        "按名字传参的模板",
+			tpl:         LoginCode,
+			provider:    "aliyun",
+			expectedTpl: Template{Id: "SMS_001", SignName: "webook", Format: ParamNamed, ParamNames: []string{"code"}},
+		},
+		{
+			name:        "服务商没有配置这个模板",
+			tpl:         LoginCode,
+			provider:    "memory",
+			expectedErr: ErrTemplateNotFound,
+		},
+		{
+			name:        "逻辑模板不存在",
+			tpl:         ResetPassword,
+			provider:    "tencent",
+			expectedErr: ErrTemplateNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tpl, err := r.Resolve(context.Background(), tc.tpl, tc.provider)
+			assert.True(t, errors.Is(err, tc.expectedErr))
+			assert.Equal(t, tc.expectedTpl, tpl)
+		})
+	}
+}
+
+func TestTemplate_Params(t *testing.T) {
+	tpl := Template{Format: ParamNamed, ParamNames: []string{"code", "minutes"}}
+	named, err := tpl.Named([]string{"123456", "10"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"code": "123456", "minutes": "10"}, named)
+
+	_, err = tpl.Named([]string{"123456"})
+	assert.True(t, errors.Is(err, ErrParamsMismatch))
+
+	positional, err := tpl.Positional([]string{"123456", "10"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"123456", "10"}, positional)
+}
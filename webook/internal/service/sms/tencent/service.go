@@ -8,43 +8,80 @@ import (
 	"github.com/ecodeclub/ekit/slice"
 	sms "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/sms/v20210111"
 
+	smssvc "geektime/webook/internal/service/sms"
+	"geektime/webook/internal/service/sms/template"
 	"geektime/webook/pkg/ratelimit"
 )
 
+var _ smssvc.ReceiptService = (*Service)(nil)
+
+// Provider 在模板注册中心里面的服务商名字
+const Provider = "tencent"
+
 type Service struct {
 	appId    *string
 	signName *string
 	client   *sms.Client
 	limiter  ratelimit.Limiter
+	tpls     template.Registry
 }
 
-func NewService(appId string, signName string, client *sms.Client, limiter ratelimit.Limiter) *Service {
+func NewService(appId string, signName string, client *sms.Client, limiter ratelimit.Limiter,
+	tpls template.Registry) *Service {
 	return &Service{
 		appId:    ekit.ToPtr[string](appId),
 		signName: ekit.ToPtr[string](signName),
 		client:   client,
 		limiter:  limiter,
+		tpls:     tpls,
 	}
 }
 
+// Send tplId 是逻辑模板，会先通过模板注册中心解析成腾讯云的模板
 func (s *Service) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
+	receipts, err := s.SendWithReceipts(ctx, tplId, args, numbers...)
+	if err != nil {
+		return err
+	}
+	return smssvc.ReceiptsError(receipts)
+}
+
+func (s *Service) SendWithReceipts(ctx context.Context, tplId string, args []string, numbers ...string) ([]smssvc.Receipt, error) {
+	tpl, err := s.tpls.Resolve(ctx, tplId, Provider)
+	if err != nil {
+		return nil, err
+	}
+	// 腾讯云只支持按位置传参
+	if tpl.Format != template.ParamPositional {
+		return nil, fmt.Errorf("腾讯云不支持的模板参数格式：%d", tpl.Format)
+	}
+	params, err := tpl.Positional(args)
+	if err != nil {
+		return nil, err
+	}
 	req := sms.NewSendSmsRequest()
 	req.SmsSdkAppId = s.appId
 	req.SignName = s.signName
+	if tpl.SignName != "" {
+		req.SignName = ekit.ToPtr[string](tpl.SignName)
+	}
 	req.SetContext(ctx)
-	req.TemplateId = ekit.ToPtr[string](tplId)
+	req.TemplateId = ekit.ToPtr[string](tpl.Id)
 	req.PhoneNumberSet = s.toStringPtrSlice(numbers)
-	req.TemplateParamSet = s.toStringPtrSlice(args)
+	req.TemplateParamSet = s.toStringPtrSlice(params)
 	resp, err := s.client.SendSms(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, status := range resp.Response.SendStatusSet {
-		if *status.Code != "Ok" {
-			return fmt.Errorf("发送短信失败:%s  %s", *status.Code, *status.Message)
-		}
-	}
-	return nil
+	return slice.Map[*sms.SendStatus, smssvc.Receipt](resp.Response.SendStatusSet,
+		func(idx int, status *sms.SendStatus) smssvc.Receipt {
+			return smssvc.Receipt{
+				Number:    s.toString(status.PhoneNumber),
+				RequestId: s.toString(status.SerialNo),
+				Ok:        s.toString(status.Code) == "Ok",
+				Msg:       fmt.Sprintf("%s  %s", s.toString(status.Code), s.toString(status.Message)),
+			}
+		}), nil
 }
 
 func (s *Service) toStringPtrSlice(src []string) []*string {
@@ -52,3 +89,10 @@ func (s *Service) toStringPtrSlice(src []string) []*string {
 		return &src
 	})
 }
+
+func (s *Service) toString(src *string) string {
+	if src == nil {
+		return ""
+	}
+	return *src
+}
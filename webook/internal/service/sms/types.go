@@ -2,8 +2,36 @@ package sms
 
 import (
 	"context"
+	"fmt"
 )
 
 type Service interface {
 	Send(ctx context.Context, tplId string, args []string, numbers ...string) error
 }
+
+// Receipt 服务商对单个号码的受理结果
+type Receipt struct {
+	Number string
+	// 服务商的流水号，送达回执靠它关联
+	RequestId string
+	// 服务商有没有受理
+	Ok  bool
+	Msg string
+}
+
+// ReceiptService 能返回受理结果的 sms.Service，一般是服务商的实现
+type ReceiptService interface {
+	Service
+	// SendWithReceipts 回执和 numbers 一一对应
+	SendWithReceipts(ctx context.Context, tplId string, args []string, numbers ...string) ([]Receipt, error)
+}
+
+// ReceiptsError 有号码没有被受理的时候返回错误，错误信息是第一个没有受理的号码的
+func ReceiptsError(receipts []Receipt) error {
+	for _, r := range receipts {
+		if !r.Ok {
+			return fmt.Errorf("发送短信失败:%s", r.Msg)
+		}
+	}
+	return nil
+}
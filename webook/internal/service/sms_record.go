@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+
+	"geektime/webook/internal/domain"
+	"geektime/webook/internal/repository"
+)
+
+type SMSRecordService interface {
+	// Report 处理服务商的送达回执
+	Report(ctx context.Context, reports []domain.SMSReport) error
+	// FindByPhone 给客服查某个号码最近的短信
+	FindByPhone(ctx context.Context, phone string, limit int) ([]domain.SMSRecord, error)
+}
+
+type SMSRecordServiceImpl struct {
+	repo repository.SMSRecordRepository
+}
+
+func NewSMSRecordService(repo repository.SMSRecordRepository) SMSRecordService {
+	return &SMSRecordServiceImpl{
+		repo: repo,
+	}
+}
+
+func (svc *SMSRecordServiceImpl) Report(ctx context.Context, reports []domain.SMSReport) error {
+	for _, r := range reports {
+		if err := svc.repo.UpdateStatus(ctx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (svc *SMSRecordServiceImpl) FindByPhone(ctx context.Context, phone string, limit int) ([]domain.SMSRecord, error) {
+	return svc.repo.FindByPhone(ctx, phone, limit)
+}
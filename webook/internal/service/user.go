@@ -19,6 +19,7 @@ type UserService interface {
 	SignUp(ctx context.Context, u domain.User) error
 	Login(ctx context.Context, email, password string) (domain.User, error)
 	FindOrCreate(ctx context.Context, phone string) (domain.User, error)
+	FindOrCreateByEmail(ctx context.Context, email string) (domain.User, error)
 	Profile(ctx context.Context, id int64) (domain.User, error)
 	UpdateNonSensitiveInfo(ctx context.Context, user domain.User) error
 }
@@ -80,6 +81,22 @@ func (svc *UserServiceImpl) FindOrCreate(ctx context.Context, phone string) (dom
 	return svc.repo.FindByPhone(ctx, phone)
 }
 
+func (svc *UserServiceImpl) FindOrCreateByEmail(ctx context.Context, email string) (domain.User, error) {
+	// 快路径
+	u, err := svc.repo.FindByEmail(ctx, email)
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		return u, err
+	}
+	// 慢路径，没有密码，只能用验证码登录，以后可以再设置密码
+	err = svc.repo.Create(ctx, domain.User{
+		Email: email,
+	})
+	if err != nil && !errors.Is(err, ErrUserDuplicate) {
+		return domain.User{}, err
+	}
+	return svc.repo.FindByEmail(ctx, email)
+}
+
 func (svc *UserServiceImpl) Profile(ctx context.Context, id int64) (domain.User, error) {
 	// 在系统内部，基本上都是用 ID 的
 	// 有些比较复杂的系统，可能会用 GUID(global unique ID, 全局唯一 ID )
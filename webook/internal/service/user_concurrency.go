@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+
+	"geektime/webook/internal/domain"
+	"geektime/webook/pkg/concurrency"
+)
+
+var ErrOverloaded = concurrency.ErrOverloaded
+
+// ConcurrencyLimitedUserService MySQL 变慢的时候，自动减少访问它的并发数，
+// 多出来的请求直接返回 ErrOverloaded。
+// 优先级优先用请求上带的，没有的时候按照方法来：登录和查看资料最后丢弃
+type ConcurrencyLimitedUserService struct {
+	svc     UserService
+	limiter *concurrency.Limiter
+}
+
+func NewConcurrencyLimitedUserService(svc UserService, limiter *concurrency.Limiter) UserService {
+	return &ConcurrencyLimitedUserService{
+		svc:     svc,
+		limiter: limiter,
+	}
+}
+
+// acquire 拿到之后调用方要 defer done，不然 panic 的时候这个并发数就一直占着
+func (s *ConcurrencyLimitedUserService) acquire(ctx context.Context, def concurrency.Priority) (func(err error), error) {
+	done, ok := s.limiter.Acquire(concurrency.PriorityFrom(ctx, def))
+	if !ok {
+		return nil, ErrOverloaded
+	}
+	return done, nil
+}
+
+func (s *ConcurrencyLimitedUserService) SignUp(ctx context.Context, u domain.User) (err error) {
+	done, err := s.acquire(ctx, concurrency.PriorityNormal)
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
+	return s.svc.SignUp(ctx, u)
+}
+
+func (s *ConcurrencyLimitedUserService) Login(ctx context.Context, email, password string) (u domain.User, err error) {
+	done, err := s.acquire(ctx, concurrency.PriorityHigh)
+	if err != nil {
+		return domain.User{}, err
+	}
+	defer func() { done(err) }()
+	return s.svc.Login(ctx, email, password)
+}
+
+func (s *ConcurrencyLimitedUserService) FindOrCreate(ctx context.Context, phone string) (u domain.User, err error) {
+	done, err := s.acquire(ctx, concurrency.PriorityHigh)
+	if err != nil {
+		return domain.User{}, err
+	}
+	defer func() { done(err) }()
+	return s.svc.FindOrCreate(ctx, phone)
+}
+
+func (s *ConcurrencyLimitedUserService) FindOrCreateByEmail(ctx context.Context, email string) (u domain.User, err error) {
+	done, err := s.acquire(ctx, concurrency.PriorityHigh)
+	if err != nil {
+		return domain.User{}, err
+	}
+	defer func() { done(err) }()
+	return s.svc.FindOrCreateByEmail(ctx, email)
+}
+
+func (s *ConcurrencyLimitedUserService) Profile(ctx context.Context, id int64) (u domain.User, err error) {
+	done, err := s.acquire(ctx, concurrency.PriorityHigh)
+	if err != nil {
+		return domain.User{}, err
+	}
+	defer func() { done(err) }()
+	return s.svc.Profile(ctx, id)
+}
+
+func (s *ConcurrencyLimitedUserService) UpdateNonSensitiveInfo(ctx context.Context, user domain.User) (err error) {
+	done, err := s.acquire(ctx, concurrency.PriorityLow)
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
+	return s.svc.UpdateNonSensitiveInfo(ctx, user)
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"geektime/webook/internal/domain"
+	"geektime/webook/internal/repository"
+	repomocks "geektime/webook/internal/repository/mocks"
+	"geektime/webook/pkg/concurrency"
+)
+
+func TestConcurrencyLimitedUserService(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.UserRepository
+		ctx  context.Context
+		// 已经占用的并发数，上限是 10
+		inflight int
+		call     func(svc UserService, ctx context.Context) error
+
+		wantErr error
+	}{
+		{
+			name: "没有过载",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(123)).Return(domain.User{Id: 123}, nil)
+				return repo
+			},
+			ctx: context.Background(),
+			call: func(svc UserService, ctx context.Context) error {
+				_, err := svc.Profile(ctx, 123)
+				return err
+			},
+		},
+		{
+			name: "修改资料先被丢弃",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				return repomocks.NewMockUserRepository(ctrl)
+			},
+			ctx:      context.Background(),
+			inflight: 5,
+			call: func(svc UserService, ctx context.Context) error {
+				return svc.UpdateNonSensitiveInfo(ctx, domain.User{Id: 123})
+			},
+			wantErr: ErrOverloaded,
+		},
+		{
+			name: "查看资料还能进来",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(123)).Return(domain.User{Id: 123}, nil)
+				return repo
+			},
+			ctx:      context.Background(),
+			inflight: 5,
+			call: func(svc UserService, ctx context.Context) error {
+				_, err := svc.Profile(ctx, 123)
+				return err
+			},
+		},
+		{
+			name: "用请求上带的优先级",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				return repomocks.NewMockUserRepository(ctrl)
+			},
+			ctx:      concurrency.WithPriority(context.Background(), concurrency.PriorityLow),
+			inflight: 5,
+			call: func(svc UserService, ctx context.Context) error {
+				_, err := svc.Profile(ctx, 123)
+				return err
+			},
+			wantErr: ErrOverloaded,
+		},
+		{
+			name: "全满了登录也进不来",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				return repomocks.NewMockUserRepository(ctrl)
+			},
+			ctx:      context.Background(),
+			inflight: 10,
+			call: func(svc UserService, ctx context.Context) error {
+				_, err := svc.Login(ctx, "123@qq.com", "hello#world123")
+				return err
+			},
+			wantErr: ErrOverloaded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			limiter := concurrency.NewLimiter(10, 1, 100, time.Second)
+			for i := 0; i < tc.inflight; i++ {
+				_, ok := limiter.Acquire(concurrency.PriorityHigh)
+				require.True(t, ok)
+			}
+			svc := NewConcurrencyLimitedUserService(NewUserService(tc.mock(ctrl)), limiter)
+			err := tc.call(svc, tc.ctx)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestConcurrencyLimitedUserService_Panic(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := repomocks.NewMockUserRepository(ctrl)
+	repo.EXPECT().FindById(gomock.Any(), int64(123)).
+		DoAndReturn(func(ctx context.Context, id int64) (domain.User, error) {
+			panic("mock panic")
+		})
+	limiter := concurrency.NewLimiter(10, 1, 100, time.Second)
+	svc := NewConcurrencyLimitedUserService(NewUserService(repo), limiter)
+	assert.Panics(t, func() {
+		_, _ = svc.Profile(context.Background(), 123)
+	})
+	assert.Equal(t, 0, limiter.Inflight())
+}
@@ -0,0 +1,83 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"geektime/webook/internal/service/captcha"
+)
+
+var _ handler = (*CaptchaHandler)(nil)
+
+// CaptchaHandler 内置的人机验证，前端先拿题目，答对之后拿到一次性的 token，
+// 再带着 token 调用发送验证码之类的接口
+type CaptchaHandler struct {
+	svc captcha.Service
+}
+
+func NewCaptchaHandler(svc captcha.Service) *CaptchaHandler {
+	return &CaptchaHandler{
+		svc: svc,
+	}
+}
+
+func (h *CaptchaHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/captcha")
+	{
+		g.GET("/challenge", h.Challenge)
+		g.POST("/check", h.Check)
+	}
+}
+
+func (h *CaptchaHandler) Challenge(ctx *gin.Context) {
+	type Challenge struct {
+		Id     string `json:"id"`
+		Kind   string `json:"kind"`
+		Image  string `json:"image"`
+		Piece  string `json:"piece,omitempty"`
+		PieceY int    `json:"piece_y,omitempty"`
+	}
+	kind := captcha.Kind(ctx.DefaultQuery("kind", string(captcha.KindImage)))
+	c, err := h.svc.Generate(ctx, kind)
+	switch {
+	case errors.Is(err, captcha.ErrUnknownKind):
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "输入错误"})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Data: Challenge{
+			Id:     c.Id,
+			Kind:   string(c.Kind),
+			Image:  c.Image,
+			Piece:  c.Piece,
+			PieceY: c.PieceY,
+		},
+	})
+}
+
+func (h *CaptchaHandler) Check(ctx *gin.Context) {
+	type Req struct {
+		Id string `json:"id"`
+		// 数字或者滑块的横坐标
+		Answer string `json:"answer"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	token, err := h.svc.Check(ctx, req.Id, req.Answer, ctx.ClientIP())
+	switch {
+	case err == nil:
+		ctx.JSON(http.StatusOK, Result{Data: gin.H{"token": token}})
+	case errors.Is(err, captcha.ErrWrongAnswer), errors.Is(err, captcha.ErrChallengeNotFound):
+		// 题目已经作废了，前端要重新拿一个
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "验证失败，请重试"})
+	default:
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+	}
+}
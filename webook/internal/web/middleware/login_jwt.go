@@ -3,6 +3,7 @@ package middleware
 import (
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -77,3 +78,12 @@ func (l *LoginJWTMiddlewareBuilder) Build() gin.HandlerFunc {
 		ctx.Set("claims", claims)
 	}
 }
+
+// ClaimsUid 从 ctx.Get("claims") 的结果里面取出用户 ID，按用户限流的时候用
+func ClaimsUid(val any) string {
+	claims, ok := val.(*web.UserClaims)
+	if !ok || claims.Uid == 0 {
+		return ""
+	}
+	return strconv.FormatInt(claims.Uid, 10)
+}
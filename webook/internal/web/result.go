@@ -1,8 +1,15 @@
 package web
 
-type Result struct {
-	// 业务错误码
-	Code int    `json:"code"`
-	Msg  string `json:"msg"`
-	Data any    `json:"data"`
-}
+import "geektime/webook/pkg/ginx"
+
+// Result 中间件也要返回同样的结构，所以定义在 ginx 里面
+type Result = ginx.Result
+
+// 验证码校验失败的错误码，都属于输入错误（4）的细分
+const (
+	CodeVerifyWrong     = 4001
+	CodeVerifyExhausted = 4002
+	CodeVerifyUsed      = 4003
+	CodeVerifyExpired   = 4004
+	CodeVerifyNotSent   = 4005
+)
@@ -0,0 +1,90 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"geektime/webook/internal/service/sms"
+	"geektime/webook/internal/service/sms/gateway"
+	smsratelimit "geektime/webook/internal/service/sms/ratelimit"
+	"geektime/webook/internal/service/sms/template"
+)
+
+const gatewayClaimsKey = "gateway_claims"
+
+var _ handler = (*SMSHandler)(nil)
+
+// SMSHandler 短信网关，把 sms.Service 暴露给其它团队用
+// 调用方要带上我们签发的 token，token 里面声明了能用的模板
+type SMSHandler struct {
+	svc sms.Service
+	key []byte
+}
+
+func NewSMSHandler(svc sms.Service, key string) *SMSHandler {
+	return &SMSHandler{
+		svc: svc,
+		key: []byte(key),
+	}
+}
+
+func (h *SMSHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/sms", h.authenticate)
+	{
+		g.POST("/send", h.Send)
+	}
+}
+
+func (h *SMSHandler) authenticate(ctx *gin.Context) {
+	tokenHeader := ctx.GetHeader("Authorization")
+	segs := strings.Split(tokenHeader, " ")
+	if len(segs) != 2 || segs[0] != "Bearer" {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	claims := &gateway.Claims{}
+	token, err := jwt.ParseWithClaims(segs[1], claims, func(token *jwt.Token) (interface{}, error) {
+		return h.key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}))
+	// 没有过期时间的 token 一律不认，泄露了就没法撤销
+	if err != nil || token == nil || !token.Valid || claims.App == "" || claims.ExpiresAt == nil {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	ctx.Set(gatewayClaimsKey, claims)
+}
+
+func (h *SMSHandler) Send(ctx *gin.Context) {
+	var req gateway.SendReq
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if req.TplId == "" || len(req.Numbers) == 0 {
+		ctx.JSON(http.StatusOK, gateway.Result{Code: 4, Msg: "输入错误"})
+		return
+	}
+	claims := ctx.MustGet(gatewayClaimsKey).(*gateway.Claims)
+	if !claims.Allow(req.TplId) {
+		ctx.JSON(http.StatusOK, gateway.Result{Code: 4, Msg: "没有权限使用该模板"})
+		return
+	}
+	// 业务加上调用方前缀，避免不同调用方的业务互相影响
+	c := sms.WithBiz(sms.WithClientIP(ctx, req.ClientIP), claims.App+":"+req.Biz)
+	err := h.svc.Send(c, req.TplId, req.Args, req.Numbers...)
+	var limitedErr *smsratelimit.LimitedError
+	switch {
+	case err == nil:
+		ctx.JSON(http.StatusOK, gateway.Result{Msg: "发送成功"})
+	case errors.As(err, &limitedErr):
+		ctx.JSON(http.StatusOK, gateway.Result{Code: 4, Msg: err.Error(),
+			Limited: limitedErr.Dimension, RetryAfter: retryAfterSeconds(limitedErr.RetryAfter)})
+	case errors.Is(err, template.ErrTemplateNotFound), errors.Is(err, template.ErrParamsMismatch):
+		ctx.JSON(http.StatusOK, gateway.Result{Code: 4, Msg: err.Error()})
+	default:
+		ctx.JSON(http.StatusOK, gateway.Result{Code: 5, Msg: "系统错误"})
+	}
+}
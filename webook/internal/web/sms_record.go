@@ -0,0 +1,161 @@
+package web
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+
+	"geektime/webook/internal/domain"
+	"geektime/webook/internal/service"
+	"geektime/webook/internal/service/sms/tencent"
+	"geektime/webook/pkg/phone"
+)
+
+var _ handler = (*SMSRecordHandler)(nil)
+
+// SMSRecordAuth 回调和查询记录的鉴权配置
+type SMSRecordAuth struct {
+	// 腾讯云的回调没有签名，只能在控制台配置回调地址的时候带上 token，
+	// 为空的时候拒绝所有回调
+	CallbackToken string
+	// 发送记录只给客服查
+	SupportUids []int64
+}
+
+// SMSRecordHandler 短信送达回执和发送记录查询
+type SMSRecordHandler struct {
+	svc           service.SMSRecordService
+	callbackToken []byte
+	supportUids   map[int64]struct{}
+}
+
+func NewSMSRecordHandler(svc service.SMSRecordService, auth SMSRecordAuth) *SMSRecordHandler {
+	uids := make(map[int64]struct{}, len(auth.SupportUids))
+	for _, uid := range auth.SupportUids {
+		uids[uid] = struct{}{}
+	}
+	return &SMSRecordHandler{
+		svc:           svc,
+		callbackToken: []byte(auth.CallbackToken),
+		supportUids:   uids,
+	}
+}
+
+func (h *SMSRecordHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/sms")
+	{
+		// 服务商回调，不需要登录，校验回调地址上的 token
+		g.POST("/callback/tencent", h.checkCallbackToken, h.TencentCallback)
+		g.GET("/records", h.requireSupport, h.Records)
+	}
+}
+
+func (h *SMSRecordHandler) checkCallbackToken(ctx *gin.Context) {
+	token := []byte(ctx.Query("token"))
+	if len(h.callbackToken) == 0 || subtle.ConstantTimeCompare(token, h.callbackToken) != 1 {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+}
+
+// requireSupport 要放在登录校验后面，只有客服能查别人的发送记录
+func (h *SMSRecordHandler) requireSupport(ctx *gin.Context) {
+	val, _ := ctx.Get("claims")
+	claims, ok := val.(*UserClaims)
+	if !ok {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	if _, ok = h.supportUids[claims.Uid]; !ok {
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+}
+
+// TencentCallback 腾讯云的短信状态回调，一次会推送多条
+func (h *SMSRecordHandler) TencentCallback(ctx *gin.Context) {
+	type Report struct {
+		UserReceiveTime string `json:"user_receive_time"`
+		NationCode      string `json:"nationcode"`
+		Mobile          string `json:"mobile"`
+		ReportStatus    string `json:"report_status"`
+		ErrMsg          string `json:"errmsg"`
+		Description     string `json:"description"`
+		Sid             string `json:"sid"`
+	}
+	// 腾讯云要求的响应格式
+	type Resp struct {
+		Result int    `json:"result"`
+		ErrMsg string `json:"errmsg"`
+	}
+	var req []Report
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	reports := slice.Map[Report, domain.SMSReport](req, func(idx int, src Report) domain.SMSReport {
+		return domain.SMSReport{
+			Provider:  tencent.Provider,
+			RequestId: src.Sid,
+			Delivered: src.ReportStatus == "SUCCESS",
+			Msg:       src.ErrMsg + " " + src.Description,
+		}
+	})
+	if err := h.svc.Report(ctx, reports); err != nil {
+		ctx.JSON(http.StatusOK, Resp{Result: 1, ErrMsg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Resp{ErrMsg: "OK"})
+}
+
+// Records 客服查某个号码最近的短信
+func (h *SMSRecordHandler) Records(ctx *gin.Context) {
+	type Record struct {
+		Provider  string `json:"provider"`
+		TplId     string `json:"tplId"`
+		Phone     string `json:"phone"`
+		RequestId string `json:"requestId"`
+		Status    uint8  `json:"status"`
+		Latency   int64  `json:"latency"`
+		Msg       string `json:"msg"`
+		Ctime     string `json:"ctime"`
+		Utime     string `json:"utime"`
+	}
+	number := ctx.Query("phone")
+	if number == "" {
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "输入错误"})
+		return
+	}
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "输入错误"})
+		return
+	}
+	// 发送的时候用的是 E.164，解析不了的按原样查早期的记录
+	if normalized, err := phone.Normalize(number); err == nil {
+		number = normalized
+	}
+	rs, err := h.svc.FindByPhone(ctx, number, limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Data: slice.Map[domain.SMSRecord, Record](rs, func(idx int, src domain.SMSRecord) Record {
+			return Record{
+				Provider:  src.Provider,
+				TplId:     src.TplId,
+				Phone:     src.Phone,
+				RequestId: src.RequestId,
+				Status:    uint8(src.Status),
+				Latency:   src.Latency.Milliseconds(),
+				Msg:       src.Msg,
+				Ctime:     src.Ctime.Format(time.DateTime),
+				Utime:     src.Utime.Format(time.DateTime),
+			}
+		}),
+	})
+}
@@ -0,0 +1,220 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"geektime/webook/internal/domain"
+	"geektime/webook/internal/service"
+	svcmocks "geektime/webook/internal/service/mocks"
+)
+
+func TestSMSRecordHandler_TencentCallback(t *testing.T) {
+	const reqBody = `[{"user_receive_time":"2023-10-17 08:03:04","nationcode":"86","mobile":"15212345678",
+"report_status":"SUCCESS","errmsg":"DELIVRD","description":"用户短信送达成功","sid":"sid-1"},
+{"user_receive_time":"2023-10-17 08:03:05","nationcode":"86","mobile":"15212345679",
+"report_status":"FAIL","errmsg":"MK:0001","description":"空号","sid":"sid-2"}]`
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) service.SMSRecordService
+
+		token string
+
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name: "更新成功",
+			mock: func(ctrl *gomock.Controller) service.SMSRecordService {
+				svc := svcmocks.NewMockSMSRecordService(ctrl)
+				svc.EXPECT().Report(gomock.Any(), []domain.SMSReport{
+					{Provider: "tencent", RequestId: "sid-1", Delivered: true, Msg: "DELIVRD 用户短信送达成功"},
+					{Provider: "tencent", RequestId: "sid-2", Msg: "MK:0001 空号"},
+				}).Return(nil)
+				return svc
+			},
+			token:        "callback token",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"result":0,"errmsg":"OK"}`,
+		},
+		{
+			name: "更新失败",
+			mock: func(ctrl *gomock.Controller) service.SMSRecordService {
+				svc := svcmocks.NewMockSMSRecordService(ctrl)
+				svc.EXPECT().Report(gomock.Any(), gomock.Any()).Return(errors.New("mock db err"))
+				return svc
+			},
+			token:        "callback token",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"result":1,"errmsg":"系统错误"}`,
+		},
+		{
+			name: "没有带 token",
+			mock: func(ctrl *gomock.Controller) service.SMSRecordService {
+				return svcmocks.NewMockSMSRecordService(ctrl)
+			},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "token 不对",
+			mock: func(ctrl *gomock.Controller) service.SMSRecordService {
+				return svcmocks.NewMockSMSRecordService(ctrl)
+			},
+			token:        "forged",
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			server := gin.Default()
+			NewSMSRecordHandler(tc.mock(ctrl), SMSRecordAuth{CallbackToken: "callback token"}).RegisterRoutes(server)
+
+			req, err := http.NewRequest(http.MethodPost, "/sms/callback/tencent?token="+url.QueryEscape(tc.token),
+				bytes.NewBuffer([]byte(reqBody)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.expectedCode, resp.Code)
+			assert.Equal(t, tc.expectedBody, resp.Body.String())
+		})
+	}
+}
+
+func TestSMSRecordHandler_Records(t *testing.T) {
+	const supportUid = 1
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) service.SMSRecordService
+
+		// 0 表示没有登录
+		uid   int64
+		query string
+
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name: "查询成功",
+			mock: func(ctrl *gomock.Controller) service.SMSRecordService {
+				svc := svcmocks.NewMockSMSRecordService(ctrl)
+				now := time.Date(2023, 10, 17, 8, 3, 4, 0, time.Local)
+				svc.EXPECT().FindByPhone(gomock.Any(), "+8615212345678", 20).Return([]domain.SMSRecord{
+					{
+						Provider:  "tencent",
+						TplId:     "login_code",
+						Phone:     "+86****5678",
+						RequestId: "sid-1",
+						Status:    domain.SMSStatusDelivered,
+						Latency:   time.Millisecond * 30,
+						Ctime:     now,
+						Utime:     now,
+					},
+				}, nil)
+				return svc
+			},
+			uid:          supportUid,
+			query:        "phone=15212345678",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"code":0,"msg":"","data":[{"provider":"tencent","tplId":"login_code","phone":"+86****5678",` +
+				`"requestId":"sid-1","status":` + strconv.Itoa(int(domain.SMSStatusDelivered)) + `,"latency":30,"msg":"",` +
+				`"ctime":"2023-10-17 08:03:04","utime":"2023-10-17 08:03:04"}]}`,
+		},
+		{
+			name: "没有登录",
+			mock: func(ctrl *gomock.Controller) service.SMSRecordService {
+				return svcmocks.NewMockSMSRecordService(ctrl)
+			},
+			query:        "phone=15212345678",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "普通用户不能查",
+			mock: func(ctrl *gomock.Controller) service.SMSRecordService {
+				return svcmocks.NewMockSMSRecordService(ctrl)
+			},
+			uid:          2,
+			query:        "phone=15212345678",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name: "没有号码",
+			mock: func(ctrl *gomock.Controller) service.SMSRecordService {
+				return svcmocks.NewMockSMSRecordService(ctrl)
+			},
+			uid:          supportUid,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"code":4,"msg":"输入错误","data":null}`,
+		},
+		{
+			name: "limit 不是数字",
+			mock: func(ctrl *gomock.Controller) service.SMSRecordService {
+				return svcmocks.NewMockSMSRecordService(ctrl)
+			},
+			uid:          supportUid,
+			query:        "phone=15212345678&limit=abc",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"code":4,"msg":"输入错误","data":null}`,
+		},
+		{
+			name: "limit 太大",
+			mock: func(ctrl *gomock.Controller) service.SMSRecordService {
+				return svcmocks.NewMockSMSRecordService(ctrl)
+			},
+			uid:          supportUid,
+			query:        "phone=15212345678&limit=101",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"code":4,"msg":"输入错误","data":null}`,
+		},
+		{
+			name: "查询失败",
+			mock: func(ctrl *gomock.Controller) service.SMSRecordService {
+				svc := svcmocks.NewMockSMSRecordService(ctrl)
+				svc.EXPECT().FindByPhone(gomock.Any(), "+8615212345678", 10).Return(nil, errors.New("mock db err"))
+				return svc
+			},
+			uid:          supportUid,
+			query:        "phone=15212345678&limit=10",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"code":5,"msg":"系统错误","data":null}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			server := gin.Default()
+			// 模拟登录校验的中间件
+			server.Use(func(ctx *gin.Context) {
+				if tc.uid != 0 {
+					ctx.Set("claims", &UserClaims{Uid: tc.uid})
+				}
+			})
+			NewSMSRecordHandler(tc.mock(ctrl), SMSRecordAuth{SupportUids: []int64{supportUid}}).RegisterRoutes(server)
+
+			req, err := http.NewRequest(http.MethodGet, "/sms/records?"+tc.query, nil)
+			require.NoError(t, err)
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.expectedCode, resp.Code)
+			assert.Equal(t, tc.expectedBody, resp.Body.String())
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"geektime/webook/internal/service/sms"
+	"geektime/webook/internal/service/sms/gateway"
+	smsmocks "geektime/webook/internal/service/sms/mocks"
+)
+
+func TestSMSHandler_Send(t *testing.T) {
+	const key = "gateway-test-key"
+	token, err := gateway.NewToken([]byte(key), "webook", []string{"login_code"}, time.Minute)
+	require.NoError(t, err)
+	wrongKeyToken, err := gateway.NewToken([]byte("wrong-key"), "webook", []string{"login_code"}, time.Minute)
+	require.NoError(t, err)
+	// 以前签发的不过期的 token
+	noExpToken, err := jwt.NewWithClaims(jwt.SigningMethodHS512, gateway.Claims{
+		App:  "webook",
+		Tpls: []string{"login_code"},
+	}).SignedString([]byte(key))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) sms.Service
+
+		token   string
+		reqBody string
+
+		expectedCode int
+		expectedBody gateway.Result
+	}{
+		{
+			name: "发送成功",
+			mock: func(ctrl *gomock.Controller) sms.Service {
+				svc := smsmocks.NewMockService(ctrl)
+				svc.EXPECT().Send(gomock.Any(), "login_code", []string{"123456"}, "15212345678").Return(nil)
+				return svc
+			},
+			token:        token,
+			reqBody:      `{"tplId":"login_code","args":["123456"],"numbers":["15212345678"]}`,
+			expectedCode: http.StatusOK,
+			expectedBody: gateway.Result{Msg: "发送成功"},
+		},
+		{
+			name: "没有 token",
+			mock: func(ctrl *gomock.Controller) sms.Service {
+				return smsmocks.NewMockService(ctrl)
+			},
+			reqBody:      `{"tplId":"login_code","args":["123456"],"numbers":["15212345678"]}`,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "token 签名不对",
+			mock: func(ctrl *gomock.Controller) sms.Service {
+				return smsmocks.NewMockService(ctrl)
+			},
+			token:        wrongKeyToken,
+			reqBody:      `{"tplId":"login_code","args":["123456"],"numbers":["15212345678"]}`,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "token 没有过期时间",
+			mock: func(ctrl *gomock.Controller) sms.Service {
+				return smsmocks.NewMockService(ctrl)
+			},
+			token:        noExpToken,
+			reqBody:      `{"tplId":"login_code","args":["123456"],"numbers":["15212345678"]}`,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "没有权限使用该模板",
+			mock: func(ctrl *gomock.Controller) sms.Service {
+				return smsmocks.NewMockService(ctrl)
+			},
+			token:        token,
+			reqBody:      `{"tplId":"reset_password","args":["123456"],"numbers":["15212345678"]}`,
+			expectedCode: http.StatusOK,
+			expectedBody: gateway.Result{Code: 4, Msg: "没有权限使用该模板"},
+		},
+		{
+			name: "发送失败",
+			mock: func(ctrl *gomock.Controller) sms.Service {
+				svc := smsmocks.NewMockService(ctrl)
+				svc.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("mock send err"))
+				return svc
+			},
+			token:        token,
+			reqBody:      `{"tplId":"login_code","args":["123456"],"numbers":["15212345678"]}`,
+			expectedCode: http.StatusOK,
+			expectedBody: gateway.Result{Code: 5, Msg: "系统错误"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			server := gin.Default()
+			h := NewSMSHandler(tc.mock(ctrl), key)
+			h.RegisterRoutes(server)
+
+			req, err := http.NewRequest(http.MethodPost, "/sms/send", bytes.NewBuffer([]byte(tc.reqBody)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.expectedCode, resp.Code)
+			if resp.Code != http.StatusOK {
+				return
+			}
+			var res gateway.Result
+			err = json.Unmarshal(resp.Body.Bytes(), &res)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedBody, res)
+		})
+	}
+}
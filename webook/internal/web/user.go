@@ -3,7 +3,9 @@ package web
 import (
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	regexp "github.com/dlclark/regexp2"
@@ -13,6 +15,11 @@ import (
 
 	"geektime/webook/internal/domain"
 	"geektime/webook/internal/service"
+	"geektime/webook/internal/service/captcha"
+	"geektime/webook/internal/service/notify"
+	"geektime/webook/internal/service/sms"
+	smsratelimit "geektime/webook/internal/service/sms/ratelimit"
+	"geektime/webook/pkg/phone"
 )
 
 const (
@@ -29,11 +36,14 @@ var _ handler = (*UserHandler)(nil)
 type UserHandler struct {
 	svc            service.UserService
 	codeSvc        service.CodeService
+	captcha        captcha.Verifier
+	risk           captcha.RiskChecker
 	emailRegexp    *regexp.Regexp
 	passwordRegexp *regexp.Regexp
 }
 
-func NewUserHandler(svc service.UserService, codeSvc service.CodeService) *UserHandler {
+func NewUserHandler(svc service.UserService, codeSvc service.CodeService,
+	captchaVerifier captcha.Verifier, risk captcha.RiskChecker) *UserHandler {
 	const (
 		emailRegexPattern = "^\\w+([-+.]\\w+)*@\\w+([-.]\\w+)*\\.\\w+([-.]\\w+)*$"
 		// 和上面比起来，用 ` 看起来就比较清爽
@@ -42,6 +52,8 @@ func NewUserHandler(svc service.UserService, codeSvc service.CodeService) *UserH
 	return &UserHandler{
 		svc:            svc,
 		codeSvc:        codeSvc,
+		captcha:        captchaVerifier,
+		risk:           risk,
 		emailRegexp:    regexp.MustCompile(emailRegexPattern, regexp.None),
 		passwordRegexp: regexp.MustCompile(passwordRegexPattern, regexp.None),
 	}
@@ -59,6 +71,9 @@ func (u *UserHandler) RegisterRoutes(server *gin.Engine) {
 
 		ug.POST("/login_sms/code/send", u.SendLoginSMSCode)
 		ug.POST("/login_sms", u.LoginSMS)
+
+		ug.POST("/login_email/code/send", u.SendLoginEmailCode)
+		ug.POST("/login_email", u.LoginEmail)
 	}
 }
 
@@ -72,23 +87,31 @@ func (u *UserHandler) LoginSMS(ctx *gin.Context) {
 	if err != nil {
 		return
 	}
-	ok, err := u.codeSvc.Verify(ctx, biz, req.Phone, req.Code)
+	req.Phone, err = phone.Normalize(req.Phone)
 	if err != nil {
 		ctx.JSON(http.StatusOK, Result{
-			Code: 5,
-			Msg:  "系统错误",
+			Code: 4,
+			Msg:  "手机号码格式错误",
 		})
 		return
 	}
-	if !ok {
+	res, err := u.codeSvc.Verify(ctx, biz, notify.ChannelSMS, req.Phone, req.Code)
+	if err != nil {
 		ctx.JSON(http.StatusOK, Result{
-			Code: 4,
-			Msg:  "验证码错误",
+			Code: 5,
+			Msg:  "系统错误",
 		})
 		return
 	}
+	if !res.OK() {
+		ctx.JSON(http.StatusOK, verifyFailedResult(res))
+		return
+	}
 
 	user, err := u.svc.FindOrCreate(ctx, req.Phone)
+	if overloaded(ctx, err) {
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusOK, Result{
 			Code: 5,
@@ -108,9 +131,82 @@ func (u *UserHandler) LoginSMS(ctx *gin.Context) {
 	})
 }
 
+// verifyFailedResult 每种校验失败的情况对应一个错误码，前端按错误码提示用户
+func verifyFailedResult(res domain.CodeVerifyResult) Result {
+	switch res.Status {
+	case domain.CodeVerifyWrong:
+		if res.Remaining <= 0 {
+			return Result{Code: CodeVerifyExhausted, Msg: "验证码错误次数太多，请重新获取"}
+		}
+		return Result{
+			Code: CodeVerifyWrong,
+			Msg:  fmt.Sprintf("验证码错误，还可以输入 %d 次", res.Remaining),
+			Data: gin.H{"remaining": res.Remaining},
+		}
+	case domain.CodeVerifyExhausted:
+		return Result{Code: CodeVerifyExhausted, Msg: "验证码错误次数太多，请重新获取"}
+	case domain.CodeVerifyUsed:
+		return Result{Code: CodeVerifyUsed, Msg: "验证码已经使用过，请重新获取"}
+	case domain.CodeVerifyExpired:
+		return Result{Code: CodeVerifyExpired, Msg: "验证码已过期，请重新获取"}
+	case domain.CodeVerifyNotSent:
+		return Result{Code: CodeVerifyNotSent, Msg: "请先获取验证码"}
+	default:
+		return Result{Code: 5, Msg: "系统错误"}
+	}
+}
+
+// smsLimitedResult 限流的窗口是可以配置、运行时还会变的，提示里面的时间按照规则算出来
+func smsLimitedResult(err *service.ErrSMSLimited) Result {
+	msg := "发送太频繁"
+	if err.Dimension == smsratelimit.DimensionPhone {
+		msg = "该手机号发送次数过多"
+	}
+	if err.RetryAfter <= 0 {
+		return Result{Code: 4, Msg: msg + "，请稍后再试"}
+	}
+	return Result{
+		Code: 4,
+		Msg:  fmt.Sprintf("%s，请%s后再试", msg, humanDuration(err.RetryAfter)),
+		Data: gin.H{"retry_after": retryAfterSeconds(err.RetryAfter)},
+	}
+}
+
+// humanDuration 向上取整到小时、分钟或者秒
+func humanDuration(d time.Duration) string {
+	switch {
+	case d > time.Hour:
+		return fmt.Sprintf(" %d 小时", int((d+time.Hour-1)/time.Hour))
+	case d > time.Minute:
+		return fmt.Sprintf(" %d 分钟", int((d+time.Minute-1)/time.Minute))
+	default:
+		return fmt.Sprintf(" %d 秒", retryAfterSeconds(d))
+	}
+}
+
+// retryAfterSeconds 向上取整，至少 1 秒
+func retryAfterSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// overloaded UserService 过载的时候返回 503，前端过一会儿再重试
+func overloaded(ctx *gin.Context, err error) bool {
+	if !errors.Is(err, service.ErrOverloaded) {
+		return false
+	}
+	ctx.Header("Retry-After", "1")
+	ctx.JSON(http.StatusServiceUnavailable, Result{Code: 5, Msg: "系统繁忙，请稍后再试"})
+	return true
+}
+
 func (u *UserHandler) SendLoginSMSCode(ctx *gin.Context) {
 	type Req struct {
 		Phone string `json:"phone"`
+		// 触发风控之后要先完成人机验证
+		CaptchaToken string `json:"captcha_token"`
 	}
 	var req Req
 	if err := ctx.Bind(&req); err != nil {
@@ -123,13 +219,180 @@ func (u *UserHandler) SendLoginSMSCode(ctx *gin.Context) {
 		})
 		return
 	}
-	err := u.codeSvc.Send(ctx, biz, req.Phone)
-	switch err {
-	case nil:
+	// 统一成 E.164，同一个号码不同写法共用限流和验证码
+	normalized, err := phone.Normalize(req.Phone)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "手机号码格式错误",
+		})
+		return
+	}
+	req.Phone = normalized
+	ip := ctx.ClientIP()
+	passed := u.checkCaptcha(ctx, ip, req.Phone, req.CaptchaToken)
+	// 不管有没有发出去都要记下来，不然被限流或者发送失败的请求刷多少次都不会触发人机验证
+	if er := u.risk.Record(ctx, ip, req.Phone); er != nil {
+		log.Println("记录验证码发送次数失败", er)
+	}
+	if !passed {
+		return
+	}
+	// 带上用户 IP，短信服务按 IP 限流
+	err = u.codeSvc.Send(sms.WithClientIP(ctx, ip), biz, notify.ChannelSMS, req.Phone)
+	var limitedErr *service.ErrSMSLimited
+	switch {
+	case err == nil:
+		ctx.JSON(http.StatusOK, Result{
+			Msg: "发送成功",
+		})
+	case errors.Is(err, service.ErrSendTooMany):
+		ctx.JSON(http.StatusOK, Result{
+			Msg: "发送太频繁，请稍后再试",
+		})
+	case errors.As(err, &limitedErr):
+		ctx.JSON(http.StatusOK, smsLimitedResult(limitedErr))
+	default:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+	}
+}
+
+// checkCaptcha 触发风控的时候校验人机验证的 token，没通过的时候已经写好了响应。
+// receiver 是接收验证码的手机号码或者邮箱
+func (u *UserHandler) checkCaptcha(ctx *gin.Context, ip, receiver, token string) bool {
+	required, err := u.risk.Required(ctx, ip, receiver)
+	if err != nil {
+		// 风控出错不拦截，后面还有短信限流兜底
+		log.Println("检查发送验证码风险失败", err)
+		return true
+	}
+	if !required {
+		return true
+	}
+	ok, err := u.captcha.Verify(ctx, token, ip)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		return false
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "请先完成人机验证",
+			Data: gin.H{"captcha_required": true},
+		})
+		return false
+	}
+	return true
+}
+
+func (u *UserHandler) LoginEmail(ctx *gin.Context) {
+	type Req struct {
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	req.Email = normalizeEmail(req.Email)
+	ok, err := u.emailRegexp.MatchString(req.Email)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		return
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "邮箱格式错误",
+		})
+		return
+	}
+	res, err := u.codeSvc.Verify(ctx, biz, notify.ChannelEmail, req.Email, req.Code)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		return
+	}
+	if !res.OK() {
+		ctx.JSON(http.StatusOK, verifyFailedResult(res))
+		return
+	}
+
+	user, err := u.svc.FindOrCreateByEmail(ctx, req.Email)
+	if overloaded(ctx, err) {
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		return
+	}
+	if err = u.setJWTToken(ctx, user.Id); err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "验证码校验通过",
+	})
+}
+
+func (u *UserHandler) SendLoginEmailCode(ctx *gin.Context) {
+	type Req struct {
+		Email string `json:"email"`
+		// 和短信一样，触发风控之后要先完成人机验证
+		CaptchaToken string `json:"captcha_token"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	req.Email = normalizeEmail(req.Email)
+	ok, err := u.emailRegexp.MatchString(req.Email)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		return
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "邮箱格式错误",
+		})
+		return
+	}
+	ip := ctx.ClientIP()
+	passed := u.checkCaptcha(ctx, ip, req.Email, req.CaptchaToken)
+	if er := u.risk.Record(ctx, ip, req.Email); er != nil {
+		log.Println("记录验证码发送次数失败", er)
+	}
+	if !passed {
+		return
+	}
+	err = u.codeSvc.Send(ctx, biz, notify.ChannelEmail, req.Email)
+	switch {
+	case err == nil:
 		ctx.JSON(http.StatusOK, Result{
 			Msg: "发送成功",
 		})
-	case service.ErrSendTooMany:
+	case errors.Is(err, service.ErrSendTooMany):
 		ctx.JSON(http.StatusOK, Result{
 			Msg: "发送太频繁，请稍后再试",
 		})
@@ -141,6 +404,11 @@ func (u *UserHandler) SendLoginSMSCode(ctx *gin.Context) {
 	}
 }
 
+// normalizeEmail 大小写和首尾的空格不同也是同一个邮箱，共用验证码和风控计数
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
 func (u *UserHandler) SignUp(ctx *gin.Context) {
 	type SignUpReq struct {
 		Email           string `json:"email"`
@@ -186,6 +454,9 @@ func (u *UserHandler) SignUp(ctx *gin.Context) {
 		Email:    req.Email,
 		Password: req.Password,
 	})
+	if overloaded(ctx, err) {
+		return
+	}
 	if errors.Is(err, service.ErrUserDuplicate) {
 		ctx.String(http.StatusOK, "邮箱重复")
 		return
@@ -210,6 +481,9 @@ func (u *UserHandler) Login(ctx *gin.Context) {
 	}
 
 	user, err := u.svc.Login(ctx, req.Email, req.Password)
+	if overloaded(ctx, err) {
+		return
+	}
 
 	if errors.Is(err, service.ErrInvalidUserOrPassword) {
 		ctx.String(http.StatusOK, "账户或密码错误")
@@ -253,6 +527,9 @@ func (u *UserHandler) LoginJWT(ctx *gin.Context) {
 	}
 
 	user, err := u.svc.Login(ctx, req.Email, req.Password)
+	if overloaded(ctx, err) {
+		return
+	}
 	if err != nil {
 		if errors.Is(err, service.ErrInvalidUserOrPassword) {
 			ctx.String(http.StatusOK, "账户或密码错误")
@@ -319,6 +596,9 @@ func (u *UserHandler) Edit(ctx *gin.Context) {
 		AboutMe:  req.AboutMe,
 		Birthday: birthday,
 	})
+	if overloaded(ctx, err) {
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
 		return
@@ -336,6 +616,9 @@ func (u *UserHandler) ProfileJWT(ctx *gin.Context) {
 	}
 	uc := ctx.MustGet("user").(UserClaims)
 	user, err := u.svc.Profile(ctx, uc.Uid)
+	if overloaded(ctx, err) {
+		return
+	}
 	if err != nil {
 		// 按照道理来说，这边 id 对应的数据肯定存在，所以要是没找到，
 		// 那就说明是系统出了问题。
@@ -358,6 +641,9 @@ func (u *UserHandler) Profile(ctx *gin.Context) {
 	sess := sessions.Default(ctx)
 	id := sess.Get(userIdKey).(int64)
 	user, err := u.svc.Profile(ctx, id)
+	if overloaded(ctx, err) {
+		return
+	}
 	if err != nil {
 		ctx.String(http.StatusOK, "系统错误")
 		return
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -16,7 +17,11 @@ import (
 
 	"geektime/webook/internal/domain"
 	"geektime/webook/internal/service"
+	"geektime/webook/internal/service/captcha"
+	captchamocks "geektime/webook/internal/service/captcha/mocks"
 	svcmocks "geektime/webook/internal/service/mocks"
+	"geektime/webook/internal/service/notify"
+	smsratelimit "geektime/webook/internal/service/sms/ratelimit"
 )
 
 func TestEncrypt(t *testing.T) {
@@ -113,6 +118,17 @@ func TestUserHandler_SignUp(t *testing.T) {
 			expectedCode: http.StatusOK,
 			expectedBody: "系统异常",
 		},
+		{
+			name: "系统过载",
+			mock: func(ctrl *gomock.Controller) service.UserService {
+				userSvc := svcmocks.NewMockUserService(ctrl)
+				userSvc.EXPECT().SignUp(gomock.Any(), gomock.Any()).Return(service.ErrOverloaded)
+				return userSvc
+			},
+			reqBody:      `{"email": "123@qq.com","password": "hello#world123","confirmPassword": "hello#world123"}`,
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: `{"code":5,"msg":"系统繁忙，请稍后再试","data":null}`,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -122,7 +138,7 @@ func TestUserHandler_SignUp(t *testing.T) {
 
 			// 准备一个 gin.Engine，并注册路由
 			server := gin.Default()
-			h := NewUserHandler(tc.mock(ctrl), nil)
+			h := NewUserHandler(tc.mock(ctrl), nil, nil, nil)
 			h.RegisterRoutes(server)
 
 			// 准备请求
@@ -143,6 +159,424 @@ func TestUserHandler_SignUp(t *testing.T) {
 	}
 }
 
+func TestUserHandler_SendLoginSMSCode(t *testing.T) {
+	const (
+		ip    = "192.0.2.1"
+		phone = "+8615212345678"
+	)
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (service.CodeService, captcha.Verifier, captcha.RiskChecker)
+
+		reqBody string
+
+		expectedBody string
+	}{
+		{
+			name: "没有风险，直接发送",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, captcha.Verifier, captcha.RiskChecker) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Send(gomock.Any(), biz, gomock.Any(), phone).Return(nil)
+				risk := captchamocks.NewMockRiskChecker(ctrl)
+				risk.EXPECT().Required(gomock.Any(), ip, phone).Return(false, nil)
+				risk.EXPECT().Record(gomock.Any(), ip, phone).Return(nil)
+				return codeSvc, captchamocks.NewMockVerifier(ctrl), risk
+			},
+			reqBody:      `{"phone": "15212345678"}`,
+			expectedBody: `{"code":0,"msg":"发送成功","data":null}`,
+		},
+		{
+			name: "触发风控，没有完成人机验证",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, captcha.Verifier, captcha.RiskChecker) {
+				risk := captchamocks.NewMockRiskChecker(ctrl)
+				risk.EXPECT().Required(gomock.Any(), ip, phone).Return(true, nil)
+				// 被拦下来或者没发出去也要记下来
+				risk.EXPECT().Record(gomock.Any(), ip, phone).Return(nil)
+				verifier := captchamocks.NewMockVerifier(ctrl)
+				verifier.EXPECT().Verify(gomock.Any(), "", ip).Return(false, nil)
+				return svcmocks.NewMockCodeService(ctrl), verifier, risk
+			},
+			reqBody:      `{"phone": "15212345678"}`,
+			expectedBody: `{"code":4,"msg":"请先完成人机验证","data":{"captcha_required":true}}`,
+		},
+		{
+			name: "触发风控，人机验证通过",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, captcha.Verifier, captcha.RiskChecker) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Send(gomock.Any(), biz, gomock.Any(), phone).Return(nil)
+				risk := captchamocks.NewMockRiskChecker(ctrl)
+				risk.EXPECT().Required(gomock.Any(), ip, phone).Return(true, nil)
+				risk.EXPECT().Record(gomock.Any(), ip, phone).Return(nil)
+				verifier := captchamocks.NewMockVerifier(ctrl)
+				verifier.EXPECT().Verify(gomock.Any(), "abc", ip).Return(true, nil)
+				return codeSvc, verifier, risk
+			},
+			reqBody:      `{"phone": "15212345678", "captcha_token": "abc"}`,
+			expectedBody: `{"code":0,"msg":"发送成功","data":null}`,
+		},
+		{
+			name: "风控出错，不拦截",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, captcha.Verifier, captcha.RiskChecker) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Send(gomock.Any(), biz, gomock.Any(), phone).Return(nil)
+				risk := captchamocks.NewMockRiskChecker(ctrl)
+				risk.EXPECT().Required(gomock.Any(), ip, phone).Return(false, errors.New("mock redis error"))
+				risk.EXPECT().Record(gomock.Any(), ip, phone).Return(nil)
+				return codeSvc, captchamocks.NewMockVerifier(ctrl), risk
+			},
+			reqBody:      `{"phone": "15212345678"}`,
+			expectedBody: `{"code":0,"msg":"发送成功","data":null}`,
+		},
+		{
+			name: "人机验证出错",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, captcha.Verifier, captcha.RiskChecker) {
+				risk := captchamocks.NewMockRiskChecker(ctrl)
+				risk.EXPECT().Required(gomock.Any(), ip, phone).Return(true, nil)
+				risk.EXPECT().Record(gomock.Any(), ip, phone).Return(nil)
+				verifier := captchamocks.NewMockVerifier(ctrl)
+				verifier.EXPECT().Verify(gomock.Any(), "abc", ip).Return(false, errors.New("mock redis error"))
+				return svcmocks.NewMockCodeService(ctrl), verifier, risk
+			},
+			reqBody:      `{"phone": "15212345678", "captcha_token": "abc"}`,
+			expectedBody: `{"code":5,"msg":"系统错误","data":null}`,
+		},
+		{
+			name: "号码触发限流，按照规则提示什么时候重试",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, captcha.Verifier, captcha.RiskChecker) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Send(gomock.Any(), biz, gomock.Any(), phone).
+					Return(&service.ErrSMSLimited{Dimension: smsratelimit.DimensionPhone, RetryAfter: time.Minute*90 + time.Second})
+				risk := captchamocks.NewMockRiskChecker(ctrl)
+				risk.EXPECT().Required(gomock.Any(), ip, phone).Return(false, nil)
+				risk.EXPECT().Record(gomock.Any(), ip, phone).Return(nil)
+				return codeSvc, captchamocks.NewMockVerifier(ctrl), risk
+			},
+			reqBody:      `{"phone": "15212345678"}`,
+			expectedBody: `{"code":4,"msg":"该手机号发送次数过多，请 2 小时后再试","data":{"retry_after":5401}}`,
+		},
+		{
+			name: "IP 触发限流",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, captcha.Verifier, captcha.RiskChecker) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Send(gomock.Any(), biz, gomock.Any(), phone).
+					Return(&service.ErrSMSLimited{Dimension: smsratelimit.DimensionIP, RetryAfter: time.Second * 30})
+				risk := captchamocks.NewMockRiskChecker(ctrl)
+				risk.EXPECT().Required(gomock.Any(), ip, phone).Return(false, nil)
+				risk.EXPECT().Record(gomock.Any(), ip, phone).Return(nil)
+				return codeSvc, captchamocks.NewMockVerifier(ctrl), risk
+			},
+			reqBody:      `{"phone": "15212345678"}`,
+			expectedBody: `{"code":4,"msg":"发送太频繁，请 30 秒后再试","data":{"retry_after":30}}`,
+		},
+		{
+			name: "不知道什么时候可以重试",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, captcha.Verifier, captcha.RiskChecker) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Send(gomock.Any(), biz, gomock.Any(), phone).
+					Return(&service.ErrSMSLimited{Dimension: smsratelimit.DimensionPhone})
+				risk := captchamocks.NewMockRiskChecker(ctrl)
+				risk.EXPECT().Required(gomock.Any(), ip, phone).Return(false, nil)
+				risk.EXPECT().Record(gomock.Any(), ip, phone).Return(nil)
+				return codeSvc, captchamocks.NewMockVerifier(ctrl), risk
+			},
+			reqBody:      `{"phone": "15212345678"}`,
+			expectedBody: `{"code":4,"msg":"该手机号发送次数过多，请稍后再试","data":null}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			server := gin.Default()
+			codeSvc, verifier, risk := tc.mock(ctrl)
+			h := NewUserHandler(svcmocks.NewMockUserService(ctrl), codeSvc, verifier, risk)
+			h.RegisterRoutes(server)
+
+			req, err := http.NewRequest(http.MethodPost, "/users/login_sms/code/send", bytes.NewBuffer([]byte(tc.reqBody)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			req.RemoteAddr = ip + ":1234"
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tc.expectedBody, resp.Body.String())
+		})
+	}
+}
+
+func TestUserHandler_LoginSMS(t *testing.T) {
+	const phone = "+8615212345678"
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (service.UserService, service.CodeService)
+
+		expectedBody string
+	}{
+		{
+			name: "验证通过",
+			mock: func(ctrl *gomock.Controller) (service.UserService, service.CodeService) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Verify(gomock.Any(), biz, notify.ChannelSMS, phone, "123456").
+					Return(domain.CodeVerifyResult{Status: domain.CodeVerifyOK}, nil)
+				userSvc := svcmocks.NewMockUserService(ctrl)
+				userSvc.EXPECT().FindOrCreate(gomock.Any(), phone).Return(domain.User{Id: 1}, nil)
+				return userSvc, codeSvc
+			},
+			expectedBody: `{"code":0,"msg":"验证码校验通过","data":null}`,
+		},
+		{
+			name: "输错了",
+			mock: func(ctrl *gomock.Controller) (service.UserService, service.CodeService) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Verify(gomock.Any(), biz, notify.ChannelSMS, phone, "123456").
+					Return(domain.CodeVerifyResult{Status: domain.CodeVerifyWrong, Remaining: 2}, nil)
+				return svcmocks.NewMockUserService(ctrl), codeSvc
+			},
+			expectedBody: `{"code":4001,"msg":"验证码错误，还可以输入 2 次","data":{"remaining":2}}`,
+		},
+		{
+			name: "最后一次也输错了",
+			mock: func(ctrl *gomock.Controller) (service.UserService, service.CodeService) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Verify(gomock.Any(), biz, notify.ChannelSMS, phone, "123456").
+					Return(domain.CodeVerifyResult{Status: domain.CodeVerifyWrong}, nil)
+				return svcmocks.NewMockUserService(ctrl), codeSvc
+			},
+			expectedBody: `{"code":4002,"msg":"验证码错误次数太多，请重新获取","data":null}`,
+		},
+		{
+			name: "次数用完",
+			mock: func(ctrl *gomock.Controller) (service.UserService, service.CodeService) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Verify(gomock.Any(), biz, notify.ChannelSMS, phone, "123456").
+					Return(domain.CodeVerifyResult{Status: domain.CodeVerifyExhausted}, nil)
+				return svcmocks.NewMockUserService(ctrl), codeSvc
+			},
+			expectedBody: `{"code":4002,"msg":"验证码错误次数太多，请重新获取","data":null}`,
+		},
+		{
+			name: "已经用过了",
+			mock: func(ctrl *gomock.Controller) (service.UserService, service.CodeService) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Verify(gomock.Any(), biz, notify.ChannelSMS, phone, "123456").
+					Return(domain.CodeVerifyResult{Status: domain.CodeVerifyUsed}, nil)
+				return svcmocks.NewMockUserService(ctrl), codeSvc
+			},
+			expectedBody: `{"code":4003,"msg":"验证码已经使用过，请重新获取","data":null}`,
+		},
+		{
+			name: "过期了",
+			mock: func(ctrl *gomock.Controller) (service.UserService, service.CodeService) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Verify(gomock.Any(), biz, notify.ChannelSMS, phone, "123456").
+					Return(domain.CodeVerifyResult{Status: domain.CodeVerifyExpired}, nil)
+				return svcmocks.NewMockUserService(ctrl), codeSvc
+			},
+			expectedBody: `{"code":4004,"msg":"验证码已过期，请重新获取","data":null}`,
+		},
+		{
+			name: "没有发送过",
+			mock: func(ctrl *gomock.Controller) (service.UserService, service.CodeService) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Verify(gomock.Any(), biz, notify.ChannelSMS, phone, "123456").
+					Return(domain.CodeVerifyResult{Status: domain.CodeVerifyNotSent}, nil)
+				return svcmocks.NewMockUserService(ctrl), codeSvc
+			},
+			expectedBody: `{"code":4005,"msg":"请先获取验证码","data":null}`,
+		},
+		{
+			name: "系统错误",
+			mock: func(ctrl *gomock.Controller) (service.UserService, service.CodeService) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Verify(gomock.Any(), biz, notify.ChannelSMS, phone, "123456").
+					Return(domain.CodeVerifyResult{}, errors.New("mock redis error"))
+				return svcmocks.NewMockUserService(ctrl), codeSvc
+			},
+			expectedBody: `{"code":5,"msg":"系统错误","data":null}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			server := gin.Default()
+			userSvc, codeSvc := tc.mock(ctrl)
+			h := NewUserHandler(userSvc, codeSvc, nil, nil)
+			h.RegisterRoutes(server)
+
+			req, err := http.NewRequest(http.MethodPost, "/users/login_sms",
+				bytes.NewBuffer([]byte(`{"phone": "15212345678", "code": "123456"}`)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tc.expectedBody, resp.Body.String())
+		})
+	}
+}
+
+func TestUserHandler_SendLoginEmailCode(t *testing.T) {
+	const (
+		ip    = "192.0.2.1"
+		email = "abc@qq.com"
+	)
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (service.CodeService, captcha.Verifier, captcha.RiskChecker)
+
+		reqBody string
+
+		expectedBody string
+	}{
+		{
+			name: "没有风险，直接发送",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, captcha.Verifier, captcha.RiskChecker) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Send(gomock.Any(), biz, notify.ChannelEmail, email).Return(nil)
+				risk := captchamocks.NewMockRiskChecker(ctrl)
+				risk.EXPECT().Required(gomock.Any(), ip, email).Return(false, nil)
+				risk.EXPECT().Record(gomock.Any(), ip, email).Return(nil)
+				return codeSvc, captchamocks.NewMockVerifier(ctrl), risk
+			},
+			// 大小写和空格不同也是同一个邮箱
+			reqBody:      `{"email": " ABC@qq.com "}`,
+			expectedBody: `{"code":0,"msg":"发送成功","data":null}`,
+		},
+		{
+			name: "触发风控，没有完成人机验证",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, captcha.Verifier, captcha.RiskChecker) {
+				risk := captchamocks.NewMockRiskChecker(ctrl)
+				risk.EXPECT().Required(gomock.Any(), ip, email).Return(true, nil)
+				risk.EXPECT().Record(gomock.Any(), ip, email).Return(nil)
+				verifier := captchamocks.NewMockVerifier(ctrl)
+				verifier.EXPECT().Verify(gomock.Any(), "", ip).Return(false, nil)
+				return svcmocks.NewMockCodeService(ctrl), verifier, risk
+			},
+			reqBody:      `{"email": "abc@qq.com"}`,
+			expectedBody: `{"code":4,"msg":"请先完成人机验证","data":{"captcha_required":true}}`,
+		},
+		{
+			name: "触发风控，人机验证通过",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, captcha.Verifier, captcha.RiskChecker) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Send(gomock.Any(), biz, notify.ChannelEmail, email).Return(nil)
+				risk := captchamocks.NewMockRiskChecker(ctrl)
+				risk.EXPECT().Required(gomock.Any(), ip, email).Return(true, nil)
+				risk.EXPECT().Record(gomock.Any(), ip, email).Return(nil)
+				verifier := captchamocks.NewMockVerifier(ctrl)
+				verifier.EXPECT().Verify(gomock.Any(), "abc", ip).Return(true, nil)
+				return codeSvc, verifier, risk
+			},
+			reqBody:      `{"email": "abc@qq.com", "captcha_token": "abc"}`,
+			expectedBody: `{"code":0,"msg":"发送成功","data":null}`,
+		},
+		{
+			name: "邮箱格式错误",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, captcha.Verifier, captcha.RiskChecker) {
+				return svcmocks.NewMockCodeService(ctrl), captchamocks.NewMockVerifier(ctrl), captchamocks.NewMockRiskChecker(ctrl)
+			},
+			reqBody:      `{"email": "abc"}`,
+			expectedBody: `{"code":4,"msg":"邮箱格式错误","data":null}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			server := gin.Default()
+			codeSvc, verifier, risk := tc.mock(ctrl)
+			h := NewUserHandler(svcmocks.NewMockUserService(ctrl), codeSvc, verifier, risk)
+			h.RegisterRoutes(server)
+
+			req, err := http.NewRequest(http.MethodPost, "/users/login_email/code/send", bytes.NewBuffer([]byte(tc.reqBody)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			req.RemoteAddr = ip + ":1234"
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tc.expectedBody, resp.Body.String())
+		})
+	}
+}
+
+func TestUserHandler_LoginEmail(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (service.UserService, service.CodeService)
+
+		reqBody string
+
+		expectedBody string
+	}{
+		{
+			name: "验证通过",
+			mock: func(ctrl *gomock.Controller) (service.UserService, service.CodeService) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Verify(gomock.Any(), biz, notify.ChannelEmail, "123@qq.com", "123456").
+					Return(domain.CodeVerifyResult{Status: domain.CodeVerifyOK}, nil)
+				userSvc := svcmocks.NewMockUserService(ctrl)
+				userSvc.EXPECT().FindOrCreateByEmail(gomock.Any(), "123@qq.com").Return(domain.User{Id: 1}, nil)
+				return userSvc, codeSvc
+			},
+			reqBody:      `{"email": "123@qq.com", "code": "123456"}`,
+			expectedBody: `{"code":0,"msg":"验证码校验通过","data":null}`,
+		},
+		{
+			name: "邮箱的大小写和空格不影响",
+			mock: func(ctrl *gomock.Controller) (service.UserService, service.CodeService) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Verify(gomock.Any(), biz, notify.ChannelEmail, "abc@qq.com", "123456").
+					Return(domain.CodeVerifyResult{Status: domain.CodeVerifyOK}, nil)
+				userSvc := svcmocks.NewMockUserService(ctrl)
+				userSvc.EXPECT().FindOrCreateByEmail(gomock.Any(), "abc@qq.com").Return(domain.User{Id: 1}, nil)
+				return userSvc, codeSvc
+			},
+			reqBody:      `{"email": " ABC@qq.com ", "code": "123456"}`,
+			expectedBody: `{"code":0,"msg":"验证码校验通过","data":null}`,
+		},
+		{
+			name: "手机号码不能当成邮箱",
+			mock: func(ctrl *gomock.Controller) (service.UserService, service.CodeService) {
+				return svcmocks.NewMockUserService(ctrl), svcmocks.NewMockCodeService(ctrl)
+			},
+			reqBody:      `{"email": "+8615212345678", "code": "123456"}`,
+			expectedBody: `{"code":4,"msg":"邮箱格式错误","data":null}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			server := gin.Default()
+			userSvc, codeSvc := tc.mock(ctrl)
+			h := NewUserHandler(userSvc, codeSvc, nil, nil)
+			h.RegisterRoutes(server)
+
+			req, err := http.NewRequest(http.MethodPost, "/users/login_email", bytes.NewBuffer([]byte(tc.reqBody)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tc.expectedBody, resp.Body.String())
+		})
+	}
+}
+
 func TestMock(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
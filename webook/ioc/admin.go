@@ -0,0 +1,19 @@
+package ioc
+
+import (
+	"expvar"
+	"net/http"
+
+	"geektime/webook/config"
+)
+
+// InitAdminServer 内部管理端口，和业务端口分开，不经过登录校验和限流。
+// /debug/vars 是 expvar 暴露的指标，例如 ratelimit_degraded_decisions
+func InitAdminServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	return &http.Server{
+		Addr:    config.Config.Admin.Addr,
+		Handler: mux,
+	}
+}
@@ -0,0 +1,18 @@
+package ioc
+
+import (
+	"github.com/redis/go-redis/v9"
+
+	"geektime/webook/config"
+	"geektime/webook/internal/service/captcha"
+)
+
+// InitCaptchaVerifier 接入第三方人机验证的时候在这里替换
+func InitCaptchaVerifier(svc captcha.Service) captcha.Verifier {
+	return svc
+}
+
+func InitCaptchaRiskChecker(cmd redis.Cmdable) captcha.RiskChecker {
+	cfg := config.Config.Captcha
+	return captcha.NewRiskChecker(cmd, cfg.Window, cfg.IPThreshold, cfg.PhoneThreshold)
+}
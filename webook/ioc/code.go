@@ -0,0 +1,77 @@
+package ioc
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/redis/go-redis/v9"
+
+	"geektime/webook/config"
+	"geektime/webook/internal/domain"
+	"geektime/webook/internal/repository/cache"
+	"geektime/webook/internal/service"
+	"geektime/webook/internal/service/notify"
+)
+
+func InitCodeCache(cmd redis.Cmdable) (cache.CodeCache, error) {
+	cfg := config.Config.Code
+	local := cache.NewLocalCodeCache(cfg.LocalCapacity)
+	if cfg.LocalOnly {
+		return local, nil
+	}
+	if cfg.Secret == "" {
+		return nil, errors.New("没有配置验证码的 HMAC 密钥")
+	}
+	return cache.NewFallbackCodeCache(cache.NewCodeCache(cmd, []byte(cfg.Secret)), local), nil
+}
+
+// InitCodeBizRegistry 新增一个用验证码的业务只需要在配置里面注册
+func InitCodeBizRegistry() (service.CodeBizRegistry, error) {
+	bizs := make([]service.CodeBiz, 0, len(config.Config.Code.Biz))
+	for name, cfg := range config.Config.Code.Biz {
+		if err := checkSMSTemplate(name, cfg); err != nil {
+			return nil, err
+		}
+		channels := make([]notify.Channel, 0, len(cfg.Channels))
+		for _, ch := range cfg.Channels {
+			channels = append(channels, notify.Channel(ch))
+		}
+		bizs = append(bizs, service.CodeBiz{
+			Name:     name,
+			Template: cfg.Template,
+			Channels: channels,
+			ProofTTL: cfg.ProofTTL,
+			Policy: domain.CodePolicy{
+				Length:         cfg.Policy.Length,
+				Alphabet:       cfg.Policy.Alphabet,
+				TTL:            cfg.Policy.TTL,
+				ResendInterval: cfg.Policy.ResendInterval,
+				MaxAttempts:    cfg.Policy.MaxAttempts,
+			},
+		})
+	}
+	return service.NewCodeBizRegistry(bizs...), nil
+}
+
+// checkSMSTemplate 用短信发验证码的业务，当前的服务商一定要有对应的模板，
+// 不然启动的时候看不出来，上线之后这个业务的短信全部发送失败
+func checkSMSTemplate(biz string, cfg config.CodeBizConfig) error {
+	if !slices.Contains(cfg.Channels, string(notify.ChannelSMS)) {
+		return nil
+	}
+	provider := config.Config.SMS.Provider
+	tpl, ok := config.Config.SMS.Templates[cfg.Template][provider]
+	if !ok || tpl.Id == "" {
+		return fmt.Errorf("验证码业务 %s 的短信模板 %s 没有配置服务商 %s 的模板 ID", biz, cfg.Template, provider)
+	}
+	return nil
+}
+
+func InitCodeProofKey() (service.CodeProofKey, error) {
+	key := config.Config.Code.ProofKey
+	if key == "" {
+		return nil, errors.New("没有配置签发验证凭证的密钥")
+	}
+	return service.CodeProofKey(key), nil
+}
@@ -0,0 +1,27 @@
+package ioc
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"geektime/webook/config"
+	"geektime/webook/internal/repository"
+	"geektime/webook/internal/service"
+	"geektime/webook/pkg/concurrency"
+	ginconcurrency "geektime/webook/pkg/ginx/middlewares/concurrency"
+)
+
+// InitUserService MySQL 变慢的时候少发一点请求给它
+func InitUserService(repo repository.UserRepository) service.UserService {
+	cfg := config.Config.Concurrency.UserService
+	return service.NewConcurrencyLimitedUserService(service.NewUserService(repo),
+		concurrency.NewLimiter(cfg.Initial, cfg.Min, cfg.Max, cfg.Target))
+}
+
+// initConcurrencyMiddleware 过载的时候最先丢弃修改资料这种请求，登录和查看资料最后丢弃
+func initConcurrencyMiddleware() gin.HandlerFunc {
+	cfg := config.Config.Concurrency.HTTP
+	return ginconcurrency.NewBuilder(concurrency.NewLimiter(cfg.Initial, cfg.Min, cfg.Max, cfg.Target)).
+		Priority(concurrency.PriorityHigh, "/users/login", "/users/login_sms", "/users/login_email", "/users/profile").
+		Priority(concurrency.PriorityLow, "/users/edit").
+		Build()
+}
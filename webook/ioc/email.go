@@ -0,0 +1,35 @@
+package ioc
+
+import (
+	"fmt"
+
+	"geektime/webook/config"
+	"geektime/webook/internal/service/email"
+	"geektime/webook/internal/service/email/memory"
+	"geektime/webook/internal/service/email/smtp"
+)
+
+// InitEmailService 线上用 SMTP，开发环境可以配置成内存发件箱
+func InitEmailService() email.Service {
+	cfg := config.Config.Email
+	switch cfg.Provider {
+	case "smtp":
+		if cfg.SMTP.Addr == "" {
+			panic("没有配置 SMTP 服务器")
+		}
+		svc, err := smtp.NewService(cfg.SMTP.Addr, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.From, cfg.SMTP.Timeout)
+		if err != nil {
+			panic(err)
+		}
+		return svc
+	case "memory":
+		return InitMemoryEmailService(memory.NewService())
+	default:
+		panic(fmt.Sprintf("不支持的邮件服务 %q", cfg.Provider))
+	}
+}
+
+// InitMemoryEmailService 内存发件箱里面是明文的验证码，只给开发环境和测试用
+func InitMemoryEmailService(outbox *memory.Service) email.Service {
+	return outbox
+}
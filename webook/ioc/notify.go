@@ -0,0 +1,27 @@
+package ioc
+
+import (
+	"geektime/webook/config"
+	"geektime/webook/internal/service/email"
+	"geektime/webook/internal/service/notify"
+	"geektime/webook/internal/service/sms"
+)
+
+func InitNotifyService(smsSvc sms.Service, emailSvc email.Service) notify.Service {
+	tpls := make(map[string]notify.EmailTemplate, len(config.Config.Email.Templates))
+	for name, cfg := range config.Config.Email.Templates {
+		tpls[name] = notify.EmailTemplate{
+			Subject: cfg.Subject,
+			Body:    cfg.Body,
+			Params:  cfg.Params,
+		}
+	}
+	emailSender, err := notify.NewEmailSender(emailSvc, tpls)
+	if err != nil {
+		panic(err)
+	}
+	return notify.NewService(map[notify.Channel]notify.Sender{
+		notify.ChannelSMS:   notify.NewSMSSender(smsSvc),
+		notify.ChannelEmail: emailSender,
+	})
+}
@@ -0,0 +1,176 @@
+package ioc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"geektime/webook/config"
+	smsratelimit "geektime/webook/internal/service/sms/ratelimit"
+	"geektime/webook/internal/web/middleware"
+	ginratelimit "geektime/webook/pkg/ginx/middlewares/ratelimit"
+	"geektime/webook/pkg/ratelimit"
+)
+
+// defaultHTTPRateLimitRules 登录、发验证码这种容易被刷的接口限制得更严格。
+// 规则源里面的同名规则会覆盖默认规则
+var defaultHTTPRateLimitRules = []ratelimit.RuleSpec{
+	{
+		// Redis 出问题的时候也不能让人随便试密码
+		Name: "login", Method: http.MethodPost, Path: "/users/login", Key: "ip",
+		Algorithm: ratelimit.AlgorithmSlidingWindow, Interval: time.Minute, Rate: 10, FailurePolicy: "local",
+	},
+	{
+		Name: "login_sms_code", Method: http.MethodPost, Path: "/users/login_sms/code/send", Key: "ip",
+		Algorithm: ratelimit.AlgorithmSlidingWindow, Interval: time.Minute, Rate: 5, FailurePolicy: "local",
+	},
+	{
+		Name: "login_email_code", Method: http.MethodPost, Path: "/users/login_email/code/send", Key: "ip",
+		Algorithm: ratelimit.AlgorithmSlidingWindow, Interval: time.Minute, Rate: 5, FailurePolicy: "local",
+	},
+	{
+		// 已经登录的用户，Redis 出问题的时候放行
+		Name: "profile", Path: "/users/profile", Key: "uid",
+		Algorithm: ratelimit.AlgorithmTokenBucket, Interval: time.Second, Rate: 10, Burst: 20, FailurePolicy: "open",
+	},
+	{
+		// 兜底，每个 IP 的总请求数
+		Name: "ip", Key: "ip",
+		Algorithm: ratelimit.AlgorithmHybrid, Interval: time.Second, Rate: 100, Burst: 200,
+	},
+}
+
+// initHTTPRateLimitBuilder 先用默认规则，规则源里面的规则变了就和默认规则合并之后整体替换
+func initHTTPRateLimitBuilder(cmd redis.Cmdable) *ginratelimit.Builder {
+	rules, err := httpRateLimitRules(cmd, defaultHTTPRateLimitRules)
+	if err != nil {
+		panic(err)
+	}
+	builder := ginratelimit.NewBuilder(rules...)
+	cfg := config.Config.RateLimit
+	watchRateLimitRules(rateLimitRuleSource(cmd, cfg.HTTPFile, cfg.HTTPKey), defaultHTTPRateLimitRules, func(specs []ratelimit.RuleSpec) error {
+		rules, err := httpRateLimitRules(cmd, specs)
+		if err != nil {
+			return err
+		}
+		builder.SetRules(rules...)
+		return nil
+	})
+	return builder
+}
+
+func httpRateLimitRules(cmd redis.Cmdable, specs []ratelimit.RuleSpec) ([]ginratelimit.Rule, error) {
+	rules := make([]ginratelimit.Rule, 0, len(specs))
+	for _, spec := range specs {
+		key, err := httpRateLimitKey(spec.Key)
+		if err != nil {
+			return nil, fmt.Errorf("%w：%s %w", ratelimit.ErrInvalidRule, spec.Name, err)
+		}
+		limiter, err := ratelimit.NewLimiterFromSpec(cmd, "http", spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, ginratelimit.Rule{
+			Name:    spec.Name,
+			Method:  spec.Method,
+			Path:    spec.Path,
+			Key:     key,
+			Limiter: limiter,
+		})
+	}
+	return rules, nil
+}
+
+// httpRateLimitKey ip、uid 或者 header:请求头，例如 header:X-Api-Key
+func httpRateLimitKey(key string) (ginratelimit.KeyFunc, error) {
+	switch {
+	case key == "ip":
+		return ginratelimit.IP(), nil
+	case key == "uid":
+		// 要放在登录校验后面才拿得到 claims
+		return ginratelimit.ContextValue("claims", middleware.ClaimsUid), nil
+	case strings.HasPrefix(key, "header:") && len(key) > len("header:"):
+		return ginratelimit.Header(strings.TrimPrefix(key, "header:")), nil
+	default:
+		return nil, fmt.Errorf("不支持的限流对象 %q", key)
+	}
+}
+
+// initSMSRateLimitRules 默认规则来自 SMS.RateLimits，Key 是限流的维度
+func initSMSRateLimitRules(cmd redis.Cmdable) *smsratelimit.Rules {
+	cfgs := config.Config.SMS.RateLimits
+	defaults := make([]ratelimit.RuleSpec, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		defaults = append(defaults, ratelimit.RuleSpec{
+			Name:          cfg.Dimension,
+			Key:           cfg.Dimension,
+			Algorithm:     ratelimit.AlgorithmSlidingWindow,
+			Interval:      cfg.Interval,
+			Rate:          cfg.Rate,
+			FailurePolicy: cfg.FailurePolicy,
+		})
+	}
+	rules, err := smsRateLimitRules(cmd, defaults)
+	if err != nil {
+		panic(err)
+	}
+	res := smsratelimit.NewRules(rules...)
+	rCfg := config.Config.RateLimit
+	// 不管规则源里面是什么顺序，smsratelimit.Rules 都按照从粗到细的维度检查
+	watchRateLimitRules(rateLimitRuleSource(cmd, rCfg.SMSFile, rCfg.SMSKey), defaults, func(specs []ratelimit.RuleSpec) error {
+		rules, err := smsRateLimitRules(cmd, specs)
+		if err != nil {
+			return err
+		}
+		res.Set(rules...)
+		return nil
+	})
+	return res
+}
+
+func smsRateLimitRules(cmd redis.Cmdable, specs []ratelimit.RuleSpec) ([]smsratelimit.Rule, error) {
+	rules := make([]smsratelimit.Rule, 0, len(specs))
+	for _, spec := range specs {
+		dimension := smsratelimit.Dimension(spec.Key)
+		switch dimension {
+		case smsratelimit.DimensionPhone, smsratelimit.DimensionIP,
+			smsratelimit.DimensionBiz, smsratelimit.DimensionGlobal:
+		default:
+			return nil, fmt.Errorf("%w：%s 不支持的维度 %q", ratelimit.ErrInvalidRule, spec.Name, spec.Key)
+		}
+		// 降级为本地限流的时候，每个实例都按照整个集群的配额来，宁可放宽也不要误伤
+		limiter, err := ratelimit.NewLimiterFromSpec(cmd, "sms", spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, smsratelimit.Rule{
+			Dimension: dimension,
+			Limiter:   limiter,
+		})
+	}
+	return rules, nil
+}
+
+func rateLimitRuleSource(cmd redis.Cmdable, file, key string) ratelimit.RuleSource {
+	switch config.Config.RateLimit.Source {
+	case "file":
+		return ratelimit.NewFileRuleSource(file)
+	case "redis":
+		return ratelimit.NewRedisHashRuleSource(cmd, key)
+	default:
+		return nil
+	}
+}
+
+// watchRateLimitRules 跟着应用一直跑
+func watchRateLimitRules(source ratelimit.RuleSource, defaults []ratelimit.RuleSpec,
+	apply func(specs []ratelimit.RuleSpec) error) {
+	if source == nil {
+		return
+	}
+	go ratelimit.WatchRules(context.Background(), source, config.Config.RateLimit.PollInterval, defaults, apply)
+}
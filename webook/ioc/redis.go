@@ -1,14 +1,26 @@
 package ioc
 
 import (
+	"context"
+	"log"
+	"time"
+
 	"github.com/redis/go-redis/v9"
 
 	"geektime/webook/config"
+	"geektime/webook/pkg/redisx"
 )
 
 func InitRedis() redis.Cmdable {
 	rCfg := config.Config.Redis
-	return redis.NewClient(&redis.Options{
+	client := redis.NewClient(&redis.Options{
 		Addr: rCfg.Addr,
 	})
+	// 提前把 lua 脚本加载进去，失败了也不影响启动，执行的时候会重新加载
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := redisx.PreloadAll(ctx, client); err != nil {
+		log.Println("预加载 lua 脚本失败", err)
+	}
+	return client
 }
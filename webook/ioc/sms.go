@@ -1,10 +1,123 @@
 package ioc
 
 import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	tencentsms "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/sms/v20210111"
+
+	"geektime/webook/config"
+	"geektime/webook/internal/repository"
 	"geektime/webook/internal/service/sms"
+	"geektime/webook/internal/service/sms/budget"
+	"geektime/webook/internal/service/sms/gateway"
 	"geektime/webook/internal/service/sms/memory"
+	smsratelimit "geektime/webook/internal/service/sms/ratelimit"
+	"geektime/webook/internal/service/sms/record"
+	"geektime/webook/internal/service/sms/template"
+	"geektime/webook/internal/service/sms/tencent"
+	"geektime/webook/internal/web"
 )
 
-func InitSMSService() sms.Service {
-	return memory.NewService()
+// SMSProvider 真正发短信的服务商，Name 用来记录发送记录和计价
+type SMSProvider struct {
+	Name string
+	Svc  sms.Service
+}
+
+// InitSMSProvider 线上用腾讯云，开发环境可以配置成内存发件箱
+func InitSMSProvider(tpls template.Registry) SMSProvider {
+	cfg := config.Config.SMS
+	switch cfg.Provider {
+	case tencent.Provider:
+		secretId, secretKey := os.Getenv("TENCENTCLOUD_SECRET_ID"), os.Getenv("TENCENTCLOUD_SECRET_KEY")
+		if secretId == "" || secretKey == "" || cfg.Tencent.AppId == "" {
+			panic("没有配置腾讯云短信的 AppId、SecretId 或者 SecretKey")
+		}
+		client, err := tencentsms.NewClientWithSecretId(secretId, secretKey, cfg.Tencent.Region)
+		if err != nil {
+			panic(err)
+		}
+		return SMSProvider{
+			Name: tencent.Provider,
+			// 腾讯云自己的频率限制由前面的限流规则兜底
+			Svc: tencent.NewService(cfg.Tencent.AppId, cfg.Tencent.SignName, client, nil, tpls),
+		}
+	case memory.Provider:
+		return InitMemorySMSProvider(memory.NewService(tpls))
+	default:
+		panic(fmt.Sprintf("不支持的短信服务商 %q", cfg.Provider))
+	}
+}
+
+// InitMemorySMSProvider 内存发件箱里面是明文的验证码，只给开发环境和测试用
+func InitMemorySMSProvider(outbox *memory.Service) SMSProvider {
+	return SMSProvider{Name: memory.Provider, Svc: outbox}
+}
+
+// InitSMSService 配置了短信网关就走网关，否则在本地发送
+func InitSMSService(provider SMSProvider, repo repository.SMSRecordRepository, cmd redis.Cmdable) sms.Service {
+	gwCfg := config.Config.SMS.Gateway
+	if gwCfg.Addr != "" {
+		return gateway.NewClient(gwCfg.Addr, gwCfg.Token, &http.Client{
+			Timeout: time.Second * 3,
+		})
+	}
+	return InitLocalSMSService(provider, repo, cmd)
+}
+
+// InitLocalSMSService 本地的短信服务，短信网关自己也用这个
+func InitLocalSMSService(provider SMSProvider, repo repository.SMSRecordRepository, cmd redis.Cmdable) sms.Service {
+	// 发送记录要直接装饰服务商的实现，才能拿到服务商的流水号
+	svc := record.NewService(provider.Svc, provider.Name, repo)
+	budgetCfg := config.Config.SMS.Budget
+	svc = budget.NewService(svc, provider.Name, cmd, smsPrice(budgetCfg, provider.Name),
+		budgetCfg.Daily, budgetCfg.Monthly, budgetCfg.Thresholds, budget.LogNotifier{})
+	return smsratelimit.NewReloadableRatelimitSMSService(svc, initSMSRateLimitRules(cmd))
+}
+
+// smsPrice 配置了预算，真正在用的服务商就必须有单价，
+// 不然每条短信都按 0 算，预算永远不会触发
+func smsPrice(cfg config.SMSBudgetConfig, provider string) int64 {
+	if cfg.Daily <= 0 && cfg.Monthly <= 0 {
+		return cfg.Prices[provider]
+	}
+	price, ok := cfg.Prices[provider]
+	if !ok || price <= 0 {
+		panic(fmt.Sprintf("配置了短信预算，但是没有配置服务商 %q 的单价", provider))
+	}
+	return price
+}
+
+// InitSMSGatewayHandler 短信网关对外的接口，没有密钥不能启动
+func InitSMSGatewayHandler(svc sms.Service) *web.SMSHandler {
+	key := config.Config.SMS.Gateway.Key
+	if key == "" {
+		panic("没有配置短信网关校验 token 的密钥")
+	}
+	return web.NewSMSHandler(svc, key)
+}
+
+// InitSMSTemplates 切换或者新增服务商，只需要改配置
+func InitSMSTemplates() template.Registry {
+	tpls := make(map[string]map[string]template.Template, len(config.Config.SMS.Templates))
+	for name, providers := range config.Config.SMS.Templates {
+		tpls[name] = make(map[string]template.Template, len(providers))
+		for provider, cfg := range providers {
+			format := template.ParamPositional
+			if cfg.Named {
+				format = template.ParamNamed
+			}
+			tpls[name][provider] = template.Template{
+				Id:         cfg.Id,
+				SignName:   cfg.SignName,
+				Format:     format,
+				ParamNames: cfg.Params,
+			}
+		}
+	}
+	return template.NewMapRegistry(tpls)
 }
@@ -0,0 +1,23 @@
+package ioc
+
+import (
+	"geektime/webook/config"
+	"geektime/webook/internal/repository"
+	"geektime/webook/internal/web"
+)
+
+func InitSMSPhoneHashKey() repository.SMSPhoneHashKey {
+	key := config.Config.SMS.Record.PhoneHashKey
+	if key == "" {
+		panic("没有配置短信号码摘要的密钥")
+	}
+	return repository.SMSPhoneHashKey(key)
+}
+
+func InitSMSRecordAuth() web.SMSRecordAuth {
+	cfg := config.Config.SMS.Record
+	return web.SMSRecordAuth{
+		CallbackToken: cfg.CallbackToken,
+		SupportUids:   cfg.SupportUids,
+	}
+}
@@ -0,0 +1,31 @@
+package ioc
+
+import (
+	"context"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+
+	"geektime/webook/config"
+	"geektime/webook/internal/repository/cache"
+)
+
+// InitUserCache 配置了本地缓存，并且 Redis 客户端支持订阅的时候，用本地 + Redis 两级缓存
+func InitUserCache(cmd redis.Cmdable) cache.UserCache {
+	cfg := config.Config.UserCache
+	remote := cache.NewUserCache(cmd)
+	if cfg.LocalCapacity <= 0 {
+		return remote
+	}
+	sub, ok := cmd.(cache.Subscriber)
+	if !ok {
+		// 收不到删除通知，本地缓存会读到旧数据
+		log.Println("redis 客户端不支持订阅，不使用本地用户缓存")
+		return remote
+	}
+	c := cache.NewTwoLevelUserCache(remote, cmd, cfg.LocalCapacity, cfg.LocalTTL)
+	go func() {
+		_ = c.Listen(context.Background(), sub)
+	}()
+	return c
+}
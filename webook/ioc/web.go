@@ -10,13 +10,15 @@ import (
 
 	"geektime/webook/internal/web"
 	"geektime/webook/internal/web/middleware"
-	"geektime/webook/pkg/ginx/middlewares/ratelimit"
 )
 
-func InitWebServer(mdls []gin.HandlerFunc, hdl *web.UserHandler) *gin.Engine {
+func InitWebServer(mdls []gin.HandlerFunc, hdl *web.UserHandler, smsRecordHdl *web.SMSRecordHandler,
+	captchaHdl *web.CaptchaHandler) *gin.Engine {
 	server := gin.Default()
 	server.Use(mdls...)
 	hdl.RegisterRoutes(server)
+	smsRecordHdl.RegisterRoutes(server)
+	captchaHdl.RegisterRoutes(server)
 	return server
 }
 
@@ -25,8 +27,9 @@ func InitMiddlewares(redisClient redis.Cmdable) []gin.HandlerFunc {
 		cors.New(cors.Config{
 			// AllowOrigins:     []string{"https://localhost:3000"},
 			// AllowMethods:     []string{"POST", "GET"},
-			AllowHeaders:     []string{"Content-Type", "Authorization"},
-			ExposeHeaders:    []string{"x-jwt-token"},
+			AllowHeaders: []string{"Content-Type", "Authorization"},
+			// 限流的响应头也要暴露出去，前端才能知道什么时候重试
+			ExposeHeaders:    []string{"x-jwt-token", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
 			AllowCredentials: true,
 			AllowOriginFunc: func(origin string) bool {
 				if strings.HasPrefix(origin, "http://localhost") {
@@ -37,8 +40,12 @@ func InitMiddlewares(redisClient redis.Cmdable) []gin.HandlerFunc {
 			},
 			MaxAge: 12 * time.Hour,
 		}),
+		// 尽早拒绝，但是要在 cors 后面，不然前端拿不到 503
+		initConcurrencyMiddleware(),
 		middleware.NewLoginJWTMiddlewareBuilder().IgnorePaths("/users/signup",
-			"/users/login", "/users/login_sms/code/send", "/users/login_sms", "/hello").Build(),
-		ratelimit.NewBuilder(redisClient, time.Second, 10).Build(),
+			"/users/login", "/users/login_sms/code/send", "/users/login_sms", "/users/login_email/code/send", "/users/login_email", "/hello",
+			"/sms/callback/tencent", "/captcha/challenge", "/captcha/check").Build(),
+		// 要放在登录校验后面，按用户限流要用到 claims
+		initHTTPRateLimitBuilder(redisClient).Build(),
 	}
 }
@@ -1,13 +1,24 @@
 package main
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+
+	"geektime/webook/ioc"
 )
 
 func main() {
-	server := InitWebServer()
+	go func() {
+		if err := ioc.InitAdminServer().ListenAndServe(); err != nil {
+			log.Println("管理端口启动失败", err)
+		}
+	}()
+	server, err := InitWebServer()
+	if err != nil {
+		log.Fatalln("初始化失败", err)
+	}
 	server.GET("/hello", func(ctx *gin.Context) {
 		ctx.String(http.StatusOK, "hello, world")
 	})
@@ -0,0 +1,130 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+var ErrOverloaded = errors.New("系统繁忙，请稍后再试")
+
+// Priority 优先级越高，系统过载的时候越晚被丢弃
+type Priority uint8
+
+const (
+	// PriorityLow 例如修改资料，最先丢弃
+	PriorityLow Priority = iota
+	PriorityNormal
+	// PriorityHigh 例如登录、查看资料，最后丢弃
+	PriorityHigh
+)
+
+// share 每个优先级最多能用掉多少比例的并发数，
+// 低优先级的请求把并发数用到一半就开始丢了，给高优先级的留出余量
+func (p Priority) share() float64 {
+	switch p {
+	case PriorityLow:
+		return 0.5
+	case PriorityNormal:
+		return 0.8
+	default:
+		return 1
+	}
+}
+
+// Limiter 自适应的并发数限制，用的是 AIMD：
+// 请求耗时在 target 以内，并发数上限每轮加一（每个请求加 1/limit）；
+// 超过 target 或者超时了，说明下游（一般是 MySQL）变慢了，并发数上限乘以 backoff。
+// 超过上限的请求直接拒绝，不要排队把下游拖得更慢
+type Limiter struct {
+	mutex    sync.Mutex
+	limit    float64
+	inflight int
+
+	min    float64
+	max    float64
+	target time.Duration
+	// 每次减小到原来的多少
+	backoff float64
+	// 一个 target 时间内只减小一次，不然一批慢请求会把上限直接打到 min
+	lastDecrease time.Time
+	now          func() time.Time
+}
+
+// NewLimiter initial 是初始的并发数上限，之后在 [min, max] 之间自动调整
+func NewLimiter(initial, min, max int, target time.Duration) *Limiter {
+	return &Limiter{
+		limit:   float64(initial),
+		min:     float64(min),
+		max:     float64(max),
+		target:  target,
+		backoff: 0.9,
+		now:     time.Now,
+	}
+}
+
+// Acquire 拿不到的时候返回 false；拿到了之后，请求结束的时候一定要调用 done，
+// err 是请求的结果，超时之类的错误也算是下游变慢了
+func (l *Limiter) Acquire(p Priority) (done func(err error), ok bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if float64(l.inflight) >= math.Max(1, math.Floor(l.limit*p.share())) {
+		return nil, false
+	}
+	l.inflight++
+	start := l.now()
+	return func(err error) {
+		l.release(l.now().Sub(start), err)
+	}, true
+}
+
+func (l *Limiter) release(latency time.Duration, err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.inflight--
+	if latency > l.target || errors.Is(err, context.DeadlineExceeded) {
+		now := l.now()
+		if now.Sub(l.lastDecrease) >= l.target {
+			l.lastDecrease = now
+			l.limit = math.Max(l.min, l.limit*l.backoff)
+		}
+		return
+	}
+	l.limit = math.Min(l.max, l.limit+1/l.limit)
+}
+
+// Inflight 当前正在处理的请求数
+func (l *Limiter) Inflight() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.inflight
+}
+
+// Limit 当前的并发数上限
+func (l *Limiter) Limit() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return int(l.limit)
+}
+
+type priorityKey struct{}
+
+// ContextKey gin.Context.Value 只认 string 的 key，gin 的中间件用 ctx.Set(ContextKey, p) 设置优先级
+const ContextKey = "concurrency-priority"
+
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom 请求的优先级，没有设置的时候用 def
+func PriorityFrom(ctx context.Context, def Priority) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	if p, ok := ctx.Value(ContextKey).(Priority); ok {
+		return p
+	}
+	return def
+}
@@ -0,0 +1,151 @@
+package concurrency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter_Acquire(t *testing.T) {
+	l := NewLimiter(10, 1, 100, time.Millisecond*100)
+	var dones []func(err error)
+	acquire := func(p Priority) bool {
+		done, ok := l.Acquire(p)
+		if ok {
+			dones = append(dones, done)
+		}
+		return ok
+	}
+	// 低优先级最多用一半
+	for i := 0; i < 5; i++ {
+		assert.True(t, acquire(PriorityLow))
+	}
+	assert.False(t, acquire(PriorityLow))
+	// 普通优先级最多用 80%
+	for i := 0; i < 3; i++ {
+		assert.True(t, acquire(PriorityNormal))
+	}
+	assert.False(t, acquire(PriorityNormal))
+	// 高优先级可以用满
+	for i := 0; i < 2; i++ {
+		assert.True(t, acquire(PriorityHigh))
+	}
+	assert.False(t, acquire(PriorityHigh))
+	assert.False(t, acquire(PriorityLow))
+
+	// 释放一个之后高优先级可以进来，低优先级还是不行
+	dones[0](nil)
+	assert.False(t, acquire(PriorityLow))
+	assert.True(t, acquire(PriorityHigh))
+}
+
+func TestLimiter_Adjust(t *testing.T) {
+	current := time.Date(2023, 10, 17, 8, 0, 0, 0, time.Local)
+	testCases := []struct {
+		name    string
+		initial int
+		// 请求耗时
+		latency time.Duration
+		err     error
+		// 上一次减小是多久以前
+		lastDecrease time.Duration
+		times        int
+		// 请求是同时进来同时结束的，不然就是一个接一个
+		concurrent bool
+
+		expected int
+	}{
+		{
+			name:    "请求都很快，加性增加",
+			initial: 10,
+			latency: time.Millisecond * 10,
+			// 每个请求加 1/limit，10 个请求加 1
+			times:    10,
+			expected: 10,
+		},
+		{
+			name:     "加到一轮之后加一",
+			initial:  10,
+			latency:  time.Millisecond * 10,
+			times:    11,
+			expected: 11,
+		},
+		{
+			name:         "请求变慢，乘性减小",
+			initial:      100,
+			latency:      time.Millisecond * 200,
+			lastDecrease: time.Hour,
+			times:        1,
+			expected:     90,
+		},
+		{
+			name:         "一个 target 内只减小一次",
+			initial:      100,
+			latency:      time.Millisecond * 200,
+			lastDecrease: time.Hour,
+			times:        5,
+			concurrent:   true,
+			expected:     90,
+		},
+		{
+			name:         "超时也算变慢",
+			initial:      100,
+			latency:      time.Millisecond * 10,
+			err:          context.DeadlineExceeded,
+			lastDecrease: time.Hour,
+			times:        1,
+			expected:     90,
+		},
+		{
+			name:         "不低于 min",
+			initial:      5,
+			latency:      time.Millisecond * 200,
+			lastDecrease: time.Hour,
+			times:        1,
+			expected:     5,
+		},
+		{
+			name:     "不超过 max",
+			initial:  200,
+			latency:  time.Millisecond * 10,
+			times:    1000,
+			expected: 200,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewLimiter(tc.initial, 5, 200, time.Millisecond*100)
+			now := current
+			l.now = func() time.Time { return now }
+			l.lastDecrease = current.Add(-tc.lastDecrease)
+			if tc.concurrent {
+				dones := make([]func(err error), 0, tc.times)
+				for i := 0; i < tc.times; i++ {
+					done, ok := l.Acquire(PriorityHigh)
+					assert.True(t, ok)
+					dones = append(dones, done)
+				}
+				now = now.Add(tc.latency)
+				for _, done := range dones {
+					done(tc.err)
+				}
+			} else {
+				for i := 0; i < tc.times; i++ {
+					done, ok := l.Acquire(PriorityHigh)
+					assert.True(t, ok)
+					now = now.Add(tc.latency)
+					done(tc.err)
+				}
+			}
+			assert.Equal(t, tc.expected, l.Limit())
+		})
+	}
+}
+
+func TestPriorityFrom(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, PriorityNormal, PriorityFrom(ctx, PriorityNormal))
+	assert.Equal(t, PriorityHigh, PriorityFrom(WithPriority(ctx, PriorityHigh), PriorityNormal))
+}
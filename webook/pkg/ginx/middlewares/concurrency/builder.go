@@ -0,0 +1,53 @@
+package concurrency
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"geektime/webook/pkg/concurrency"
+	"geektime/webook/pkg/ginx"
+)
+
+// Builder 自适应并发限制的中间件，超过上限的请求直接返回 503
+type Builder struct {
+	limiter *concurrency.Limiter
+	// 路径 => 优先级，没有配置的是 PriorityNormal
+	priorities map[string]concurrency.Priority
+}
+
+func NewBuilder(limiter *concurrency.Limiter) *Builder {
+	return &Builder{
+		limiter:    limiter,
+		priorities: make(map[string]concurrency.Priority),
+	}
+}
+
+// Priority 设置这些路径的优先级
+func (b *Builder) Priority(p concurrency.Priority, paths ...string) *Builder {
+	for _, path := range paths {
+		b.priorities[path] = p
+	}
+	return b
+}
+
+func (b *Builder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		p, ok := b.priorities[ctx.Request.URL.Path]
+		if !ok {
+			p = concurrency.PriorityNormal
+		}
+		done, ok := b.limiter.Acquire(p)
+		if !ok {
+			ctx.Header("Retry-After", "1")
+			ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, ginx.Result{Code: 5, Msg: "系统繁忙，请稍后再试"})
+			return
+		}
+		// 后面的 service 也按照这个优先级来
+		ctx.Set(concurrency.ContextKey, p)
+		ctx.Request = ctx.Request.WithContext(concurrency.WithPriority(ctx.Request.Context(), p))
+		// handler panic 了也要释放，不然每次 panic 都会永久占掉一个并发数
+		defer func() { done(ctx.Request.Context().Err()) }()
+		ctx.Next()
+	}
+}
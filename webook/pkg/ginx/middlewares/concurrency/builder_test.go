@@ -0,0 +1,107 @@
+package concurrency
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"geektime/webook/pkg/concurrency"
+	"geektime/webook/pkg/ginx"
+)
+
+func TestBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 已经占用的并发数
+		inflight int
+		path     string
+
+		expectedCode     int
+		expectedPriority concurrency.Priority
+		expectedBody     ginx.Result
+	}{
+		{
+			name:             "没有过载",
+			path:             "/users/edit",
+			expectedCode:     http.StatusOK,
+			expectedPriority: concurrency.PriorityLow,
+		},
+		{
+			name:         "低优先级先被丢弃",
+			inflight:     5,
+			path:         "/users/edit",
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: ginx.Result{Code: 5, Msg: "系统繁忙，请稍后再试"},
+		},
+		{
+			name:             "高优先级还能进来",
+			inflight:         5,
+			path:             "/users/login",
+			expectedCode:     http.StatusOK,
+			expectedPriority: concurrency.PriorityHigh,
+		},
+		{
+			name:         "默认是普通优先级",
+			inflight:     8,
+			path:         "/users/signup",
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: ginx.Result{Code: 5, Msg: "系统繁忙，请稍后再试"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			limiter := concurrency.NewLimiter(10, 1, 100, time.Second)
+			for i := 0; i < tc.inflight; i++ {
+				_, ok := limiter.Acquire(concurrency.PriorityHigh)
+				require.True(t, ok)
+			}
+			server := gin.New()
+			server.Use(NewBuilder(limiter).
+				Priority(concurrency.PriorityHigh, "/users/login").
+				Priority(concurrency.PriorityLow, "/users/edit").
+				Build())
+			var priority concurrency.Priority
+			server.Any("/*path", func(ctx *gin.Context) {
+				priority = concurrency.PriorityFrom(ctx.Request.Context(), concurrency.PriorityNormal)
+				ctx.String(http.StatusOK, "OK")
+			})
+
+			req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tc.expectedCode, recorder.Code)
+			if tc.expectedCode != http.StatusOK {
+				assert.Equal(t, "1", recorder.Header().Get("Retry-After"))
+				var res ginx.Result
+				require.NoError(t, json.NewDecoder(recorder.Body).Decode(&res))
+				assert.Equal(t, tc.expectedBody, res)
+				return
+			}
+			assert.Equal(t, tc.expectedPriority, priority)
+		})
+	}
+}
+
+func TestBuilder_Build_Panic(t *testing.T) {
+	limiter := concurrency.NewLimiter(10, 1, 100, time.Second)
+	server := gin.New()
+	server.Use(gin.Recovery(), NewBuilder(limiter).Build())
+	server.GET("/panic", func(ctx *gin.Context) {
+		panic("mock panic")
+	})
+
+	for i := 0; i < 20; i++ {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/panic", nil))
+		// 一直是 500，不会因为并发数被占满变成 503
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	}
+	assert.Equal(t, 0, limiter.Inflight())
+}
@@ -1,26 +1,61 @@
 package ratelimit
 
 import (
-	_ "embed"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"geektime/webook/pkg/ginx"
 	"geektime/webook/pkg/ratelimit"
 )
 
+// Rule 一条限流规则，请求命中的规则都要检查，任何一条触发了就限流
+type Rule struct {
+	// 规则的名字，也是限流 key 的一部分，不同的规则不要重名
+	Name string
+	// 空字符串匹配所有方法
+	Method string
+	// 以 * 结尾的是前缀匹配，例如 /users/*；空字符串匹配所有路径；其它的要完全一样
+	Path string
+	// 限流对象，例如 IP、用户 ID。返回空字符串说明这个请求不适用这条规则
+	Key     KeyFunc
+	Limiter ratelimit.Limiter
+}
+
+func (r Rule) match(ctx *gin.Context) bool {
+	if r.Method != "" && r.Method != ctx.Request.Method {
+		return false
+	}
+	path := ctx.Request.URL.Path
+	if prefix, ok := strings.CutSuffix(r.Path, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return r.Path == "" || r.Path == path
+}
+
 type Builder struct {
-	prefix  string
-	limiter ratelimit.Limiter
+	prefix string
+	// 规则可以在运行时整体替换，见 SetRules
+	rules atomic.Pointer[[]Rule]
 }
 
-func NewBuilder(limiter ratelimit.Limiter) *Builder {
-	return &Builder{
-		prefix:  "ip-limiter",
-		limiter: limiter,
+func NewBuilder(rules ...Rule) *Builder {
+	b := &Builder{
+		prefix: "http-limiter",
 	}
+	b.SetRules(rules...)
+	return b
+}
+
+// SetRules 原子地替换所有规则，正在处理的请求还是用旧的规则
+func (b *Builder) SetRules(rules ...Rule) {
+	b.rules.Store(&rules)
 }
 
 func (b *Builder) Prefix(prefix string) *Builder {
@@ -30,24 +65,73 @@ func (b *Builder) Prefix(prefix string) *Builder {
 
 func (b *Builder) Build() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		limited, err := b.limit(ctx)
+		d, ok, err := b.decide(ctx)
 		if err != nil {
 			log.Println(err)
-			// 这一步很有意思，就是如果这边出错了
-			// 要怎么办？
-			ctx.AbortWithStatus(http.StatusInternalServerError)
+			// 出错了要怎么办由限流器自己决定，用 ratelimit.FailSafeLimiter 装饰一下就不会走到这里。
+			// 走到这里说明没有装饰，只能当作系统错误
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, ginx.Result{Code: 5, Msg: "系统错误"})
 			return
 		}
-		if limited {
-			log.Println(err)
-			ctx.AbortWithStatus(http.StatusTooManyRequests)
+		if !ok {
+			// 没有命中任何规则
+			ctx.Next()
+			return
+		}
+		setHeaders(ctx, d)
+		if !d.Allowed {
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, ginx.Result{
+				Code: 4,
+				Msg:  "请求太频繁，请稍后再试",
+				Data: gin.H{"retry_after": seconds(d.RetryAfter)},
+			})
 			return
 		}
 		ctx.Next()
 	}
 }
 
-func (b *Builder) limit(ctx *gin.Context) (bool, error) {
-	key := fmt.Sprintf("%s:%s", b.prefix, ctx.ClientIP())
-	return b.limiter.Limit(ctx, key)
+// decide 依次检查命中的规则，返回触发限流的那一条的结果；
+// 都没有触发的时候，返回剩余次数最少的那一条，客户端按照最紧的配额来控制速度
+func (b *Builder) decide(ctx *gin.Context) (ratelimit.Decision, bool, error) {
+	var (
+		res ratelimit.Decision
+		ok  bool
+	)
+	for _, rule := range *b.rules.Load() {
+		if !rule.match(ctx) {
+			continue
+		}
+		k := rule.Key(ctx)
+		if k == "" {
+			continue
+		}
+		key := fmt.Sprintf("%s:%s:%s", b.prefix, rule.Name, k)
+		d, err := rule.Limiter.Allow(ctx, key)
+		if err != nil || !d.Allowed {
+			return d, true, err
+		}
+		// 降级放行的结果没有配额可言
+		if d.Limit > 0 && (!ok || d.Remaining < res.Remaining) {
+			res, ok = d, true
+		}
+	}
+	return res, ok, nil
+}
+
+// setHeaders RateLimit-* 参考 IETF 的 RateLimit header fields 草案，时间都是秒
+func setHeaders(ctx *gin.Context, d ratelimit.Decision) {
+	if d.Limit > 0 {
+		ctx.Header("RateLimit-Limit", strconv.Itoa(d.Limit))
+		ctx.Header("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+		ctx.Header("RateLimit-Reset", strconv.Itoa(seconds(d.Reset)))
+	}
+	if !d.Allowed {
+		ctx.Header("Retry-After", strconv.Itoa(seconds(d.RetryAfter)))
+	}
+}
+
+// seconds 向上取整，不足一秒按一秒算，客户端不会太早重试
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
 }
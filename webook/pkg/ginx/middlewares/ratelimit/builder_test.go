@@ -0,0 +1,226 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"geektime/webook/pkg/ginx"
+	"geektime/webook/pkg/ratelimit"
+	limitmocks "geektime/webook/pkg/ratelimit/mocks"
+)
+
+func TestBuilder_Build(t *testing.T) {
+	limited := ratelimit.Decision{Limit: 10, Reset: time.Millisecond * 2500, RetryAfter: time.Millisecond * 300}
+	limitedHeader := http.Header{
+		"Ratelimit-Limit":     {"10"},
+		"Ratelimit-Remaining": {"0"},
+		"Ratelimit-Reset":     {"3"},
+		"Retry-After":         {"1"},
+	}
+	limitedBody := ginx.Result{Code: 4, Msg: "请求太频繁，请稍后再试", Data: map[string]any{"retry_after": float64(1)}}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (login, users, apiKey ratelimit.Limiter)
+
+		method string
+		path   string
+		header map[string]string
+
+		expectedCode   int
+		expectedHeader http.Header
+		expectedBody   ginx.Result
+	}{
+		{
+			name: "登录按 IP 限流",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter, ratelimit.Limiter) {
+				login := limitmocks.NewMockLimiter(ctrl)
+				login.EXPECT().Allow(gomock.Any(), "http-limiter:login:10.0.0.1").Return(limited, nil)
+				return login, limitmocks.NewMockLimiter(ctrl), limitmocks.NewMockLimiter(ctrl)
+			},
+			method:         http.MethodPost,
+			path:           "/users/login",
+			expectedCode:   http.StatusTooManyRequests,
+			expectedHeader: limitedHeader,
+			expectedBody:   limitedBody,
+		},
+		{
+			name: "方法不匹配",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter, ratelimit.Limiter) {
+				// 没有登录，按用户限流的规则也不适用
+				return limitmocks.NewMockLimiter(ctrl), limitmocks.NewMockLimiter(ctrl), limitmocks.NewMockLimiter(ctrl)
+			},
+			method:       http.MethodGet,
+			path:         "/users/login",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "前缀匹配，按用户限流",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter, ratelimit.Limiter) {
+				users := limitmocks.NewMockLimiter(ctrl)
+				users.EXPECT().Allow(gomock.Any(), "http-limiter:users:123").Return(limited, nil)
+				return limitmocks.NewMockLimiter(ctrl), users, limitmocks.NewMockLimiter(ctrl)
+			},
+			method:         http.MethodGet,
+			path:           "/users/profile",
+			expectedCode:   http.StatusTooManyRequests,
+			expectedHeader: limitedHeader,
+			expectedBody:   limitedBody,
+		},
+		{
+			name: "按 API key 限流",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter, ratelimit.Limiter) {
+				apiKey := limitmocks.NewMockLimiter(ctrl)
+				apiKey.EXPECT().Allow(gomock.Any(), "http-limiter:api:abc").Return(limited, nil)
+				return limitmocks.NewMockLimiter(ctrl), limitmocks.NewMockLimiter(ctrl), apiKey
+			},
+			method:         http.MethodGet,
+			path:           "/open/articles",
+			header:         map[string]string{"X-Api-Key": "abc"},
+			expectedCode:   http.StatusTooManyRequests,
+			expectedHeader: limitedHeader,
+			expectedBody:   limitedBody,
+		},
+		{
+			name: "没有 API key 的请求不适用这条规则",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter, ratelimit.Limiter) {
+				return limitmocks.NewMockLimiter(ctrl), limitmocks.NewMockLimiter(ctrl), limitmocks.NewMockLimiter(ctrl)
+			},
+			method:       http.MethodGet,
+			path:         "/open/articles",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "限流器出错",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter, ratelimit.Limiter) {
+				login := limitmocks.NewMockLimiter(ctrl)
+				login.EXPECT().Allow(gomock.Any(), gomock.Any()).Return(ratelimit.Decision{}, errors.New("mock redis err"))
+				return login, limitmocks.NewMockLimiter(ctrl), limitmocks.NewMockLimiter(ctrl)
+			},
+			method:       http.MethodPost,
+			path:         "/users/login",
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: ginx.Result{Code: 5, Msg: "系统错误"},
+		},
+		{
+			name: "降级放行，不返回配额",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter, ratelimit.Limiter) {
+				users := limitmocks.NewMockLimiter(ctrl)
+				users.EXPECT().Allow(gomock.Any(), "http-limiter:users:123").
+					Return(ratelimit.Decision{Allowed: true, Degraded: true}, nil)
+				return limitmocks.NewMockLimiter(ctrl), users, limitmocks.NewMockLimiter(ctrl)
+			},
+			method:       http.MethodGet,
+			path:         "/users/profile",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "都放行，返回剩余次数最少的那一条",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter, ratelimit.Limiter) {
+				users := limitmocks.NewMockLimiter(ctrl)
+				users.EXPECT().Allow(gomock.Any(), "http-limiter:users:123").
+					Return(ratelimit.Decision{Allowed: true, Limit: 100, Remaining: 50, Reset: time.Second}, nil)
+				apiKey := limitmocks.NewMockLimiter(ctrl)
+				apiKey.EXPECT().Allow(gomock.Any(), "http-limiter:api:abc").
+					Return(ratelimit.Decision{Allowed: true, Limit: 10, Remaining: 2, Reset: time.Second * 60}, nil)
+				return limitmocks.NewMockLimiter(ctrl), users, apiKey
+			},
+			method:       http.MethodGet,
+			path:         "/users/profile",
+			header:       map[string]string{"X-Api-Key": "abc"},
+			expectedCode: http.StatusOK,
+			expectedHeader: http.Header{
+				"Ratelimit-Limit":     {"10"},
+				"Ratelimit-Remaining": {"2"},
+				"Ratelimit-Reset":     {"60"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			login, users, apiKey := tc.mock(ctrl)
+
+			server := gin.New()
+			// 模拟登录校验的中间件
+			server.Use(func(ctx *gin.Context) {
+				if ctx.Request.URL.Path != "/users/login" {
+					ctx.Set("uid", int64(123))
+				}
+			})
+			server.Use(NewBuilder(
+				Rule{Name: "login", Method: http.MethodPost, Path: "/users/login", Key: IP(), Limiter: login},
+				Rule{Name: "users", Path: "/users/*", Key: ContextValue("uid", nil), Limiter: users},
+				Rule{Name: "api", Key: Header("X-Api-Key"), Limiter: apiKey},
+			).Build())
+			server.Any("/*path", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			req, err := http.NewRequest(tc.method, tc.path, nil)
+			assert.NoError(t, err)
+			req.RemoteAddr = "10.0.0.1:1234"
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, tc.expectedCode, resp.Code)
+			for k := range resp.Header() {
+				if !strings.HasPrefix(k, "Ratelimit-") && k != "Retry-After" {
+					resp.Header().Del(k)
+				}
+			}
+			if tc.expectedHeader == nil {
+				tc.expectedHeader = http.Header{}
+			}
+			assert.Equal(t, tc.expectedHeader, resp.Header())
+			if resp.Code == http.StatusOK {
+				return
+			}
+			var body ginx.Result
+			assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+			assert.Equal(t, tc.expectedBody, body)
+		})
+	}
+}
+
+func TestBuilder_SetRules(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	loose := limitmocks.NewMockLimiter(ctrl)
+	loose.EXPECT().Allow(gomock.Any(), "http-limiter:login:10.0.0.1").
+		Return(ratelimit.Decision{Allowed: true, Limit: 10, Remaining: 9}, nil)
+	strict := limitmocks.NewMockLimiter(ctrl)
+	strict.EXPECT().Allow(gomock.Any(), "http-limiter:login:10.0.0.1").
+		Return(ratelimit.Decision{Limit: 1, RetryAfter: time.Minute}, nil)
+
+	builder := NewBuilder(Rule{Name: "login", Path: "/users/login", Key: IP(), Limiter: loose})
+	server := gin.New()
+	server.Use(builder.Build())
+	server.POST("/users/login", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	send := func() int {
+		req, err := http.NewRequest(http.MethodPost, "/users/login", nil)
+		require.NoError(t, err)
+		req.RemoteAddr = "10.0.0.1:1234"
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, req)
+		return resp.Code
+	}
+	assert.Equal(t, http.StatusOK, send())
+	// 运行中收紧限流，不用重新注册中间件
+	builder.SetRules(Rule{Name: "login", Path: "/users/login", Key: IP(), Limiter: strict})
+	assert.Equal(t, http.StatusTooManyRequests, send())
+}
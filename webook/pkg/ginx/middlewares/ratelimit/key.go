@@ -0,0 +1,39 @@
+package ratelimit
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyFunc 从请求里面取出限流对象
+type KeyFunc func(ctx *gin.Context) string
+
+// IP 按照客户端 IP 限流
+func IP() KeyFunc {
+	return func(ctx *gin.Context) string {
+		return ctx.ClientIP()
+	}
+}
+
+// Header 按照某个请求头限流，例如 API key
+func Header(name string) KeyFunc {
+	return func(ctx *gin.Context) string {
+		return ctx.GetHeader(name)
+	}
+}
+
+// ContextValue 按照前面的中间件放进 ctx 里面的值限流，例如登录态里面的用户 ID。
+// value 从 ctx.Get(key) 的结果里面取出限流对象，没有的时候返回空字符串
+func ContextValue(key string, value func(val any) string) KeyFunc {
+	return func(ctx *gin.Context) string {
+		val, ok := ctx.Get(key)
+		if !ok {
+			return ""
+		}
+		if value == nil {
+			return fmt.Sprint(val)
+		}
+		return value(val)
+	}
+}
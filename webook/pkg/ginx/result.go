@@ -0,0 +1,8 @@
+package ginx
+
+type Result struct {
+	// 业务错误码
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data any    `json:"data"`
+}
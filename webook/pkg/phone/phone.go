@@ -0,0 +1,142 @@
+// Package phone 解析、校验手机号码，并统一成 E.164 格式，例如 +8615212345678
+package phone
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidNumber = errors.New("手机号码格式错误")
+
+// DefaultRegion 没有带国家码的号码按这个地区解析
+var DefaultRegion = "CN"
+
+// Region 一个地区的手机号码规则
+type Region struct {
+	// ISO 3166 的地区代码，例如 CN
+	Code string
+	// 国家码，例如 86
+	CountryCode string
+	// 国内号码的校验规则，不含国家码和国内拨号前缀
+	Pattern *regexp.Regexp
+	// 国内拨号前缀，例如英国的 0，解析的时候去掉
+	TrunkPrefix string
+}
+
+var regions = map[string]Region{}
+
+// 国家码 => 地区，国家码最长 3 位
+var countryCodes = map[string]Region{}
+
+func init() {
+	Register(Region{Code: "CN", CountryCode: "86", Pattern: regexp.MustCompile(`^1[3-9]\d{9}$`)})
+	Register(Region{Code: "HK", CountryCode: "852", Pattern: regexp.MustCompile(`^[4-9]\d{7}$`)})
+	Register(Region{Code: "US", CountryCode: "1", Pattern: regexp.MustCompile(`^[2-9]\d{2}[2-9]\d{6}$`)})
+	Register(Region{Code: "GB", CountryCode: "44", Pattern: regexp.MustCompile(`^7\d{9}$`), TrunkPrefix: "0"})
+}
+
+// Register 注册地区规则，只能在初始化的时候调用
+func Register(r Region) {
+	regions[r.Code] = r
+	countryCodes[r.CountryCode] = r
+}
+
+// Number 解析之后的手机号码
+type Number struct {
+	Region      string
+	CountryCode string
+	// 国内号码
+	National string
+}
+
+// E164 例如 +8615212345678
+func (n Number) E164() string {
+	return "+" + n.CountryCode + n.National
+}
+
+// Normalize 按 DefaultRegion 解析，返回 E.164 格式
+func Normalize(raw string) (string, error) {
+	n, err := Parse(raw, DefaultRegion)
+	if err != nil {
+		return "", err
+	}
+	return n.E164(), nil
+}
+
+// Parse 支持 +86 152 1234 5678、0086-152-1234-5678、(152) 12345678 这种写法，
+// 没有国家码的号码按 defaultRegion 解析
+func Parse(raw string, defaultRegion string) (Number, error) {
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '(', ')', '.':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(raw))
+	switch {
+	case strings.HasPrefix(digits, "+"):
+		return parseInternational(digits[1:])
+	case strings.HasPrefix(digits, "00"):
+		return parseInternational(digits[2:])
+	}
+	if !isDigits(digits) {
+		return Number{}, ErrInvalidNumber
+	}
+	region, ok := regions[defaultRegion]
+	if !ok {
+		return Number{}, ErrInvalidNumber
+	}
+	if n, ok := parseNational(region, digits); ok {
+		return n, nil
+	}
+	// 带了国家码但是没有 +，例如 8615212345678
+	if strings.HasPrefix(digits, region.CountryCode) {
+		if n, ok := parseNational(region, digits[len(region.CountryCode):]); ok {
+			return n, nil
+		}
+	}
+	return Number{}, ErrInvalidNumber
+}
+
+func parseInternational(digits string) (Number, error) {
+	if !isDigits(digits) {
+		return Number{}, ErrInvalidNumber
+	}
+	for i := 1; i <= 3 && i < len(digits); i++ {
+		region, ok := countryCodes[digits[:i]]
+		if !ok {
+			continue
+		}
+		if n, ok := parseNational(region, digits[i:]); ok {
+			return n, nil
+		}
+	}
+	return Number{}, ErrInvalidNumber
+}
+
+func parseNational(region Region, national string) (Number, bool) {
+	if region.TrunkPrefix != "" {
+		national = strings.TrimPrefix(national, region.TrunkPrefix)
+	}
+	if !region.Pattern.MatchString(national) {
+		return Number{}, false
+	}
+	return Number{
+		Region:      region.Code,
+		CountryCode: region.CountryCode,
+		National:    national,
+	}, true
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package phone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name   string
+		raw    string
+		region string
+
+		expectedE164 string
+		expectedErr  error
+	}{
+		{name: "国内号码", raw: "15212345678", region: "CN", expectedE164: "+8615212345678"},
+		{name: "带空格", raw: "152 1234 5678", region: "CN", expectedE164: "+8615212345678"},
+		{name: "带横杠", raw: "152-1234-5678", region: "CN", expectedE164: "+8615212345678"},
+		{name: "带 +86", raw: "+86 152 1234 5678", region: "CN", expectedE164: "+8615212345678"},
+		{name: "带 0086", raw: "0086-15212345678", region: "CN", expectedE164: "+8615212345678"},
+		{name: "带 86 没有 +", raw: "8615212345678", region: "CN", expectedE164: "+8615212345678"},
+		{name: "国际号码不受默认地区影响", raw: "+852 5123 4567", region: "CN", expectedE164: "+85251234567"},
+		{name: "美国号码", raw: "(415) 555-2671", region: "US", expectedE164: "+14155552671"},
+		{name: "英国号码去掉国内拨号前缀", raw: "07911 123456", region: "GB", expectedE164: "+447911123456"},
+		{name: "英国国际号码", raw: "+44 7911 123456", region: "CN", expectedE164: "+447911123456"},
+		{name: "空号码", raw: "", region: "CN", expectedErr: ErrInvalidNumber},
+		{name: "位数不对", raw: "1521234567", region: "CN", expectedErr: ErrInvalidNumber},
+		{name: "号段不对", raw: "12212345678", region: "CN", expectedErr: ErrInvalidNumber},
+		{name: "有字母", raw: "152xxxx5678", region: "CN", expectedErr: ErrInvalidNumber},
+		{name: "未知国家码", raw: "+999 12345678", region: "CN", expectedErr: ErrInvalidNumber},
+		{name: "未知地区", raw: "15212345678", region: "XX", expectedErr: ErrInvalidNumber},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := Parse(tc.raw, tc.region)
+			assert.Equal(t, tc.expectedErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.expectedE164, n.E164())
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for _, raw := range []string{"15212345678", "152 1234 5678", "+8615212345678", "+86 152-1234-5678"} {
+		n, err := Normalize(raw)
+		assert.NoError(t, err)
+		assert.Equal(t, "+8615212345678", n)
+	}
+}
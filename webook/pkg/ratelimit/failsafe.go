@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// FailurePolicy 限流器本身出错的时候怎么办
+type FailurePolicy uint8
+
+const (
+	// FailOpen 放行，下游很强、可用性要求很高的时候用
+	FailOpen FailurePolicy = iota
+	// FailClosed 限流，保守策略，下游很坑或者放过去代价很高的时候用
+	FailClosed
+	// FailLocal 降级为本地限流，每个实例按照自己的配额来
+	FailLocal
+)
+
+func (p FailurePolicy) String() string {
+	switch p {
+	case FailOpen:
+		return "open"
+	case FailClosed:
+		return "closed"
+	case FailLocal:
+		return "local"
+	default:
+		return "unknown"
+	}
+}
+
+// degradedDecisions 降级模式下做出的判断次数，key 是 限流器名字:策略，
+// 通过 expvar 暴露，webook 挂在管理端口的 /debug/vars 上，见 ioc.InitAdminServer
+var degradedDecisions = expvar.NewMap("ratelimit_degraded_decisions")
+
+// FailSafeLimiter 装饰一个限流器（一般是 Redis 上的），出错的时候按照 policy 处理，不把错误往上抛。
+// 连续出错 threshold 次之后认为它不健康了，cooldown 时间内直接按照 policy 处理，不再访问它；
+// cooldown 之后再试一次，成功了就恢复
+type FailSafeLimiter struct {
+	name     string
+	limiter  Limiter
+	policy   FailurePolicy
+	fallback Limiter
+
+	threshold int32
+	cooldown  time.Duration
+	// 连续出错的次数
+	failures atomic.Int32
+	// 不健康到什么时候，UnixNano
+	unhealthyUntil atomic.Int64
+	now            func() time.Time
+}
+
+// NewFailSafeLimiter name 用来区分指标；policy 是 FailLocal 的时候 fallback 不能是 nil
+func NewFailSafeLimiter(name string, limiter Limiter, policy FailurePolicy, fallback Limiter) *FailSafeLimiter {
+	return &FailSafeLimiter{
+		name:      name,
+		limiter:   limiter,
+		policy:    policy,
+		fallback:  fallback,
+		threshold: 3,
+		cooldown:  time.Second * 10,
+		now:       time.Now,
+	}
+}
+
+// Health 连续出错 threshold 次之后，cooldown 时间内不再访问限流器
+func (f *FailSafeLimiter) Health(threshold int, cooldown time.Duration) *FailSafeLimiter {
+	f.threshold = int32(threshold)
+	f.cooldown = cooldown
+	return f
+}
+
+func (f *FailSafeLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limit(ctx, f, key)
+}
+
+func (f *FailSafeLimiter) Allow(ctx context.Context, key string) (Decision, error) {
+	now := f.now()
+	if now.UnixNano() < f.unhealthyUntil.Load() {
+		return f.degrade(ctx, key)
+	}
+	d, err := f.limiter.Allow(ctx, key)
+	if err == nil {
+		f.failures.Store(0)
+		return d, nil
+	}
+	log.Println("限流器异常，按照策略降级", f.name, f.policy, err)
+	if f.failures.Add(1) >= f.threshold {
+		f.failures.Store(0)
+		f.unhealthyUntil.Store(now.Add(f.cooldown).UnixNano())
+	}
+	return f.degrade(ctx, key)
+}
+
+// Refund 降级为本地限流的时候还给本地的限流器，放行和限流两种策略都没有计数
+func (f *FailSafeLimiter) Refund(ctx context.Context, key string, d Decision) error {
+	if !d.Degraded {
+		return Refund(ctx, f.limiter, key, d)
+	}
+	if f.policy == FailLocal {
+		return Refund(ctx, f.fallback, key, d)
+	}
+	return nil
+}
+
+func (f *FailSafeLimiter) degrade(ctx context.Context, key string) (Decision, error) {
+	degradedDecisions.Add(f.name+":"+f.policy.String(), 1)
+	switch f.policy {
+	case FailClosed:
+		// 等限流器恢复了再来
+		return Decision{Degraded: true, RetryAfter: f.retryAfter()}, nil
+	case FailLocal:
+		d, err := f.fallback.Allow(ctx, key)
+		d.Degraded = true
+		return d, err
+	default:
+		return Decision{Allowed: true, Degraded: true}, nil
+	}
+}
+
+func (f *FailSafeLimiter) retryAfter() time.Duration {
+	if d := time.Duration(f.unhealthyUntil.Load() - f.now().UnixNano()); d > 0 {
+		return d
+	}
+	return time.Second
+}
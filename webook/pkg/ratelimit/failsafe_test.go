@@ -0,0 +1,198 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailSafeLimiter_Allow(t *testing.T) {
+	allowed := Decision{Allowed: true, Limit: 10, Remaining: 5, Reset: time.Second}
+	local := Decision{Allowed: true, Limit: 10, Remaining: 9, Reset: time.Second}
+	testCases := []struct {
+		name     string
+		limiter  *stubLimiter
+		policy   FailurePolicy
+		fallback *stubLimiter
+		// 已经连续出错几次了
+		failures int32
+		// 不健康到什么时候，相对现在
+		unhealthy time.Duration
+
+		expected              Decision
+		expectedLimiterCalls  int
+		expectedFallbackCalls int
+		expectedUnhealthy     bool
+		expectedDegraded      bool
+	}{
+		{
+			name:                 "限流器正常",
+			limiter:              &stubLimiter{decision: allowed},
+			policy:               FailClosed,
+			fallback:             &stubLimiter{},
+			expected:             allowed,
+			expectedLimiterCalls: 1,
+		},
+		{
+			name:                 "出错，放行",
+			limiter:              &stubLimiter{err: errors.New("mock redis err")},
+			policy:               FailOpen,
+			fallback:             &stubLimiter{},
+			expected:             Decision{Allowed: true, Degraded: true},
+			expectedLimiterCalls: 1,
+			expectedDegraded:     true,
+		},
+		{
+			name:                 "出错，限流",
+			limiter:              &stubLimiter{err: errors.New("mock redis err")},
+			policy:               FailClosed,
+			fallback:             &stubLimiter{},
+			expected:             Decision{Degraded: true, RetryAfter: time.Second},
+			expectedLimiterCalls: 1,
+			expectedDegraded:     true,
+		},
+		{
+			name:                  "出错，降级为本地限流",
+			limiter:               &stubLimiter{err: errors.New("mock redis err")},
+			policy:                FailLocal,
+			fallback:              &stubLimiter{decision: local},
+			expected:              Decision{Allowed: true, Limit: 10, Remaining: 9, Reset: time.Second, Degraded: true},
+			expectedLimiterCalls:  1,
+			expectedFallbackCalls: 1,
+			expectedDegraded:      true,
+		},
+		{
+			name:                 "连续出错，标记为不健康",
+			limiter:              &stubLimiter{err: errors.New("mock redis err")},
+			policy:               FailClosed,
+			fallback:             &stubLimiter{},
+			failures:             2,
+			expected:             Decision{Degraded: true, RetryAfter: time.Second * 10},
+			expectedLimiterCalls: 1,
+			expectedUnhealthy:    true,
+			expectedDegraded:     true,
+		},
+		{
+			name:                  "不健康的时候不访问限流器",
+			limiter:               &stubLimiter{decision: allowed},
+			policy:                FailLocal,
+			fallback:              &stubLimiter{decision: local},
+			unhealthy:             time.Second * 5,
+			expected:              Decision{Allowed: true, Limit: 10, Remaining: 9, Reset: time.Second, Degraded: true},
+			expectedFallbackCalls: 1,
+			expectedUnhealthy:     true,
+			expectedDegraded:      true,
+		},
+		{
+			name:                 "冷却结束，恢复",
+			limiter:              &stubLimiter{decision: allowed},
+			policy:               FailLocal,
+			fallback:             &stubLimiter{decision: local},
+			failures:             2,
+			unhealthy:            -time.Second,
+			expected:             allowed,
+			expectedLimiterCalls: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Date(2023, 10, 17, 8, 0, 0, 0, time.Local)
+			name := "test:" + tc.name
+			f := NewFailSafeLimiter(name, tc.limiter, tc.policy, tc.fallback).Health(3, time.Second*10)
+			f.now = func() time.Time { return now }
+			f.failures.Store(tc.failures)
+			if tc.unhealthy != 0 {
+				f.unhealthyUntil.Store(now.Add(tc.unhealthy).UnixNano())
+			}
+			d, err := f.Allow(context.Background(), "key")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, d)
+			assert.Equal(t, tc.expectedLimiterCalls, tc.limiter.calls)
+			assert.Equal(t, tc.expectedFallbackCalls, tc.fallback.calls)
+			assert.Equal(t, tc.expectedUnhealthy, now.UnixNano() < f.unhealthyUntil.Load())
+
+			metric := degradedDecisions.Get(name + ":" + tc.policy.String())
+			if !tc.expectedDegraded {
+				assert.Nil(t, metric)
+				return
+			}
+			assert.Equal(t, "1", metric.(*expvar.Int).String())
+		})
+	}
+}
+
+func TestFailSafeLimiter_Refund(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy FailurePolicy
+		d      Decision
+
+		expectedLimiterRefunds  int
+		expectedFallbackRefunds int
+	}{
+		{
+			name:                   "没有降级，退回给限流器",
+			policy:                 FailLocal,
+			d:                      Decision{Allowed: true},
+			expectedLimiterRefunds: 1,
+		},
+		{
+			name:                    "降级为本地限流，退回给本地",
+			policy:                  FailLocal,
+			d:                       Decision{Allowed: true, Degraded: true},
+			expectedFallbackRefunds: 1,
+		},
+		{
+			name:   "降级放行，没有计数",
+			policy: FailOpen,
+			d:      Decision{Allowed: true, Degraded: true},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			limiter, fallback := &stubLimiter{}, &stubLimiter{}
+			f := NewFailSafeLimiter("test:refund:"+tc.name, limiter, tc.policy, fallback)
+			err := Refund(context.Background(), f, "key", tc.d)
+			assert.NoError(t, err)
+			assert.Len(t, limiter.refunds, tc.expectedLimiterRefunds)
+			assert.Len(t, fallback.refunds, tc.expectedFallbackRefunds)
+		})
+	}
+}
+
+func TestFailSafeLimiter_Metric(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy FailurePolicy
+	}{
+		{name: "降级放行", policy: FailOpen},
+		{name: "降级限流", policy: FailClosed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name := "test:metric:" + tc.name
+			f := NewFailSafeLimiter(name, &stubLimiter{err: errors.New("mock redis err")}, tc.policy, nil)
+			for i := 0; i < 2; i++ {
+				_, err := f.Allow(context.Background(), "key")
+				require.NoError(t, err)
+			}
+
+			// 和运维看到的一样，从 /debug/vars 上读
+			recorder := httptest.NewRecorder()
+			expvar.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+			var vars struct {
+				Decisions map[string]int64 `json:"ratelimit_degraded_decisions"`
+			}
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&vars))
+			assert.Equal(t, int64(2), vars.Decisions[name+":"+tc.policy.String()])
+		})
+	}
+}
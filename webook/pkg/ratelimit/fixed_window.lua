@@ -0,0 +1,20 @@
+-- 固定窗口计数器，每个窗口一个 key，只占一个计数器的内存
+-- 返回 {是否限流, 剩余次数, 多少毫秒之后完全恢复, 多少毫秒之后可以重试}
+local key = KEYS[1]
+-- 窗口大小，毫秒
+local window = tonumber(ARGV[1])
+-- 阈值
+local threshold = tonumber(ARGV[2])
+
+local cnt = redis.call('INCR', key)
+if cnt == 1 then
+    -- 窗口的第一个请求，窗口结束之后 key 自动删掉
+    redis.call('PEXPIRE', key, window)
+end
+-- 窗口结束的时候恢复
+local ttl = redis.call('PTTL', key)
+if cnt > threshold then
+    -- 执行限流
+    return {1, 0, ttl, ttl}
+end
+return {0, threshold - cnt, ttl, 0}
\ No newline at end of file
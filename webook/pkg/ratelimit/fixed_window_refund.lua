@@ -0,0 +1,6 @@
+-- 退回一次计数，窗口已经过期的 key 不能再建出来
+local key = KEYS[1]
+if redis.call('EXISTS', key) == 1 then
+    return redis.call('DECR', key)
+end
+return 0
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// HybridLimiter 两级限流：先用本地限流器挡掉单机就超了的请求，
+// 剩下的再用 Redis 做集群维度的限流。
+// Redis 出错之后，retry 时间内只用本地限流，不再访问 Redis
+type HybridLimiter struct {
+	local  Limiter
+	remote Limiter
+	retry  time.Duration
+	// 降级到什么时候，UnixNano
+	degradedUntil atomic.Int64
+	now           func() time.Time
+}
+
+func NewHybridLimiter(local, remote Limiter, retry time.Duration) Limiter {
+	return &HybridLimiter{
+		local:  local,
+		remote: remote,
+		retry:  retry,
+		now:    time.Now,
+	}
+}
+
+func (h *HybridLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limit(ctx, h, key)
+}
+
+// Ticket 的前缀，说明只用了本地限流，还是两级都计数了
+const (
+	hybridLocalTicket  = "l"
+	hybridRemotePrefix = "r:"
+)
+
+func (h *HybridLimiter) Allow(ctx context.Context, key string) (Decision, error) {
+	local, err := h.local.Allow(ctx, key)
+	if err != nil || !local.Allowed {
+		return local, err
+	}
+	now := h.now()
+	if now.UnixNano() < h.degradedUntil.Load() {
+		local.Ticket = hybridLocalTicket
+		return local, nil
+	}
+	remote, err := h.remote.Allow(ctx, key)
+	if err != nil {
+		// Redis 出问题了，本地已经放行，就按照本地的结果来
+		log.Println("集群限流异常，降级为本地限流", err)
+		h.degradedUntil.Store(now.Add(h.retry).UnixNano())
+		local.Ticket = hybridLocalTicket
+		return local, nil
+	}
+	if !remote.Allowed {
+		// 集群限流了，本地的令牌还回去
+		if er := Refund(ctx, h.local, key, local); er != nil {
+			log.Println("退回本地限流的令牌失败", er)
+		}
+		return remote, nil
+	}
+	remote.Ticket = hybridRemotePrefix + remote.Ticket
+	// 两级都放行的时候，剩余次数按照更紧的那一级来算
+	if local.Remaining < remote.Remaining {
+		remote.Limit = local.Limit
+		remote.Remaining = local.Remaining
+		remote.Reset = max(remote.Reset, local.Reset)
+	}
+	return remote, nil
+}
+
+// Refund 本地的令牌一定要还，Redis 上计过数的才还 Redis 的
+func (h *HybridLimiter) Refund(ctx context.Context, key string, d Decision) error {
+	local := d
+	local.Ticket = ""
+	if err := Refund(ctx, h.local, key, local); err != nil {
+		return err
+	}
+	remoteTicket, ok := strings.CutPrefix(d.Ticket, hybridRemotePrefix)
+	if !ok {
+		return nil
+	}
+	remote := d
+	remote.Ticket = remoteTicket
+	return Refund(ctx, h.remote, key, remote)
+}
@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubLimiter mocks 包依赖了这个包，这里不能用 mocks
+type stubLimiter struct {
+	decision Decision
+	err      error
+	calls    int
+	// 退回的时候拿到的 Decision
+	refunds []Decision
+}
+
+func (s *stubLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limit(ctx, s, key)
+}
+
+func (s *stubLimiter) Allow(ctx context.Context, key string) (Decision, error) {
+	s.calls++
+	return s.decision, s.err
+}
+
+func (s *stubLimiter) Refund(ctx context.Context, key string, d Decision) error {
+	s.refunds = append(s.refunds, d)
+	return nil
+}
+
+func TestHybridLimiter_Allow(t *testing.T) {
+	allowed := func(limit, remaining int) Decision {
+		return Decision{Allowed: true, Limit: limit, Remaining: remaining, Reset: time.Second}
+	}
+	limited := Decision{Limit: 10, Reset: time.Second, RetryAfter: time.Millisecond * 100}
+	testCases := []struct {
+		name   string
+		local  *stubLimiter
+		remote *stubLimiter
+		// 降级到什么时候，相对现在
+		degraded time.Duration
+
+		expected            Decision
+		expectedErr         error
+		expectedRemoteCalls int
+		expectedDegraded    bool
+		// 集群限流的时候本地的令牌要还回去
+		expectedLocalRefunds int
+	}{
+		{
+			name:     "本地限流，不访问 Redis",
+			local:    &stubLimiter{decision: limited},
+			remote:   &stubLimiter{},
+			expected: limited,
+		},
+		{
+			name:                 "集群限流，退回本地的令牌",
+			local:                &stubLimiter{decision: allowed(100, 50)},
+			remote:               &stubLimiter{decision: limited},
+			expected:             limited,
+			expectedRemoteCalls:  1,
+			expectedLocalRefunds: 1,
+		},
+		{
+			name:                "都不限流，剩余次数按照更紧的那一级",
+			local:               &stubLimiter{decision: allowed(100, 3)},
+			remote:              &stubLimiter{decision: Decision{Allowed: true, Limit: 1000, Remaining: 500, Reset: time.Second, Ticket: "m"}},
+			expected:            Decision{Allowed: true, Limit: 100, Remaining: 3, Reset: time.Second, Ticket: "r:m"},
+			expectedRemoteCalls: 1,
+		},
+		{
+			name:                "Redis 出错，降级为本地限流",
+			local:               &stubLimiter{decision: allowed(100, 50)},
+			remote:              &stubLimiter{err: errors.New("mock redis err")},
+			expected:            Decision{Allowed: true, Limit: 100, Remaining: 50, Reset: time.Second, Ticket: "l"},
+			expectedRemoteCalls: 1,
+			expectedDegraded:    true,
+		},
+		{
+			name:             "降级期间不访问 Redis",
+			local:            &stubLimiter{decision: allowed(100, 50)},
+			remote:           &stubLimiter{},
+			degraded:         time.Second,
+			expected:         Decision{Allowed: true, Limit: 100, Remaining: 50, Reset: time.Second, Ticket: "l"},
+			expectedDegraded: true,
+		},
+		{
+			name:                 "降级结束，重新访问 Redis",
+			local:                &stubLimiter{decision: allowed(100, 50)},
+			remote:               &stubLimiter{decision: limited},
+			degraded:             -time.Second,
+			expected:             limited,
+			expectedRemoteCalls:  1,
+			expectedLocalRefunds: 1,
+		},
+		{
+			name:        "本地限流器出错",
+			local:       &stubLimiter{err: errors.New("mock local err")},
+			remote:      &stubLimiter{},
+			expectedErr: errors.New("mock local err"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Date(2023, 10, 17, 8, 0, 0, 0, time.Local)
+			h := NewHybridLimiter(tc.local, tc.remote, time.Second*10).(*HybridLimiter)
+			h.now = func() time.Time { return now }
+			if tc.degraded != 0 {
+				h.degradedUntil.Store(now.Add(tc.degraded).UnixNano())
+			}
+			d, err := h.Allow(context.Background(), "key")
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expected, d)
+			assert.Equal(t, tc.expectedRemoteCalls, tc.remote.calls)
+			assert.Equal(t, tc.expectedDegraded, now.UnixNano() < h.degradedUntil.Load())
+			assert.Len(t, tc.local.refunds, tc.expectedLocalRefunds)
+		})
+	}
+}
+
+func TestHybridLimiter_Refund(t *testing.T) {
+	testCases := []struct {
+		name string
+		d    Decision
+
+		expectedLocal  []Decision
+		expectedRemote []Decision
+	}{
+		{
+			name:           "两级都计数了，都要退回",
+			d:              Decision{Allowed: true, Ticket: "r:m"},
+			expectedLocal:  []Decision{{Allowed: true}},
+			expectedRemote: []Decision{{Allowed: true, Ticket: "m"}},
+		},
+		{
+			name:          "只有本地计数了",
+			d:             Decision{Allowed: true, Ticket: "l"},
+			expectedLocal: []Decision{{Allowed: true}},
+		},
+		{
+			name: "没有放行，不用退回",
+			d:    Decision{Ticket: "r:m"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			local, remote := &stubLimiter{}, &stubLimiter{}
+			h := NewHybridLimiter(local, remote, time.Second*10)
+			err := Refund(context.Background(), h, "key", tc.d)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedLocal, local.refunds)
+			assert.Equal(t, tc.expectedRemote, remote.refunds)
+		})
+	}
+}
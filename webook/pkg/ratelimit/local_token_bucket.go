@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+const localShards = 64
+
+// LocalTokenBucketLimiter 进程内的令牌桶，不需要访问 Redis。
+// key 按照哈希分到不同的分片上，每个分片一把锁，减少锁竞争
+type LocalTokenBucketLimiter struct {
+	shards [localShards]*localShard
+	// 每毫秒补充多少个令牌
+	perMilli float64
+	// 桶的容量
+	burst float64
+	// 一个桶这么久没有用过就删掉。这个时候桶已经补满了，删掉和留着没有区别
+	idle time.Duration
+	now  func() time.Time
+}
+
+type localShard struct {
+	mutex   sync.Mutex
+	buckets map[string]*localBucket
+	// 上一次清理空闲桶的时间
+	swept time.Time
+}
+
+type localBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLocalTokenBucketLimiter interval 内补充 rate 个令牌，最多允许 burst 个突发请求
+func NewLocalTokenBucketLimiter(interval time.Duration, rate int, burst int) Limiter {
+	return newLocalTokenBucketLimiter(interval, rate, burst)
+}
+
+func newLocalTokenBucketLimiter(interval time.Duration, rate int, burst int) *LocalTokenBucketLimiter {
+	perMilli := float64(rate) / float64(interval.Milliseconds())
+	l := &LocalTokenBucketLimiter{
+		perMilli: perMilli,
+		burst:    float64(burst),
+		idle:     time.Duration(float64(burst)/perMilli) * time.Millisecond,
+		now:      time.Now,
+	}
+	for i := range l.shards {
+		l.shards[i] = &localShard{buckets: make(map[string]*localBucket)}
+	}
+	return l
+}
+
+func (l *LocalTokenBucketLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limit(ctx, l, key)
+}
+
+func (l *LocalTokenBucketLimiter) Allow(ctx context.Context, key string) (Decision, error) {
+	now := l.now()
+	shard := l.shard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	shard.sweep(now, l.idle)
+
+	b, ok := shard.buckets[key]
+	if !ok {
+		// 新的桶是满的
+		b = &localBucket{tokens: l.burst, last: now}
+		shard.buckets[key] = b
+	}
+	// 补充上次到现在的令牌
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(l.burst, b.tokens+float64(elapsed)/float64(time.Millisecond)*l.perMilli)
+		b.last = now
+	}
+	d := Decision{Limit: int(l.burst)}
+	if b.tokens < 1 {
+		// 攒够一个令牌之后可以重试
+		d.RetryAfter = l.refill(1 - b.tokens)
+	} else {
+		b.tokens--
+		d.Allowed = true
+		d.Remaining = int(b.tokens)
+	}
+	d.Reset = l.refill(l.burst - b.tokens)
+	return d, nil
+}
+
+// Refund 还回去一个令牌，不超过桶的容量
+func (l *LocalTokenBucketLimiter) Refund(ctx context.Context, key string, d Decision) error {
+	shard := l.shard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	if b, ok := shard.buckets[key]; ok {
+		b.tokens = min(l.burst, b.tokens+1)
+	}
+	return nil
+}
+
+// refill 补充 tokens 个令牌要多久
+func (l *LocalTokenBucketLimiter) refill(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / l.perMilli * float64(time.Millisecond)))
+}
+
+func (l *LocalTokenBucketLimiter) shard(key string) *localShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return l.shards[h.Sum32()%localShards]
+}
+
+// sweep 每隔 idle 清理一次空闲的桶，限流的 key 很多的时候内存不会一直涨
+func (s *localShard) sweep(now time.Time, idle time.Duration) {
+	if now.Sub(s.swept) < idle {
+		return
+	}
+	s.swept = now
+	for key, b := range s.buckets {
+		if now.Sub(b.last) >= idle {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalTokenBucketLimiter_Limit(t *testing.T) {
+	now := time.Date(2023, 10, 17, 8, 0, 0, 0, time.Local)
+	testCases := []struct {
+		name string
+		// 每次请求之前时间往前走多少
+		steps    []time.Duration
+		expected []bool
+	}{
+		{
+			name:     "突发请求不超过容量",
+			steps:    []time.Duration{0, 0, 0},
+			expected: []bool{false, false, false},
+		},
+		{
+			name:     "超过容量就限流",
+			steps:    []time.Duration{0, 0, 0, 0},
+			expected: []bool{false, false, false, true},
+		},
+		{
+			name: "按速率补充令牌",
+			// 1s 补充 10 个，100ms 补充一个
+			steps:    []time.Duration{0, 0, 0, 0, time.Millisecond * 100, 0},
+			expected: []bool{false, false, false, true, false, true},
+		},
+		{
+			name:     "补充的令牌不超过容量",
+			steps:    []time.Duration{0, 0, 0, time.Hour, 0, 0, 0, 0},
+			expected: []bool{false, false, false, false, false, false, true, true},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newLocalTokenBucketLimiter(time.Second, 10, 3)
+			current := now
+			l.now = func() time.Time { return current }
+			for i, step := range tc.steps {
+				current = current.Add(step)
+				limited, err := l.Limit(context.Background(), "key")
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected[i], limited, "第 %d 个请求", i)
+			}
+		})
+	}
+}
+
+func TestLocalTokenBucketLimiter_Evict(t *testing.T) {
+	current := time.Date(2023, 10, 17, 8, 0, 0, 0, time.Local)
+	l := newLocalTokenBucketLimiter(time.Second, 10, 3)
+	l.now = func() time.Time { return current }
+	for i := 0; i < 1000; i++ {
+		_, _ = l.Limit(context.Background(), "key-"+strconv.Itoa(i))
+	}
+	assert.Equal(t, 1000, l.size())
+
+	// 3 个令牌 300ms 就补满了，之后这些桶都会被清理掉
+	current = current.Add(time.Millisecond * 300)
+	for i := 0; i < localShards*4; i++ {
+		_, _ = l.Limit(context.Background(), "new-"+strconv.Itoa(i))
+	}
+	assert.Equal(t, localShards*4, l.size())
+}
+
+func TestLocalTokenBucketLimiter_Concurrent(t *testing.T) {
+	// 时间不动，同一个 key 只能放过 burst 个请求
+	current := time.Date(2023, 10, 17, 8, 0, 0, 0, time.Local)
+	l := newLocalTokenBucketLimiter(time.Second, 10, 100)
+	l.now = func() time.Time { return current }
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				limited, err := l.Limit(context.Background(), "key")
+				assert.NoError(t, err)
+				if !limited {
+					allowed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(100), allowed.Load())
+}
+
+func (l *LocalTokenBucketLimiter) size() int {
+	cnt := 0
+	for _, s := range l.shards {
+		s.mutex.Lock()
+		cnt += len(s.buckets)
+		s.mutex.Unlock()
+	}
+	return cnt
+}
+
+func TestLocalTokenBucketLimiter_Allow(t *testing.T) {
+	current := time.Date(2023, 10, 17, 8, 0, 0, 0, time.Local)
+	// 1s 补充 10 个，100ms 补充一个
+	l := newLocalTokenBucketLimiter(time.Second, 10, 3)
+	l.now = func() time.Time { return current }
+	expected := []Decision{
+		{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Millisecond * 100},
+		{Allowed: true, Limit: 3, Remaining: 1, Reset: time.Millisecond * 200},
+		{Allowed: true, Limit: 3, Remaining: 0, Reset: time.Millisecond * 300},
+		{Limit: 3, Reset: time.Millisecond * 300, RetryAfter: time.Millisecond * 100},
+	}
+	for i, e := range expected {
+		d, err := l.Allow(context.Background(), "key")
+		assert.NoError(t, err)
+		assert.Equal(t, e, d, "第 %d 个请求", i)
+	}
+	// 50ms 之后还差半个令牌
+	current = current.Add(time.Millisecond * 50)
+	d, err := l.Allow(context.Background(), "key")
+	assert.NoError(t, err)
+	assert.Equal(t, Decision{Limit: 3, Reset: time.Millisecond * 250, RetryAfter: time.Millisecond * 50}, d)
+}
+
+func TestLocalTokenBucketLimiter_Refund(t *testing.T) {
+	current := time.Date(2023, 10, 17, 8, 0, 0, 0, time.Local)
+	l := newLocalTokenBucketLimiter(time.Second, 10, 3)
+	l.now = func() time.Time { return current }
+	var last Decision
+	for i := 0; i < 3; i++ {
+		d, err := l.Allow(context.Background(), "key")
+		assert.NoError(t, err)
+		last = d
+	}
+	// 用完了，退回一个之后可以再放行一个
+	assert.NoError(t, l.Refund(context.Background(), "key", last))
+	d, err := l.Allow(context.Background(), "key")
+	assert.NoError(t, err)
+	assert.True(t, d.Allowed)
+	d, err = l.Allow(context.Background(), "key")
+	assert.NoError(t, err)
+	assert.False(t, d.Allowed)
+
+	// 退回的令牌不超过容量
+	current = current.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, l.Refund(context.Background(), "key", last))
+	}
+	d, err = l.Allow(context.Background(), "key")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, d.Remaining)
+}
@@ -10,6 +10,7 @@ package limitmocks
 
 import (
 	context "context"
+	ratelimit "geektime/webook/pkg/ratelimit"
 	reflect "reflect"
 
 	gomock "go.uber.org/mock/gomock"
@@ -38,6 +39,21 @@ func (m *MockLimiter) EXPECT() *MockLimiterMockRecorder {
 	return m.recorder
 }
 
+// Allow mocks base method.
+func (m *MockLimiter) Allow(ctx context.Context, key string) (ratelimit.Decision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Allow", ctx, key)
+	ret0, _ := ret[0].(ratelimit.Decision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Allow indicates an expected call of Allow.
+func (mr *MockLimiterMockRecorder) Allow(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Allow", reflect.TypeOf((*MockLimiter)(nil).Allow), ctx, key)
+}
+
 // Limit mocks base method.
 func (m *MockLimiter) Limit(ctx context.Context, key string) (bool, error) {
 	m.ctrl.T.Helper()
@@ -52,3 +68,40 @@ func (mr *MockLimiterMockRecorder) Limit(ctx, key any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Limit", reflect.TypeOf((*MockLimiter)(nil).Limit), ctx, key)
 }
+
+// MockRefunder is a mock of Refunder interface.
+type MockRefunder struct {
+	ctrl     *gomock.Controller
+	recorder *MockRefunderMockRecorder
+}
+
+// MockRefunderMockRecorder is the mock recorder for MockRefunder.
+type MockRefunderMockRecorder struct {
+	mock *MockRefunder
+}
+
+// NewMockRefunder creates a new mock instance.
+func NewMockRefunder(ctrl *gomock.Controller) *MockRefunder {
+	mock := &MockRefunder{ctrl: ctrl}
+	mock.recorder = &MockRefunderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRefunder) EXPECT() *MockRefunderMockRecorder {
+	return m.recorder
+}
+
+// Refund mocks base method.
+func (m *MockRefunder) Refund(ctx context.Context, key string, d ratelimit.Decision) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Refund", ctx, key, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Refund indicates an expected call of Refund.
+func (mr *MockRefunderMockRecorder) Refund(ctx, key, d any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Refund", reflect.TypeOf((*MockRefunder)(nil).Refund), ctx, key, d)
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"geektime/webook/pkg/redisx"
+)
+
+//go:embed fixed_window.lua
+var luaFixedWindow string
+
+var fixedWindowScript = redisx.Register(luaFixedWindow)
+
+//go:embed fixed_window_refund.lua
+var luaFixedWindowRefund string
+
+var fixedWindowRefundScript = redisx.Register(luaFixedWindowRefund)
+
+// RedisFixedWindowLimiter Redis 上的固定窗口计数器限流器实现。
+// 每个窗口只有一个计数器，内存和请求速率无关；
+// 缺点是两个窗口交界的地方最多会放过 2 * rate 个请求
+type RedisFixedWindowLimiter struct {
+	cmd redis.Cmdable
+	// 窗口大小
+	interval time.Duration
+	// 阈值
+	rate int
+}
+
+func NewRedisFixedWindowLimiter(cmd redis.Cmdable, interval time.Duration, rate int) Limiter {
+	return &RedisFixedWindowLimiter{
+		cmd:      cmd,
+		interval: interval,
+		rate:     rate,
+	}
+}
+
+func (r *RedisFixedWindowLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limit(ctx, r, key)
+}
+
+func (r *RedisFixedWindowLimiter) Allow(ctx context.Context, key string) (Decision, error) {
+	// 同一个窗口内的请求落到同一个 key 上
+	window := strconv.FormatInt(time.Now().UnixMilli()/r.interval.Milliseconds(), 10)
+	res, err := fixedWindowScript.Run(ctx, r.cmd, []string{key + ":" + window},
+		r.interval.Milliseconds(), r.rate).Int64Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+	d, err := decision(r.rate, res)
+	if d.Allowed {
+		d.Ticket = window
+	}
+	return d, err
+}
+
+// Refund 放行的那个窗口的计数减一，窗口已经过去了就不用管了
+func (r *RedisFixedWindowLimiter) Refund(ctx context.Context, key string, d Decision) error {
+	if d.Ticket == "" {
+		return nil
+	}
+	return fixedWindowRefundScript.Run(ctx, r.cmd, []string{key + ":" + d.Ticket}).Err()
+}
@@ -2,15 +2,22 @@ package ratelimit
 
 import (
 	"context"
+	"crypto/rand"
 	_ "embed"
+	"encoding/hex"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"geektime/webook/pkg/redisx"
 )
 
 //go:embed slide_window.lua
 var luaSlideWindow string
 
+var slideWindowScript = redisx.Register(luaSlideWindow)
+
 // RedisSlidingWindowLimiter Redis 上的滑动窗口算法限流器实现
 type RedisSlidingWindowLimiter struct {
 	cmd redis.Cmdable
@@ -30,6 +37,35 @@ func NewRedisSlidingWindowLimiter(cmd redis.Cmdable, interval time.Duration, rat
 }
 
 func (r *RedisSlidingWindowLimiter) Limit(ctx context.Context, key string) (bool, error) {
-	return r.cmd.Eval(ctx, luaSlideWindow, []string{key},
-		r.interval.Milliseconds(), r.rate, time.Now().UnixMilli()).Bool()
+	return limit(ctx, r, key)
+}
+
+func (r *RedisSlidingWindowLimiter) Allow(ctx context.Context, key string) (Decision, error) {
+	now := time.Now().UnixMilli()
+	m := member(now)
+	res, err := slideWindowScript.Run(ctx, r.cmd, []string{key},
+		r.interval.Milliseconds(), r.rate, now, m).Int64Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+	d, err := decision(r.rate, res)
+	if d.Allowed {
+		d.Ticket = m
+	}
+	return d, err
+}
+
+// Refund 把放行的时候加进去的 member 删掉
+func (r *RedisSlidingWindowLimiter) Refund(ctx context.Context, key string, d Decision) error {
+	if d.Ticket == "" {
+		return nil
+	}
+	return r.cmd.ZRem(ctx, key, d.Ticket).Err()
+}
+
+// member 时间戳加上随机数，同一毫秒内的请求在 ZSET 里面也是不同的 member
+func member(now int64) string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return strconv.FormatInt(now, 10) + "-" + hex.EncodeToString(b[:])
 }
@@ -0,0 +1,16 @@
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMember(t *testing.T) {
+	// 同一毫秒内的请求也不能合并成一个 member
+	members := make(map[string]struct{}, 1000)
+	for i := 0; i < 1000; i++ {
+		members[member(1697500800000)] = struct{}{}
+	}
+	assert.Len(t, members, 1000)
+}
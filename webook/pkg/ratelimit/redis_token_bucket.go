@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"geektime/webook/pkg/redisx"
+)
+
+//go:embed token_bucket.lua
+var luaTokenBucket string
+
+var tokenBucketScript = redisx.Register(luaTokenBucket)
+
+//go:embed token_bucket_refund.lua
+var luaTokenBucketRefund string
+
+var tokenBucketRefundScript = redisx.Register(luaTokenBucketRefund)
+
+// RedisTokenBucketLimiter Redis 上的令牌桶算法限流器实现。
+// 每个 key 只存令牌数和上次补充的时间，允许 burst 个突发请求，
+// 之后 interval 内补充 rate 个令牌
+type RedisTokenBucketLimiter struct {
+	cmd redis.Cmdable
+	// interval 内补充 rate 个令牌，例如：1s 补充 3000 个
+	interval time.Duration
+	rate     int
+	// 桶的容量
+	burst int
+}
+
+func NewRedisTokenBucketLimiter(cmd redis.Cmdable, interval time.Duration, rate int, burst int) Limiter {
+	return &RedisTokenBucketLimiter{
+		cmd:      cmd,
+		interval: interval,
+		rate:     rate,
+		burst:    burst,
+	}
+}
+
+func (r *RedisTokenBucketLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limit(ctx, r, key)
+}
+
+func (r *RedisTokenBucketLimiter) Allow(ctx context.Context, key string) (Decision, error) {
+	// 每毫秒补充多少个令牌
+	perMilli := float64(r.rate) / float64(r.interval.Milliseconds())
+	res, err := tokenBucketScript.Run(ctx, r.cmd, []string{key},
+		r.burst, perMilli, time.Now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+	return decision(r.burst, res)
+}
+
+// Refund 还回去一个令牌，不超过桶的容量
+func (r *RedisTokenBucketLimiter) Refund(ctx context.Context, key string, d Decision) error {
+	return tokenBucketRefundScript.Run(ctx, r.cmd, []string{key}, r.burst).Err()
+}
@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 限流算法
+const (
+	AlgorithmSlidingWindow = "sliding_window"
+	AlgorithmFixedWindow   = "fixed_window"
+	AlgorithmTokenBucket   = "token_bucket"
+	// AlgorithmHybrid 先用本地令牌桶，再用 Redis 滑动窗口
+	AlgorithmHybrid = "hybrid"
+)
+
+var ErrInvalidRule = errors.New("限流规则不合法")
+
+// RuleSpec 一条限流规则的配置，规则源里面存的就是它。
+// 具体怎么匹配请求、Key 是什么意思由使用方决定，例如 HTTP 按照 Method 和 Path 匹配，
+// 短信只用 Key 表示维度
+type RuleSpec struct {
+	Name   string `json:"name"`
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Key    string `json:"key"`
+
+	Algorithm string `json:"algorithm"`
+	// Interval 内允许 Rate 个请求；令牌桶是 Interval 内补充 Rate 个令牌
+	Interval time.Duration `json:"-"`
+	Rate     int           `json:"rate"`
+	// 令牌桶的容量，0 就是和 Rate 一样
+	Burst int `json:"burst,omitempty"`
+	// open、closed、local，空的就是 open
+	FailurePolicy string `json:"failure_policy,omitempty"`
+	// 检查的顺序，小的先检查，一样的保持默认规则和规则源里面的顺序
+	Order int `json:"order,omitempty"`
+}
+
+// MarshalJSON Interval 在 JSON 里面写成 "1m0s" 这种格式，方便运维手改
+func (s RuleSpec) MarshalJSON() ([]byte, error) {
+	type plain RuleSpec
+	return json.Marshal(struct {
+		plain
+		Interval string `json:"interval"`
+	}{plain: plain(s), Interval: s.Interval.String()})
+}
+
+func (s *RuleSpec) UnmarshalJSON(data []byte) error {
+	type plain RuleSpec
+	var val struct {
+		plain
+		Interval string `json:"interval"`
+	}
+	if err := json.Unmarshal(data, &val); err != nil {
+		return err
+	}
+	*s = RuleSpec(val.plain)
+	if val.Interval == "" {
+		return nil
+	}
+	interval, err := time.ParseDuration(val.Interval)
+	if err != nil {
+		return fmt.Errorf("%w：%s 的 interval %w", ErrInvalidRule, s.Name, err)
+	}
+	s.Interval = interval
+	return nil
+}
+
+func (s RuleSpec) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("%w：没有名字", ErrInvalidRule)
+	}
+	if s.Path != "" && !strings.HasPrefix(s.Path, "/") {
+		return fmt.Errorf("%w：%s 的 path 要以 / 开头", ErrInvalidRule, s.Name)
+	}
+	switch s.Algorithm {
+	case AlgorithmSlidingWindow, AlgorithmFixedWindow, AlgorithmTokenBucket, AlgorithmHybrid:
+	default:
+		return fmt.Errorf("%w：%s 的算法 %q 不支持", ErrInvalidRule, s.Name, s.Algorithm)
+	}
+	if s.Interval < time.Millisecond {
+		return fmt.Errorf("%w：%s 的 interval 至少 1ms", ErrInvalidRule, s.Name)
+	}
+	if s.Rate <= 0 || s.Burst < 0 {
+		return fmt.Errorf("%w：%s 的 rate 要大于 0，burst 不能小于 0", ErrInvalidRule, s.Name)
+	}
+	if _, err := ParseFailurePolicy(s.FailurePolicy); err != nil {
+		return fmt.Errorf("%w：%s %w", ErrInvalidRule, s.Name, err)
+	}
+	return nil
+}
+
+// ValidateRules 整批校验，名字不能重复，也不能一条规则都没有
+func ValidateRules(specs []RuleSpec) error {
+	if len(specs) == 0 {
+		return fmt.Errorf("%w：一条规则都没有", ErrInvalidRule)
+	}
+	names := make(map[string]struct{}, len(specs))
+	for _, s := range specs {
+		if err := s.Validate(); err != nil {
+			return err
+		}
+		if _, ok := names[s.Name]; ok {
+			return fmt.Errorf("%w：%s 重复了", ErrInvalidRule, s.Name)
+		}
+		names[s.Name] = struct{}{}
+	}
+	return nil
+}
+
+func ParseFailurePolicy(policy string) (FailurePolicy, error) {
+	switch policy {
+	case "", "open":
+		return FailOpen, nil
+	case "closed":
+		return FailClosed, nil
+	case "local":
+		return FailLocal, nil
+	default:
+		return FailOpen, fmt.Errorf("不支持的降级策略 %q", policy)
+	}
+}
+
+// NewLimiterFromSpec 按照规则创建限流器，prefix 用来区分指标，例如 http、sms。
+// 除了 hybrid，其它算法都用 FailSafeLimiter 装饰，降级为本地限流的时候用同样配额的本地令牌桶
+func NewLimiterFromSpec(cmd redis.Cmdable, prefix string, spec RuleSpec) (Limiter, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	burst := spec.Burst
+	if burst == 0 {
+		burst = spec.Rate
+	}
+	var limiter Limiter
+	switch spec.Algorithm {
+	case AlgorithmHybrid:
+		return NewHybridLimiter(NewLocalTokenBucketLimiter(spec.Interval, spec.Rate, burst),
+			NewRedisSlidingWindowLimiter(cmd, spec.Interval, spec.Rate), time.Second*10), nil
+	case AlgorithmFixedWindow:
+		limiter = NewRedisFixedWindowLimiter(cmd, spec.Interval, spec.Rate)
+	case AlgorithmTokenBucket:
+		limiter = NewRedisTokenBucketLimiter(cmd, spec.Interval, spec.Rate, burst)
+	default:
+		limiter = NewRedisSlidingWindowLimiter(cmd, spec.Interval, spec.Rate)
+	}
+	policy, _ := ParseFailurePolicy(spec.FailurePolicy)
+	return NewFailSafeLimiter(prefix+":"+spec.Name, limiter, policy,
+		NewLocalTokenBucketLimiter(spec.Interval, spec.Rate, burst)), nil
+}
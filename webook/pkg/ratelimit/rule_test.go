@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleSpec_JSON(t *testing.T) {
+	spec := RuleSpec{
+		Name: "login", Method: "POST", Path: "/users/login", Key: "ip",
+		Algorithm: AlgorithmSlidingWindow, Interval: time.Minute, Rate: 10, FailurePolicy: "local",
+	}
+	data, err := json.Marshal(spec)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"login","method":"POST","path":"/users/login","key":"ip",
+		"algorithm":"sliding_window","interval":"1m0s","rate":10,"failure_policy":"local"}`, string(data))
+
+	var res RuleSpec
+	require.NoError(t, json.Unmarshal([]byte(`{"name":"login","method":"POST","path":"/users/login","key":"ip",
+		"algorithm":"sliding_window","interval":"1m","rate":10,"failure_policy":"local"}`), &res))
+	assert.Equal(t, spec, res)
+
+	err = json.Unmarshal([]byte(`{"name":"login","interval":"一分钟"}`), &res)
+	assert.True(t, errors.Is(err, ErrInvalidRule))
+}
+
+func TestValidateRules(t *testing.T) {
+	valid := RuleSpec{Name: "login", Key: "ip", Algorithm: AlgorithmTokenBucket, Interval: time.Second, Rate: 10}
+	testCases := []struct {
+		name  string
+		specs func() []RuleSpec
+
+		expectedErr bool
+	}{
+		{
+			name:  "合法",
+			specs: func() []RuleSpec { return []RuleSpec{valid} },
+		},
+		{
+			name:        "一条规则都没有",
+			specs:       func() []RuleSpec { return nil },
+			expectedErr: true,
+		},
+		{
+			name:        "名字重复",
+			specs:       func() []RuleSpec { return []RuleSpec{valid, valid} },
+			expectedErr: true,
+		},
+		{
+			name: "没有名字",
+			specs: func() []RuleSpec {
+				s := valid
+				s.Name = ""
+				return []RuleSpec{s}
+			},
+			expectedErr: true,
+		},
+		{
+			name: "路径不以 / 开头",
+			specs: func() []RuleSpec {
+				s := valid
+				s.Path = "users/login"
+				return []RuleSpec{s}
+			},
+			expectedErr: true,
+		},
+		{
+			name: "不支持的算法",
+			specs: func() []RuleSpec {
+				s := valid
+				s.Algorithm = "leaky_bucket"
+				return []RuleSpec{s}
+			},
+			expectedErr: true,
+		},
+		{
+			name: "窗口太小",
+			specs: func() []RuleSpec {
+				s := valid
+				s.Interval = time.Microsecond
+				return []RuleSpec{s}
+			},
+			expectedErr: true,
+		},
+		{
+			name: "阈值是 0",
+			specs: func() []RuleSpec {
+				s := valid
+				s.Rate = 0
+				return []RuleSpec{s}
+			},
+			expectedErr: true,
+		},
+		{
+			name: "不支持的降级策略",
+			specs: func() []RuleSpec {
+				s := valid
+				s.FailurePolicy = "random"
+				return []RuleSpec{s}
+			},
+			expectedErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRules(tc.specs())
+			if tc.expectedErr {
+				assert.True(t, errors.Is(err, ErrInvalidRule), err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
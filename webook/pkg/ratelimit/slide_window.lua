@@ -2,6 +2,8 @@
 -- ZREMRANGEBYSCORE key1 0 6
 -- 7 执行完之后
 
+-- 返回 {是否限流, 剩余次数, 多少毫秒之后完全恢复, 多少毫秒之后可以重试}
+
 -- 限流对象
 local key = KEYS[1]
 -- 窗口大小
@@ -9,6 +11,8 @@ local window = tonumber(ARGV[1])
 -- 阈值
 local threshold = tonumber( ARGV[2])
 local now = tonumber(ARGV[3])
+-- 每个请求一个唯一的 member，同一毫秒内的请求不会被合并成一个
+local member = ARGV[4]
 -- 窗口的起始时间
 local min = now - window
 
@@ -17,10 +21,15 @@ local cnt = redis.call('ZCOUNT', key, '-inf', '+inf')
 -- local cnt = redis.call('ZCOUNT', key, min, '+inf')
 if cnt >= threshold then
     -- 执行限流
-    return "true"
+    -- 最早的请求移出窗口之后可以重试，最晚的请求移出窗口之后完全恢复
+    local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+    local newest = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+    local retry = tonumber(oldest[2]) + window - now
+    local reset = tonumber(newest[2]) + window - now
+    return {1, 0, reset, retry}
 else
-    -- 把 score 和 member 都设置成 now
-    redis.call('ZADD', key, now, now)
+    -- score 是 now，member 是唯一 ID
+    redis.call('ZADD', key, now, member)
     redis.call('PEXPIRE', key, window)
-    return "false"
+    return {0, threshold - cnt - 1, window, 0}
 end
\ No newline at end of file
@@ -0,0 +1,156 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RuleSource 限流规则从哪里来，运维改了规则之后不用重启
+type RuleSource interface {
+	Load(ctx context.Context) ([]RuleSpec, error)
+}
+
+// FileRuleSource 规则放在一个 JSON 文件里面，是一个 RuleSpec 数组，按照数组的顺序检查。
+// k8s 里面一般是挂载的 ConfigMap
+type FileRuleSource struct {
+	path string
+}
+
+func NewFileRuleSource(path string) RuleSource {
+	return &FileRuleSource{
+		path: path,
+	}
+}
+
+// Load 文件不存在说明没有配置规则，返回空的
+func (f *FileRuleSource) Load(ctx context.Context) ([]RuleSpec, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var specs []RuleSpec
+	if err = json.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("%w：%w", ErrInvalidRule, err)
+	}
+	return specs, nil
+}
+
+// RedisHashRuleSource 规则放在 Redis 的一个 hash 里面，field 是规则的名字，value 是 RuleSpec 的 JSON。
+// 改一条规则只需要 HSET 一下。hash 没有顺序，规则按照 Order 排序，Order 一样的按名字排序
+type RedisHashRuleSource struct {
+	cmd redis.Cmdable
+	key string
+}
+
+func NewRedisHashRuleSource(cmd redis.Cmdable, key string) RuleSource {
+	return &RedisHashRuleSource{
+		cmd: cmd,
+		key: key,
+	}
+}
+
+func (r *RedisHashRuleSource) Load(ctx context.Context) ([]RuleSpec, error) {
+	fields, err := r.cmd.HGetAll(ctx, r.key).Result()
+	if err != nil {
+		return nil, err
+	}
+	specs := make([]RuleSpec, 0, len(fields))
+	for name, val := range fields {
+		var spec RuleSpec
+		if err = json.Unmarshal([]byte(val), &spec); err != nil {
+			return nil, fmt.Errorf("%w：%s %w", ErrInvalidRule, name, err)
+		}
+		spec.Name = name
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		if specs[i].Order != specs[j].Order {
+			return specs[i].Order < specs[j].Order
+		}
+		return specs[i].Name < specs[j].Name
+	})
+	return specs, nil
+}
+
+// MergeRules 规则源里面的规则按照名字覆盖默认规则，规则源里面没有的用默认规则，
+// 这样删掉一条规则就是退回默认值，而不是把这条限流去掉。
+// 新增的规则排在默认规则后面，最后按照 Order 稳定排序
+func MergeRules(defaults, specs []RuleSpec) []RuleSpec {
+	overrides := make(map[string]RuleSpec, len(specs))
+	for _, spec := range specs {
+		overrides[spec.Name] = spec
+	}
+	var res []RuleSpec
+	for _, spec := range defaults {
+		if override, ok := overrides[spec.Name]; ok {
+			spec = override
+			delete(overrides, spec.Name)
+		}
+		res = append(res, spec)
+	}
+	for _, spec := range specs {
+		if _, ok := overrides[spec.Name]; ok {
+			res = append(res, spec)
+			delete(overrides, spec.Name)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Order < res[j].Order
+	})
+	return res
+}
+
+// WatchRules 每隔 interval 从 source 读一次规则，和 defaults 合并之后变了就调用 apply。
+// 读取失败、校验不通过或者 apply 返回 error 的时候整批丢弃，继续用原来的规则。
+// 调用方一开始就已经用上了 defaults，source 里面没有规则的时候不会再调用 apply。
+// 一直阻塞到 ctx 取消，一般是单独开一个 goroutine
+func WatchRules(ctx context.Context, source RuleSource, interval time.Duration,
+	defaults []RuleSpec, apply func(specs []RuleSpec) error) {
+	current := defaults
+	reload := func() {
+		loadCtx, cancel := context.WithTimeout(ctx, time.Second)
+		loaded, err := source.Load(loadCtx)
+		cancel()
+		if err != nil {
+			log.Println("读取限流规则失败", err)
+			return
+		}
+		specs := MergeRules(defaults, loaded)
+		if reflect.DeepEqual(specs, current) {
+			return
+		}
+		if err = ValidateRules(specs); err != nil {
+			log.Println("限流规则不合法，继续用原来的规则", err)
+			return
+		}
+		if err = apply(specs); err != nil {
+			log.Println("应用限流规则失败，继续用原来的规则", err)
+			return
+		}
+		current = specs
+	}
+	reload()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reload()
+		}
+	}
+}
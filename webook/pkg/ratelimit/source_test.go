@@ -0,0 +1,226 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"geektime/webook/internal/repository/cache/redismocks"
+)
+
+func TestFileRuleSource_Load(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "http.json")
+
+	// 文件不存在，说明没有配置
+	specs, err := NewFileRuleSource(path).Load(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, specs)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"name": "login", "key": "ip", "algorithm": "sliding_window", "interval": "1m", "rate": 5},
+		{"name": "ip", "key": "ip", "algorithm": "hybrid", "interval": "1s", "rate": 100, "burst": 200}
+	]`), 0o644))
+	specs, err = NewFileRuleSource(path).Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []RuleSpec{
+		{Name: "login", Key: "ip", Algorithm: AlgorithmSlidingWindow, Interval: time.Minute, Rate: 5},
+		{Name: "ip", Key: "ip", Algorithm: AlgorithmHybrid, Interval: time.Second, Rate: 100, Burst: 200},
+	}, specs)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{`), 0o644))
+	_, err = NewFileRuleSource(path).Load(context.Background())
+	assert.True(t, errors.Is(err, ErrInvalidRule))
+}
+
+func TestRedisHashRuleSource_Load(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	res := redis.NewMapStringStringCmd(context.Background())
+	res.SetVal(map[string]string{
+		"phone":  `{"key": "phone", "algorithm": "sliding_window", "interval": "24h", "rate": 10}`,
+		"biz":    `{"name": "ignored", "key": "biz", "algorithm": "fixed_window", "interval": "1s", "rate": 100}`,
+		"global": `{"key": "global", "algorithm": "fixed_window", "interval": "1s", "rate": 1000, "order": -1}`,
+	})
+	cmd.EXPECT().HGetAll(gomock.Any(), "ratelimit:rules:sms").Return(res)
+
+	specs, err := NewRedisHashRuleSource(cmd, "ratelimit:rules:sms").Load(context.Background())
+	require.NoError(t, err)
+	// 名字以 field 为准，先按照 Order 排序，再按照名字排序
+	assert.Equal(t, []RuleSpec{
+		{Name: "global", Key: "global", Algorithm: AlgorithmFixedWindow, Interval: time.Second, Rate: 1000, Order: -1},
+		{Name: "biz", Key: "biz", Algorithm: AlgorithmFixedWindow, Interval: time.Second, Rate: 100},
+		{Name: "phone", Key: "phone", Algorithm: AlgorithmSlidingWindow, Interval: time.Hour * 24, Rate: 10},
+	}, specs)
+}
+
+func TestMergeRules(t *testing.T) {
+	defaults := []RuleSpec{
+		{Name: "phone", Key: "phone", Algorithm: AlgorithmSlidingWindow, Interval: time.Hour * 24, Rate: 10},
+		{Name: "ip", Key: "ip", Algorithm: AlgorithmSlidingWindow, Interval: time.Hour, Rate: 20},
+	}
+	testCases := []struct {
+		name  string
+		specs []RuleSpec
+
+		expected []RuleSpec
+	}{
+		{
+			name:     "规则源里面没有规则，用默认的",
+			expected: defaults,
+		},
+		{
+			name: "同名的覆盖默认规则，位置不变",
+			specs: []RuleSpec{
+				{Name: "phone", Key: "phone", Algorithm: AlgorithmSlidingWindow, Interval: time.Hour, Rate: 5},
+			},
+			expected: []RuleSpec{
+				{Name: "phone", Key: "phone", Algorithm: AlgorithmSlidingWindow, Interval: time.Hour, Rate: 5},
+				defaults[1],
+			},
+		},
+		{
+			name: "新增的规则排在后面",
+			specs: []RuleSpec{
+				{Name: "biz", Key: "biz", Algorithm: AlgorithmFixedWindow, Interval: time.Second, Rate: 100},
+			},
+			expected: []RuleSpec{
+				defaults[0],
+				defaults[1],
+				{Name: "biz", Key: "biz", Algorithm: AlgorithmFixedWindow, Interval: time.Second, Rate: 100},
+			},
+		},
+		{
+			name: "按照 Order 排序",
+			specs: []RuleSpec{
+				{Name: "biz", Key: "biz", Algorithm: AlgorithmFixedWindow, Interval: time.Second, Rate: 100, Order: -1},
+			},
+			expected: []RuleSpec{
+				{Name: "biz", Key: "biz", Algorithm: AlgorithmFixedWindow, Interval: time.Second, Rate: 100, Order: -1},
+				defaults[0],
+				defaults[1],
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, MergeRules(defaults, tc.specs))
+		})
+	}
+}
+
+// stubSource 每次 Load 依次返回 results 里面的一个，用完了就一直返回最后一个
+type stubSource struct {
+	mutex   sync.Mutex
+	results []stubResult
+}
+
+type stubResult struct {
+	specs []RuleSpec
+	err   error
+}
+
+func (s *stubSource) Load(ctx context.Context) ([]RuleSpec, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	res := s.results[0]
+	if len(s.results) > 1 {
+		s.results = s.results[1:]
+	}
+	return res.specs, res.err
+}
+
+func TestWatchRules(t *testing.T) {
+	v1 := []RuleSpec{{Name: "login", Key: "ip", Algorithm: AlgorithmSlidingWindow, Interval: time.Minute, Rate: 10}}
+	v2 := []RuleSpec{{Name: "login", Key: "ip", Algorithm: AlgorithmSlidingWindow, Interval: time.Minute, Rate: 3}}
+	v3 := []RuleSpec{{Name: "login", Key: "ip", Algorithm: AlgorithmSlidingWindow, Interval: time.Minute, Rate: 1}}
+	invalid := []RuleSpec{{Name: "login", Algorithm: "leaky_bucket", Interval: time.Minute, Rate: 1}}
+	source := &stubSource{results: []stubResult{
+		// 还没有配置规则，用默认的
+		{},
+		{specs: v1},
+		// 没变，不用重新应用
+		{specs: v1},
+		// 读取失败、规则不合法、应用失败都继续用 v1
+		{err: errors.New("mock redis err")},
+		{specs: invalid},
+		{specs: nil},
+		{specs: v3},
+		{specs: v2},
+	}}
+
+	var (
+		mutex   sync.Mutex
+		applied [][]RuleSpec
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		WatchRules(ctx, source, time.Millisecond, nil, func(specs []RuleSpec) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if specs[0].Rate == 1 {
+				return errors.New("mock apply err")
+			}
+			applied = append(applied, specs)
+			return nil
+		})
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(applied) == 2
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, [][]RuleSpec{v1, v2}, applied)
+}
+
+func TestWatchRules_FallbackToDefaults(t *testing.T) {
+	defaults := []RuleSpec{{Name: "login", Key: "ip", Algorithm: AlgorithmSlidingWindow, Interval: time.Minute, Rate: 10}}
+	override := []RuleSpec{{Name: "login", Key: "ip", Algorithm: AlgorithmSlidingWindow, Interval: time.Minute, Rate: 3}}
+	source := &stubSource{results: []stubResult{
+		// 和默认规则一样，不用重新应用
+		{},
+		{specs: override},
+		// 规则源里面的规则被删掉了，退回默认规则
+		{},
+	}}
+
+	var (
+		mutex   sync.Mutex
+		applied [][]RuleSpec
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		WatchRules(ctx, source, time.Millisecond, defaults, func(specs []RuleSpec) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			applied = append(applied, specs)
+			return nil
+		})
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(applied) == 2
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, [][]RuleSpec{override, defaults}, applied)
+}
@@ -0,0 +1,37 @@
+-- 令牌桶，桶里最多 capacity 个令牌，允许这么多的突发请求，
+-- 之后按照 rate 匀速补充
+-- 返回 {是否限流, 剩余令牌, 多少毫秒之后补满, 多少毫秒之后可以重试}
+local key = KEYS[1]
+-- 桶的容量
+local capacity = tonumber(ARGV[1])
+-- 每毫秒补充多少个令牌
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil then
+    -- 新的桶是满的
+    tokens = capacity
+    ts = now
+end
+-- 补充上次到现在的令牌
+if now > ts then
+    tokens = math.min(capacity, tokens + (now - ts) * rate)
+    ts = now
+end
+
+local limited = tokens < 1
+if not limited then
+    tokens = tokens - 1
+end
+redis.call('HSET', key, 'tokens', tokens, 'ts', ts)
+-- 桶补满之后，这个 key 就跟不存在一样了，可以删掉
+redis.call('PEXPIRE', key, math.ceil(capacity / rate))
+local reset = math.ceil((capacity - tokens) / rate)
+if limited then
+    -- 执行限流，攒够一个令牌之后可以重试
+    return {1, 0, reset, math.ceil((1 - tokens) / rate)}
+end
+return {0, math.floor(tokens), reset, 0}
\ No newline at end of file
@@ -0,0 +1,9 @@
+-- 还回去一个令牌，不超过桶的容量。桶已经过期删掉了就是满的，不用管
+local key = KEYS[1]
+local capacity = tonumber(ARGV[1])
+local tokens = tonumber(redis.call('HGET', key, 'tokens'))
+if tokens == nil then
+    return 0
+end
+redis.call('HSET', key, 'tokens', math.min(capacity, tokens + 1))
+return 1
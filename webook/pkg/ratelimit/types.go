@@ -2,11 +2,69 @@ package ratelimit
 
 import (
 	"context"
+	"errors"
+	"time"
 )
 
+var errUnknownResult = errors.New("限流脚本返回了未知的结果")
+
 type Limiter interface {
 	// Limit 有没有触发限流，key 就是限流对象
 	// bool 代表是否限流，true 就是要限流
 	// error 限流器本身有没有错误
 	Limit(ctx context.Context, key string) (bool, error)
+	// Allow 和 Limit 一样，但是返回详细的结果，调用方可以据此告诉客户端什么时候重试
+	Allow(ctx context.Context, key string) (Decision, error)
+}
+
+// Decision 一次限流判断的结果
+type Decision struct {
+	Allowed bool
+	// 阈值，窗口内允许的请求数或者令牌桶的容量
+	Limit int
+	// 还能放过多少个请求
+	Remaining int
+	// 多久之后配额完全恢复
+	Reset time.Duration
+	// 被限流的时候，多久之后可以重试
+	RetryAfter time.Duration
+	// 限流器出错了，这是按照 FailurePolicy 降级之后的结果
+	Degraded bool
+	// 放行的时候由限流器填上，退回这一次计数的时候用，见 Refunder
+	Ticket string
+}
+
+// Refunder 放行之后可以把这一次计数退回去。几个限流器一起用的时候，
+// 后面的拒绝了，前面已经放行的要退回去，不然被拒绝的请求也占用了配额
+type Refunder interface {
+	Refund(ctx context.Context, key string, d Decision) error
+}
+
+// Refund d 没有放行，或者 l 不支持退回的时候什么都不做
+func Refund(ctx context.Context, l Limiter, key string, d Decision) error {
+	r, ok := l.(Refunder)
+	if !ok || !d.Allowed {
+		return nil
+	}
+	return r.Refund(ctx, key, d)
+}
+
+// decision 解析 lua 脚本返回的 {是否限流, 剩余次数, 多少毫秒之后完全恢复, 多少毫秒之后可以重试}
+func decision(limit int, res []int64) (Decision, error) {
+	if len(res) != 4 {
+		return Decision{}, errUnknownResult
+	}
+	return Decision{
+		Allowed:    res[0] == 0,
+		Limit:      limit,
+		Remaining:  int(res[1]),
+		Reset:      time.Duration(res[2]) * time.Millisecond,
+		RetryAfter: time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
+
+// limit 用 Allow 实现 Limit
+func limit(ctx context.Context, l Limiter, key string) (bool, error) {
+	d, err := l.Allow(ctx, key)
+	return !d.Allowed, err
 }
@@ -0,0 +1,55 @@
+package redisx
+
+import (
+	"context"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	mutex   sync.RWMutex
+	scripts = make(map[string]*redis.Script)
+)
+
+// Register 创建一个 lua 脚本并登记下来，启动的时候 PreloadAll 会把登记过的脚本都加载到 Redis 里面。
+// 一般在包初始化的时候调用：
+//
+//	//go:embed lua/set_code.lua
+//	var luaSetCode string
+//	var setCodeScript = redisx.Register(luaSetCode)
+//
+// 执行用 redis.Script 的 Run，先 EVALSHA，碰到 NOSCRIPT 再 EVAL。
+// 同样的脚本注册多次拿到的是同一个 redis.Script
+func Register(src string) *redis.Script {
+	s := redis.NewScript(src)
+	mutex.Lock()
+	defer mutex.Unlock()
+	if old, ok := scripts[s.Hash()]; ok {
+		return old
+	}
+	scripts[s.Hash()] = s
+	return s
+}
+
+// PreloadAll 把注册过的脚本都加载到 Redis 里面，启动的时候调用一次
+func PreloadAll(ctx context.Context, c redis.Scripter) error {
+	mutex.RLock()
+	all := make([]*redis.Script, 0, len(scripts))
+	for _, s := range scripts {
+		all = append(all, s)
+	}
+	mutex.RUnlock()
+	return Preload(ctx, c, all...)
+}
+
+// Preload 把脚本提前加载到 Redis 里面。
+// 加载失败也没关系，Run 碰到 NOSCRIPT 会改用 EVAL，顺便把脚本重新缓存起来
+func Preload(ctx context.Context, c redis.Scripter, scripts ...*redis.Script) error {
+	for _, s := range scripts {
+		if err := s.Load(ctx, c).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
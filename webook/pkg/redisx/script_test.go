@@ -0,0 +1,69 @@
+package redisx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"geektime/webook/internal/repository/cache/redismocks"
+)
+
+func TestPreload(t *testing.T) {
+	s1 := redis.NewScript("return 1")
+	s2 := redis.NewScript("return 2")
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+
+		expectedErr error
+	}{
+		{
+			name: "全部加载成功",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().ScriptLoad(gomock.Any(), "return 1").Return(redis.NewStringResult(s1.Hash(), nil))
+				cmd.EXPECT().ScriptLoad(gomock.Any(), "return 2").Return(redis.NewStringResult(s2.Hash(), nil))
+				return cmd
+			},
+		},
+		{
+			name: "加载失败",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().ScriptLoad(gomock.Any(), "return 1").Return(redis.NewStringResult("", errors.New("mock redis err")))
+				return cmd
+			},
+			expectedErr: errors.New("mock redis err"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			err := Preload(context.Background(), tc.mock(ctrl), s1, s2)
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	s1 := Register("return 3")
+	s2 := Register("return 3")
+	assert.Same(t, s1, s2)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	mutex.RLock()
+	// 登记过的脚本都会加载
+	assert.Contains(t, scripts, s1.Hash())
+	for hash := range scripts {
+		cmd.EXPECT().ScriptLoad(gomock.Any(), gomock.Any()).Return(redis.NewStringResult(hash, nil))
+	}
+	mutex.RUnlock()
+	assert.NoError(t, PreloadAll(context.Background(), cmd))
+}
@@ -8,9 +8,9 @@ package main
 
 import (
 	"geektime/webook/internal/repository"
-	"geektime/webook/internal/repository/cache"
 	"geektime/webook/internal/repository/dao"
 	"geektime/webook/internal/service"
+	"geektime/webook/internal/service/captcha"
 	"geektime/webook/internal/web"
 	"geektime/webook/ioc"
 	"github.com/gin-gonic/gin"
@@ -18,19 +18,44 @@ import (
 
 // Injectors from wire.go:
 
-func InitWebServer() *gin.Engine {
+func InitWebServer() (*gin.Engine, error) {
 	cmdable := ioc.InitRedis()
 	v := ioc.InitMiddlewares(cmdable)
 	db := ioc.InitDB()
 	userDAO := dao.NewUserDAO(db)
-	userCache := cache.NewUserCache(cmdable)
+	userCache := ioc.InitUserCache(cmdable)
 	userRepository := repository.NewUserRepository(userDAO, userCache)
-	userService := service.NewUserService(userRepository)
-	codeCache := cache.NewCodeCache(cmdable)
+	userService := ioc.InitUserService(userRepository)
+	codeCache, err := ioc.InitCodeCache(cmdable)
+	if err != nil {
+		return nil, err
+	}
 	codeRepository := repository.NewCodeRepository(codeCache)
-	smsService := ioc.InitSMSService()
-	codeService := service.NewCodeService(codeRepository, smsService)
-	userHandler := web.NewUserHandler(userService, codeService)
-	engine := ioc.InitWebServer(v, userHandler)
-	return engine
+	registry := ioc.InitSMSTemplates()
+	smsRecordDAO := dao.NewSMSRecordDAO(db)
+	smsPhoneHashKey := ioc.InitSMSPhoneHashKey()
+	smsRecordRepository := repository.NewSMSRecordRepository(smsRecordDAO, smsPhoneHashKey)
+	smsProvider := ioc.InitSMSProvider(registry)
+	smsService := ioc.InitSMSService(smsProvider, smsRecordRepository, cmdable)
+	emailService := ioc.InitEmailService()
+	notifyService := ioc.InitNotifyService(smsService, emailService)
+	codeBizRegistry, err := ioc.InitCodeBizRegistry()
+	if err != nil {
+		return nil, err
+	}
+	codeProofKey, err := ioc.InitCodeProofKey()
+	if err != nil {
+		return nil, err
+	}
+	codeService := service.NewCodeService(codeRepository, notifyService, codeBizRegistry, codeProofKey)
+	captchaService := captcha.NewService(cmdable)
+	verifier := ioc.InitCaptchaVerifier(captchaService)
+	riskChecker := ioc.InitCaptchaRiskChecker(cmdable)
+	userHandler := web.NewUserHandler(userService, codeService, verifier, riskChecker)
+	smsRecordService := service.NewSMSRecordService(smsRecordRepository)
+	smsRecordAuth := ioc.InitSMSRecordAuth()
+	smsRecordHandler := web.NewSMSRecordHandler(smsRecordService, smsRecordAuth)
+	captchaHandler := web.NewCaptchaHandler(captchaService)
+	engine := ioc.InitWebServer(v, userHandler, smsRecordHandler, captchaHandler)
+	return engine, nil
 }